@@ -2,52 +2,51 @@ package carto
 
 import (
 	"fmt"
+	"math"
+	"path"
 	"strings"
 
 	"github.com/mathuin/gdal"
 )
 
-func (r Region) bathy(inarr []int16, inx int, iny int) []int16 {
+func (r Region) bathy(inarr []int16, inx int, iny int) ([]int16, error) {
 	inprod := inx * iny
 
 	// mem driver!
-	memdrv, err1 := gdal.GetDriverByName("MEM")
-	if err1 != nil {
-		panic(err1)
+	memdrv, err := gdal.GetDriverByName("MEM")
+	if err != nil {
+		return nil, wrap("bathy", ErrGDAL, err)
 	}
 
 	// create a source band from that array
 	srcDS := memdrv.Create("src", inx, iny, 1, gdal.Int16, nil)
 	srcBand := srcDS.RasterBand(1)
-	err2 := srcBand.IO(gdal.Write, 0, 0, inx, iny, inarr, inx, iny, 0, 0)
-	if err2 != nil && err2.Error() != "No Error" {
-		panic(err2)
+	if err := srcBand.IO(gdal.Write, 0, 0, inx, iny, inarr, inx, iny, 0, 0); notnil(err) {
+		return nil, wrap("bathy", ErrGDAL, err)
 	}
 
 	// create a target band
 	destDS := memdrv.Create("dest", inx, iny, 1, gdal.Int16, nil)
 	destBand := destDS.RasterBand(1)
 
-	// someday water may not be so simple
-	not11 := nomatch(inarr, []int16{11})
+	// distances are measured from the scheme's water classes
+	notwater := nomatch(inarr, r.scheme.Water)
 
 	// configure options
-	options := []string{fmt.Sprintf("MAXDIST=%d", r.maxdepth), fmt.Sprintf("NODATA=%d", r.maxdepth), fmt.Sprintf("VALUES=%s", strings.Join(not11, ","))}
+	options := []string{fmt.Sprintf("MAXDIST=%d", r.maxdepth), fmt.Sprintf("NODATA=%d", r.maxdepth), fmt.Sprintf("VALUES=%s", strings.Join(notwater, ","))}
 
 	// run computeproximity
-	err3 := srcBand.ComputeProximity(destBand, options, gdal.DummyProgress, nil)
-	if err3 != nil && err3.Error() != "No Error" {
-		panic(err3)
+	if err := srcBand.ComputeProximity(destBand, options, gdal.DummyProgress, nil); notnil(err) {
+		return nil, wrap("bathy", ErrGDAL, err)
 	}
 
 	// get output
 	outarr := make([]int16, inprod)
-	err4 := destBand.IO(gdal.Read, 0, 0, inx, iny, outarr, inx, iny, 0, 0)
-	if err4 != nil && err4.Error() != "No Error" {
-		panic(err4)
+	if err := destBand.IO(gdal.Read, 0, 0, inx, iny, outarr, inx, iny, 0, 0); notnil(err) {
+		return nil, wrap("bathy", ErrGDAL, err)
 	}
 
-	return outarr
+	return outarr, nil
 }
 
 // a list of all the numbers in the incoming array
@@ -73,3 +72,50 @@ func nomatch(arr []int16, ints []int16) []string {
 
 	return retval
 }
+
+// nodata value for warped bathymetry, far above any sea floor
+const bathyNodata = 32767
+
+// measuredBathy warps the bathymetry dataset onto the map grid and
+// returns its elevations in meters.  It is warped to Float32 whatever
+// the source's type, so that bathyNodata can be stored.
+func (r Region) measuredBathy(td string, extents IntExtents, xsize int, ysize int) ([]float32, error) {
+	bathyfile := path.Join(td, "bathymetry.tif")
+	if err := r.warp(r.vrts["bathymetry"], bathyfile, extents, "bilinear", bathyNodata, gdal.Float32); err != nil {
+		return nil, err
+	}
+	ds, err := gdal.Open(bathyfile, gdal.ReadOnly)
+	if err != nil {
+		return nil, wrap("bathymetry", ErrMissingDataset, err)
+	}
+	defer ds.Close()
+	if Debug {
+		datasetInfo(ds, "Bathymetry")
+	}
+	if ds.RasterXSize() != xsize || ds.RasterYSize() != ysize {
+		return nil, errorf("bathymetry", ErrOutsideRaster, "warped size %dx%d does not match map size %dx%d", ds.RasterXSize(), ds.RasterYSize(), xsize, ysize)
+	}
+	arr := make([]float32, xsize*ysize)
+	if err := ds.RasterBand(1).IO(gdal.Read, 0, 0, xsize, ysize, arr, xsize, ysize, 0, 0); notnil(err) {
+		return nil, wrap("bathymetry", ErrGDAL, err)
+	}
+	return arr, nil
+}
+
+// mergeBathy replaces guessed depths with measured ones.  Measured
+// values are elevations in meters, negative below sea level, and become
+// depths of vscale meters per block between 1 and maxdepth.  Only water
+// (where the guess is nonzero) is changed, and gaps in the measurements
+// keep the guess.
+func mergeBathy(guess []int16, measured []float32, nodata float32, vscale int, maxdepth int) []int16 {
+	out := make([]int16, len(guess))
+	for i, g := range guess {
+		out[i] = g
+		if g == 0 || measured[i] == nodata || math.IsNaN(float64(measured[i])) {
+			continue
+		}
+		depth := int(math.Ceil(float64(-measured[i]) / float64(vscale)))
+		out[i] = int16(min(max(depth, 1), maxdepth))
+	}
+	return out
+}
@@ -36,9 +36,15 @@ var bathy_tests = []struct {
 
 func Test_bathy(t *testing.T) {
 	for _, tt := range bathy_tests {
-		r := MakeRegion("Pie", FloatExtents{-71.575, -71.576, 41.189, 41.191}, "", "")
+		r, err := MakeRegion("Pie", FloatExtents{-71.575, -71.576, 41.189, 41.191}, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
 		r.maxdepth = tt.maxdepth
-		outarr := r.bathy(tt.inarr, tt.inx, tt.iny)
+		outarr, err := r.bathy(tt.inarr, tt.inx, tt.iny)
+		if err != nil {
+			t.Fatal(err)
+		}
 
 		for i, v := range outarr {
 			if v != tt.outarr[i] {
@@ -62,3 +68,34 @@ func printarr(arr []int16, x int, y int) string {
 	}
 	return retval
 }
+
+var mergeBathy_tests = []struct {
+	guess    []int16
+	measured []float32
+	vscale   int
+	maxdepth int
+	outarr   []int16
+}{
+	// land is left alone even where the measurements say water
+	{[]int16{0, 0}, []float32{-30, 5}, 6, 30, []int16{0, 0}},
+	// measurements replace guesses, rounding down into the sea floor
+	{[]int16{3, 3, 3}, []float32{-6, -7, -60}, 6, 30, []int16{1, 2, 10}},
+	// gaps keep the guesses
+	{[]int16{5, 7}, []float32{bathyNodata, -12}, 6, 30, []int16{5, 2}},
+	// depths stay between 1 and maxdepth
+	{[]int16{4, 4, 4}, []float32{2, -1000, -0.5}, 10, 30, []int16{1, 30, 1}},
+	// the bathymetry has its own vertical scale
+	{[]int16{1, 1}, []float32{-20, -200}, 2, 30, []int16{10, 30}},
+}
+
+func Test_mergeBathy(t *testing.T) {
+	for _, tt := range mergeBathy_tests {
+		outarr := mergeBathy(tt.guess, tt.measured, bathyNodata, tt.vscale, tt.maxdepth)
+		for i, v := range outarr {
+			if v != tt.outarr[i] {
+				t.Errorf("given %v and %v, wanted %v, got %v", tt.guess, tt.measured, tt.outarr, outarr)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package carto
+
+// Beach defaults: land within this many blocks of the sea becomes beach
+// unless it is more than this many blocks above sea level, and beaches
+// which rise this many blocks per block or more are stony.
+const (
+	defaultBeachWidth  = 3
+	defaultBeachHeight = 4
+	defaultBeachSlope  = 3
+)
+
+// SetBeaches configures the shoreline.  Land within width blocks of the
+// sea and no more than height blocks above sea level becomes beach, and
+// beaches as steep as slope become stone beaches.  A width of zero turns
+// beaches off.
+func (r *Region) SetBeaches(width int, height int, slope int) error {
+	params := []struct {
+		name  string
+		value int
+		min   int
+	}{
+		{"beach width", width, 0},
+		{"beach height", height, 0},
+		{"beach slope", slope, 1},
+	}
+	for _, p := range params {
+		if p.value < p.min {
+			return errorf("SetBeaches", ErrInvalidParameter, "%s %d must be at least %d", p.name, p.value, p.min)
+		}
+	}
+	r.beachwidth = width
+	r.beachheight = height
+	r.beachslope = slope
+	return nil
+}
+
+// A shoreline holds, for each pixel of the map, the distance in blocks
+// to the sea (zero for the sea itself and for land too far away) and
+// the slope in blocks per block.
+type shoreline struct {
+	dist  []int16
+	slope []int16
+}
+
+// shoreline finds the land near the sea from the bands already read
+// from the map.  Water with a river biome does not count as sea.
+func (r Region) shoreline(md *mapData) shoreline {
+	if r.beachwidth == 0 {
+		return shoreline{}
+	}
+	sea := make([]bool, md.inx*md.iny)
+	for i, lc := range md.arrs[Landcover] {
+		sea[i] = md.arrs[Bathy][i] > 0 && r.rules.Rule(int(lc)).Biome != "River"
+	}
+	return shoreline{dist: shoreDistance(sea, md.inx, md.iny, r.beachwidth), slope: md.slope}
+}
+
+// shoreDistance returns the distance in blocks, counting diagonals as
+// one, from each land pixel to the nearest sea pixel, or zero if that is
+// more than width blocks.
+func shoreDistance(sea []bool, inx int, iny int, width int) []int16 {
+	dist := make([]int16, len(sea))
+	queue := []int{}
+	for i, v := range sea {
+		if v {
+			queue = append(queue, i)
+		}
+	}
+	for d := 1; d <= width && len(queue) > 0; d++ {
+		next := []int{}
+		for _, i := range queue {
+			x, y := i%inx, i/inx
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					nx, ny := x+dx, y+dy
+					if nx < 0 || nx >= inx || ny < 0 || ny >= iny {
+						continue
+					}
+					n := nx + ny*inx
+					if sea[n] || dist[n] != 0 {
+						continue
+					}
+					dist[n] = int16(d)
+					next = append(next, n)
+				}
+			}
+		}
+		queue = next
+	}
+	return dist
+}
+
+// slopes returns the largest difference in elevation between each pixel
+// and its four neighbors.
+func slopes(elev []int16, inx int, iny int) []int16 {
+	slope := make([]int16, len(elev))
+	for i, e := range elev {
+		x, y := i%inx, i/inx
+		for _, d := range [][2]int{{-1, 0}, {1, 0}, {0, -1}, {0, 1}} {
+			nx, ny := x+d[0], y+d[1]
+			if nx < 0 || nx >= inx || ny < 0 || ny >= iny {
+				continue
+			}
+			diff := e - elev[nx+ny*inx]
+			if diff < 0 {
+				diff = -diff
+			}
+			if diff > slope[i] {
+				slope[i] = diff
+			}
+		}
+	}
+	return slope
+}
+
+// beachRule returns the rule for a land pixel on the shoreline, and
+// false if the pixel is not beach.
+func (r Region) beachRule(rule Rule, sl shoreline, index int32, elev int16) (Rule, bool) {
+	if rule.Water || sl.dist == nil || sl.dist[index] == 0 {
+		return rule, false
+	}
+	if int(elev) > r.sealevel+r.beachheight {
+		return rule, false
+	}
+	beach := Rule{Biome: "Beach", Surface: "Sand", Subsurface: "Sand", Spawn: rule.Spawn}
+	switch {
+	case int(sl.slope[index]) >= r.beachslope:
+		beach.Biome, beach.Surface, beach.Subsurface = "Stone Beach", "Gravel", "Stone"
+	case coldBiomes[rule.biome(elev, 0, 0)]:
+		beach.Biome = "Cold Beach"
+	}
+	return beach, true
+}
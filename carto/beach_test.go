@@ -0,0 +1,150 @@
+package carto
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var shoreDistance_tests = []struct {
+	sea   []bool
+	inx   int
+	iny   int
+	width int
+	dist  []int16
+}{
+	{
+		[]bool{
+			true, false, false, false, false,
+			true, false, false, false, false,
+			true, false, false, false, false,
+		},
+		5, 3, 3,
+		[]int16{
+			0, 1, 2, 3, 0,
+			0, 1, 2, 3, 0,
+			0, 1, 2, 3, 0,
+		},
+	},
+	{
+		[]bool{
+			false, false, false, false, false,
+			false, false, false, false, false,
+			false, false, true, false, false,
+			false, false, false, false, false,
+			false, false, false, false, false,
+		},
+		5, 5, 1,
+		[]int16{
+			0, 0, 0, 0, 0,
+			0, 1, 1, 1, 0,
+			0, 1, 0, 1, 0,
+			0, 1, 1, 1, 0,
+			0, 0, 0, 0, 0,
+		},
+	},
+	// no sea
+	{[]bool{false, false, false}, 3, 1, 3, []int16{0, 0, 0}},
+}
+
+func Test_shoreDistance(t *testing.T) {
+	for _, tt := range shoreDistance_tests {
+		dist := shoreDistance(tt.sea, tt.inx, tt.iny, tt.width)
+		if !reflect.DeepEqual(dist, tt.dist) {
+			t.Errorf("given width %d, wanted\n%s, got\n%s", tt.width, printarr(tt.dist, tt.inx, tt.iny), printarr(dist, tt.inx, tt.iny))
+		}
+	}
+}
+
+func Test_slopes(t *testing.T) {
+	elev := []int16{
+		62, 62, 63,
+		62, 64, 70,
+		62, 62, 63,
+	}
+	want := []int16{
+		0, 2, 7,
+		2, 6, 7,
+		0, 2, 7,
+	}
+	if got := slopes(elev, 3, 3); !reflect.DeepEqual(got, want) {
+		t.Errorf("wanted\n%s, got\n%s", printarr(want, 3, 3), printarr(got, 3, 3))
+	}
+}
+
+func Test_shoreline(t *testing.T) {
+	md := &mapData{inx: 4, iny: 1, arrs: map[int][]int16{
+		Landcover: {11, 11, 71, 71},
+		Bathy:     {3, 1, 0, 0},
+	}, slope: []int16{0, 1, 2, 3}}
+	r := Region{rules: NLCDRules, beachwidth: 1}
+	sl := r.shoreline(md)
+	if want := []int16{0, 0, 1, 0}; !reflect.DeepEqual(sl.dist, want) {
+		t.Errorf("wanted distances %v, got %v", want, sl.dist)
+	}
+	if &sl.slope[0] != &md.slope[0] {
+		t.Error("expected the slopes of the map data")
+	}
+	r.beachwidth = 0
+	if sl := r.shoreline(md); sl.dist != nil {
+		t.Errorf("expected no shoreline without beaches, got %v", sl.dist)
+	}
+}
+
+var beachRule_tests = []struct {
+	rule  Rule
+	dist  int16
+	slope int16
+	elev  int16
+	ok    bool
+	biome string
+}{
+	// too far from the sea
+	{NLCDRules.Default, 0, 0, 63, false, ""},
+	// too high
+	{NLCDRules.Default, 1, 0, 67, false, ""},
+	// water is never beach
+	{NLCDRules.Rule(11), 1, 0, 62, false, ""},
+	{NLCDRules.Default, 2, 1, 66, true, "Beach"},
+	{forestRule, 3, 2, 63, true, "Beach"},
+	{NLCDRules.Default, 1, 3, 63, true, "Stone Beach"},
+	{Rule{Biome: "Ice Plains", Surface: "Snow", Subsurface: "Dirt"}, 1, 0, 63, true, "Cold Beach"},
+}
+
+func Test_beachRule(t *testing.T) {
+	r := Region{sealevel: 62, beachwidth: 3, beachheight: 4, beachslope: 3}
+	for _, tt := range beachRule_tests {
+		sl := shoreline{dist: []int16{tt.dist}, slope: []int16{tt.slope}}
+		beach, ok := r.beachRule(tt.rule, sl, 0, tt.elev)
+		if ok != tt.ok {
+			t.Errorf("given %+v, expected ok %v, got %v", tt, tt.ok, ok)
+			continue
+		}
+		if ok && beach.Biome != tt.biome {
+			t.Errorf("given %+v, expected %s, got %s", tt, tt.biome, beach.Biome)
+		}
+		if ok {
+			if err := beach.validate(); err != nil {
+				t.Errorf("given %+v, got invalid rule: %s", tt, err)
+			}
+		}
+	}
+}
+
+func Test_beachConfig(t *testing.T) {
+	bounds := `"name": "BlockIsland", "bounds": {"north": 41.191, "south": 41.189, "east": -71.575, "west": -71.576}, "elevation": "elevation.tif", "landcover": "landcover.tif"`
+	rc, err := ReadRegionConfig(strings.NewReader(`{` + bounds + `}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *rc.BeachWidth != defaultBeachWidth || *rc.BeachHeight != defaultBeachHeight || rc.BeachSlope != defaultBeachSlope {
+		t.Errorf("expected default beaches, got %d %d %d", *rc.BeachWidth, *rc.BeachHeight, rc.BeachSlope)
+	}
+	rc, err = ReadRegionConfig(strings.NewReader(`{` + bounds + `, "beach_width": 0}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *rc.BeachWidth != 0 {
+		t.Errorf("expected beaches off, got width %d", *rc.BeachWidth)
+	}
+}
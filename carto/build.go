@@ -13,53 +13,158 @@ import (
 
 // JMT: convert to XZ, biome value, and list 0->n of points
 type Column struct {
-	xz      world.XZ
-	biome   int
-	blocks  []world.Block
-	okspawn bool
+	xz        world.XZ
+	biome     int
+	blocks    []world.Block
+	okspawn   bool
+	structure structure
 }
 
-func makeColumn(xz world.XZ, biome string, blocks []string, okspawn bool) Column {
+func makeColumn(xz world.XZ, biome string, blocks []string, okspawn bool) (Column, error) {
 	bval, ok := world.Biome[biome]
 	if !ok {
-		log.Panicf("%s not found in world.Biome", biome)
+		return Column{}, errorf("makeColumn", ErrInvalidParameter, "biome %q not found in world.Biome", biome)
 	}
 	bvals := make([]world.Block, len(blocks))
 	for i, v := range blocks {
 		bval, err := world.BlockNamed(v)
 		if err != nil {
-			panic(err)
+			return Column{}, wrap("makeColumn", ErrInvalidParameter, err)
 		}
 		bvals[i] = *bval
 	}
-	return Column{xz: xz, biome: bval, blocks: bvals, okspawn: okspawn}
+	return Column{xz: xz, biome: bval, blocks: bvals, okspawn: okspawn}, nil
 }
 
-func (r Region) genFeatures(in chan Feature) {
+// write sets the column's biome and blocks in the world.
+func (c Column) write(w *world.World) error {
+	if err := w.SetBiome(c.xz, byte(c.biome)); err != nil {
+		return err
+	}
+	pt := c.xz.Point(0)
+	for k, v := range c.blocks {
+		pt.Y = int32(k)
+		if err := w.SetBlock(pt, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mapData holds the bands of the map which columns are built from,
+// inside a window of columns or for the whole map.  It is read once and
+// shared by the workers.
+type mapData struct {
+	inx    int
+	iny    int
+	gti    [6]int32
+	bounds columnBounds
+	// the columns of the bands read, whose first pixel is at index 0
+	cols  columnBounds
+	arrs  map[int][]int16
+	slope []int16
+}
+
+// index returns the index in the bands of a column, and false if the
+// column is outside them.
+func (md *mapData) index(xz world.XZ) (int32, bool) {
+	if !md.cols.contains(xz) {
+		return 0, false
+	}
+	return (xz.X - md.cols.minX) + (xz.Z-md.cols.minZ)*int32(md.inx), true
+}
+
+// villageLand returns the elevation of a point, and false if a village
+// may not use it: a river or road runs through it, it is at the edge of
+// the map or a house would not fit beneath the top of the world.
+func (md *mapData) villageLand(pt XZIndex) (int16, bool) {
+	elev := md.arrs[Elevation][pt.index]
+	ok := md.arrs[River][pt.index] == 0 && md.arrs[Road][pt.index] == 0 && md.bounds.inside(pt.xz, 0) && int(elev)+villageHouseHeight < tileheight
+	return elev, ok
+}
+
+// readMap reads every band of the map inside the window, or all of it
+// if the window is nil.
+func (r Region) readMap(window *columnBounds) (*mapData, error) {
 	ds, err := gdal.Open(r.mapfile, gdal.ReadOnly)
 	if err != nil {
-		panic(err)
+		return nil, wrap("readMap", ErrMissingDataset, err)
 	}
+	defer ds.Close()
 	if Debug {
-		datasetInfo(ds, "genFeatures Input")
+		datasetInfo(ds, "readMap")
 	}
-	inx := ds.RasterXSize()
-	iny := ds.RasterYSize()
-	srs := gdal.CreateSpatialReference(ds.Projection())
-	bufferLen := inx * iny
+	bands := []int{}
+	for band := Landcover; band <= NumLayers; band++ {
+		bands = append(bands, band)
+	}
+	md, err := readBands(ds, window, bands)
+	if err != nil {
+		return nil, err
+	}
+	md.slope = slopes(md.arrs[Elevation], md.inx, md.iny)
+	return md, nil
+}
 
-	lcarr := make([]int16, bufferLen)
-	lcBand := ds.RasterBand(Landcover)
-	lcrerr := lcBand.IO(gdal.Read, 0, 0, inx, iny, lcarr, inx, iny, 0, 0)
-	if notnil(lcrerr) {
-		panic(lcrerr)
+// readBands reads some bands of the map inside the window, or all of it
+// if the window is nil.
+func readBands(ds gdal.Dataset, window *columnBounds, bands []int) (*mapData, error) {
+	md := &mapData{arrs: map[int][]int16{}}
+	for i, v := range ds.GeoTransform() {
+		md.gti[i] = int32(v)
+	}
+	md.bounds = mapBounds(md.gti, ds.RasterXSize(), ds.RasterYSize())
+	// each pixel is the column of its south edge
+	all := columnBounds{minX: md.bounds.minX, maxX: md.bounds.maxX, minZ: md.bounds.minZ + 1, maxZ: md.bounds.maxZ + 1}
+	md.cols = all
+	if window != nil {
+		md.cols = all.intersect(*window)
+	}
+	md.inx = int(md.cols.maxX - md.cols.minX)
+	md.iny = int(md.cols.maxZ - md.cols.minZ)
+	xoff, yoff := int(md.cols.minX-all.minX), int(md.cols.minZ-all.minZ)
+	for _, band := range bands {
+		arr := make([]int16, md.inx*md.iny)
+		if len(arr) > 0 {
+			if err := ds.RasterBand(band).IO(gdal.Read, xoff, yoff, md.inx, md.iny, arr, md.inx, md.iny, 0, 0); notnil(err) {
+				return nil, wrap("readBands", ErrGDAL, err)
+			}
+		}
+		md.arrs[band] = arr
 	}
+	return md, nil
+}
+
+// mapExtent returns the bounds of the map without reading any of it.
+func (r Region) mapExtent() (columnBounds, error) {
+	ds, err := gdal.Open(r.mapfile, gdal.ReadOnly)
+	if err != nil {
+		return columnBounds{}, wrap("mapExtent", ErrMissingDataset, err)
+	}
+	defer ds.Close()
+	md, err := readBands(ds, nil, nil)
+	if err != nil {
+		return columnBounds{}, err
+	}
+	return md.bounds, nil
+}
+
+// polygonize turns the landcover band into a layer of polygons, one for
+// each patch of a single landcover value.
+func (r Region) polygonize() (gdal.Layer, error) {
+	ds, err := gdal.Open(r.mapfile, gdal.ReadOnly)
+	if err != nil {
+		return gdal.Layer{}, wrap("polygonize", ErrMissingDataset, err)
+	}
+	defer ds.Close()
+	srs := gdal.CreateSpatialReference(ds.Projection())
+	lcBand := ds.RasterBand(Landcover)
 
 	// shapefile driver
 	outdrv := gdal.OGRDriverByName("Memory")
 	outDS, ok := outdrv.Create("out", nil)
 	if !ok {
-		panic(fmt.Errorf("OGR Driver Create Fail"))
+		return gdal.Layer{}, errorf("polygonize", ErrGDAL, "OGR Driver Create Fail")
 	}
 	outLayer := outDS.CreateLayer("polygons", srs, gdal.GT_Polygon, nil)
 
@@ -74,35 +179,80 @@ func (r Region) genFeatures(in chan Feature) {
 	// do it!
 	err = lcBand.Polygonize(lcBand, outLayer, field, options, gdal.DummyProgress, nil)
 	if notnil(err) {
-		panic(err)
+		return gdal.Layer{}, wrap("polygonize", ErrGDAL, err)
 	}
+	return outLayer, nil
+}
+
+// genFeatures sends each polygon of the layer to the workers until they
+// are done or quit is closed.
+func genFeatures(layer gdal.Layer, in chan Feature, quit chan struct{}) error {
+	defer close(in)
 
 	// iterate over features
-	fc, ok := outLayer.FeatureCount(true)
+	fc, ok := layer.FeatureCount(true)
 	if !ok {
-		panic(fmt.Errorf("outLayer.FeatureCount NOT OK"))
+		return errorf("genFeatures", ErrGDAL, "outLayer.FeatureCount NOT OK")
 	}
 	if Debug {
 		log.Print("outLayer.FeatureCount(true): ", fc)
 	}
-	outLayer.ResetReading()
+	layer.ResetReading()
 	for i := 0; i < fc; i++ {
-		in <- Feature{outLayer.NextFeature()}
+		select {
+		case in <- Feature{layer.NextFeature()}:
+		case <-quit:
+			return nil
+		}
 	}
-	close(in)
+	return nil
 }
 
 func (r *Region) BuildWorld() (*world.World, error) {
-	w := world.MakeWorld(r.name)
-	w.SetRandomSeed(0)
+	w := r.makeWorld()
+
+	md, err := r.readMap(nil)
+	if err != nil {
+		return nil, err
+	}
+	sl := r.shoreline(md)
+	layer, err := r.polygonize()
+	if err != nil {
+		return nil, err
+	}
+
+	spawnpt, err := r.buildWindow(&w, md, layer, nil, sl, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	w.SetSpawn(spawnpt)
+
+	return &w, nil
+}
+
+// buildWindow builds the columns inside the window, or the whole map if
+// it is nil, then digs beneath them, builds their structures and lights
+// the world.  Villages come from plans if it is not nil.  It returns
+// the highest point players may spawn on among the columns inside keep,
+// or anywhere if keep is nil.
+func (r *Region) buildWindow(w *world.World, md *mapData, layer gdal.Layer, plans map[int64]village, sl shoreline, window *columnBounds, keep *columnBounds) (world.Point, error) {
 	spawnpt := world.MakePoint(0, 0, 0)
 
 	in := make(chan Feature)
 	out := make(chan Column)
 
+	// the first failure closes quit, which stops the features
+	numWorkers := runtime.NumCPU()
+	errc := make(chan error, numWorkers+1)
+	quit := make(chan struct{})
+	var once sync.Once
+	fail := func(err error) {
+		errc <- err
+		once.Do(func() { close(quit) })
+	}
+
 	var wg sync.WaitGroup
 
-	numWorkers := runtime.NumCPU()
 	// if Debug {
 	// 	log.Print("debug mode - only starting one worker")
 	// 	numWorkers = 1
@@ -114,332 +264,227 @@ func (r *Region) BuildWorld() (*world.World, error) {
 		wg.Add(1)
 		go func(i int) {
 			defer wg.Done()
-			r.processFeatures(in, out, i)
+			if err := r.processFeatures(w, md, window, plans, in, out, quit, sl, i); err != nil {
+				fail(err)
+			}
 		}(i)
 	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := genFeatures(layer, in, quit); err != nil {
+			fail(err)
+		}
+	}()
 	go func() { wg.Wait(); close(out) }()
-	go r.genFeatures(in)
 
+	// structures reach into neighboring columns, so they wait until
+	// every column is in place
+	type placement struct {
+		base world.Point
+		s    structure
+	}
+	placements := []placement{}
+
+	// the height of each column, for digging underground
+	columns := map[world.XZ]int32{}
+
+	// the workers have already written each column into the world
 	columncount := 0
 	for column := range out {
 		columncount++
 
-		w.SetBiome(column.xz, byte(column.biome))
+		columns[column.xz] = int32(len(column.blocks))
+		pt := column.xz.Point(int32(max(len(column.blocks)-1, 0)))
 
-		pt := column.xz.Point(int32(0))
-		for k, v := range column.blocks {
-			pt.Y = int32(k)
-			w.SetBlock(pt, v)
-		}
-
-		if column.okspawn && pt.Y > spawnpt.Y {
+		if column.okspawn && pt.Y > spawnpt.Y && (keep == nil || keep.contains(column.xz)) {
 			if Debug {
 				log.Printf("new spawn: %s", pt)
 			}
 			spawnpt = pt
 		}
 
-		// JMT: naive lighting here
-		w.SetSkyLight(pt, 15)
+		if column.structure != nil {
+			placements = append(placements, placement{base: column.xz.Point(int32(len(column.blocks))), s: column.structure})
+		}
 	}
 
-	w.SetSpawn(spawnpt)
-
-	return &w, nil
-}
-
-var ArrindDebug = false
-
-func arrind(x int32, y int32, inx int32, iny int32, gti [6]int32) (int32, error) {
-	realx := (x - gti[0]) / gti[1]
-	if realx < 0 {
-		return 0, fmt.Errorf("realx %d < 0", realx)
-	}
-	if realx > inx {
-		return 0, fmt.Errorf("realx %d > inx %d", realx, inx)
-	}
-	realy := (y-gti[3])/gti[5] - 1
-	if realy < 0 {
-		return 0, fmt.Errorf("realx %d < 0", realx)
+	select {
+	case err := <-errc:
+		return spawnpt, err
+	default:
 	}
-	if realy > iny {
-		return 0, fmt.Errorf("realy %d > iny %d", realy, iny)
-	}
-	return realx + realy*inx, nil
-}
 
-func (r *Region) processFeatures(in chan Feature, out chan Column, i int) {
-	ds, err := gdal.Open(r.mapfile, gdal.ReadOnly)
-	if err != nil {
-		panic(err)
-	}
-	if Debug && i == 0 {
-		datasetInfo(ds, "processFeatures")
+	if err := underground(w, columns); err != nil {
+		return spawnpt, err
 	}
-	inx := ds.RasterXSize()
-	iny := ds.RasterYSize()
-	bufferLen := inx * iny
 
-	lcarr := make([]int16, bufferLen)
-	lcBand := ds.RasterBand(Landcover)
-	lcrerr := lcBand.IO(gdal.Read, 0, 0, inx, iny, lcarr, inx, iny, 0, 0)
-	if notnil(lcrerr) {
-		panic(lcrerr)
+	for _, p := range placements {
+		if err := p.s.build(w, p.base); err != nil {
+			return spawnpt, err
+		}
 	}
 
-	elevarr := make([]int16, bufferLen)
-	elevBand := ds.RasterBand(Elevation)
-	elevrerr := elevBand.IO(gdal.Read, 0, 0, inx, iny, elevarr, inx, iny, 0, 0)
-	if notnil(elevrerr) {
-		panic(elevrerr)
-	}
+	// light the world once every block is in place
+	w.Light()
 
-	bathyarr := make([]int16, bufferLen)
-	bathyBand := ds.RasterBand(Bathy)
-	bathyrerr := bathyBand.IO(gdal.Read, 0, 0, inx, iny, bathyarr, inx, iny, 0, 0)
-	if notnil(bathyrerr) {
-		panic(bathyrerr)
-	}
+	return spawnpt, nil
+}
 
-	crustarr := make([]int16, bufferLen)
-	crustBand := ds.RasterBand(Crust)
-	crustrerr := crustBand.IO(gdal.Read, 0, 0, inx, iny, crustarr, inx, iny, 0, 0)
-	if notnil(crustrerr) {
-		panic(crustrerr)
-	}
+// processFeatures turns the features it receives into columns, writes
+// them into the world and sends them on.  Only columns inside the
+// window are built, or all of them if it is nil.  Villages come from
+// plans, keyed by feature, or are planned here if it is nil.  After
+// quit is closed the remaining features are skipped.
+func (r *Region) processFeatures(w *world.World, md *mapData, window *columnBounds, plans map[int64]village, in chan Feature, out chan Column, quit chan struct{}, sl shoreline, i int) error {
+	elevarr, bathyarr, crustarr := md.arrs[Elevation], md.arrs[Bathy], md.arrs[Crust]
+	riverarr, roadarr, temparr := md.arrs[River], md.arrs[Road], md.arrs[Temperature]
+	canopyarr, imperviousarr := md.arrs[Canopy], md.arrs[Impervious]
+	slopearr, bounds := md.slope, md.bounds
 
 	processed := 0
 
-	// first pass at memoize
-	// memo := make(map[string]Column)
-
 	for f := range in {
+		select {
+		case <-quit:
+			continue
+		default:
+		}
 		processed++
 
 		head := fmt.Sprintf("%d: feature #%d", i, processed)
 
+		if window != nil && !window.overlaps(f.Geometry().Envelope(), md.gti) {
+			continue
+		}
+		rule := r.rules.Rule(f.LCValue())
+
 		// if Debug {
 		// 	log.Printf("%s begins", head)
 		// }
-		pts := f.Points(ds, head)
+		pts := f.Points(md, window)
 		if len(pts) == 0 {
 			log.Printf("%s: No points in geometry!", head)
 			log.Print("SCRATCH ONE FEATURE")
 			continue
 		}
 
-		lc := f.LCValue()
-		switch lc {
-		case 11:
-			// "open water"
-			for _, pt := range pts {
-				elev := elevarr[pt.index]
-				bathy := bathyarr[pt.index]
-				crust := crustarr[pt.index]
-
-				// key := fmt.Sprintf("%d|%d|%d|%d", lc, elev, bathy, crust)
-
-				var biome string
-				if int(bathy) >= r.maxdepth-1 {
-					biome = "Deep Ocean"
-				} else {
-					biome = "Ocean"
-				}
-
-				// if col, ok := memo[key]; ok {
-				// 	col.xz = pt.xz
-				// 	out <- col
-				// 	continue
-				// }
-				blocks := make([]string, elev)
-				for y := int16(0); y < elev; y++ {
-					if y == 0 {
-						blocks[y] = "Bedrock"
-					} else if y < (elev - bathy - crust) {
-						blocks[y] = "Stone"
-					} else if y < (elev - bathy) {
-						blocks[y] = "Gravel"
-					} else {
-						blocks[y] = "Water"
-					}
-				}
-				// water makes a bad spawn point
-				col := makeColumn(pt.xz, biome, blocks, false)
-				// memo[key] = col
-				out <- col
+		var fld field
+		if len(rule.Crops) > 0 {
+			fld = r.field(rule, f)
+		}
+		// villages take the place of buildings on the features with room
+		var vil village
+		hasVillage := false
+		if rule.Village && plans != nil {
+			if vil, hasVillage = plans[f.FID()]; hasVillage {
+				rule.Buildings = 0
 			}
-		case 31:
-			// "barren land"
+		} else if rule.Village && len(pts) >= minVillageColumns {
+			land := make(map[world.XZ]int16, len(pts))
 			for _, pt := range pts {
-				elev := elevarr[pt.index]
-				// bathy := bathyarr[pt.index]
-				crust := crustarr[pt.index]
-
-				// key := fmt.Sprintf("%d|%d|%d|%d", lc, elev, bathy, crust)
-
-				var biome string
-				if elev > 92 {
-					biome = "Desert Hills"
-				} else {
-					biome = "Desert"
+				if elev, ok := md.villageLand(pt); ok {
+					land[pt.xz] = elev
 				}
-
-				// if col, ok := memo[key]; ok {
-				// 	col.xz = pt.xz
-				// 	out <- col
-				// 	continue
-				// }
-				blocks := make([]string, elev)
-				for y := int16(0); y < elev; y++ {
-					if y == 0 {
-						blocks[y] = "Bedrock"
-					} else if y < (elev - crust - 1) {
-						blocks[y] = "Stone"
-					} else if y < elev-1 {
-						blocks[y] = "Sandstone"
-					} else {
-						blocks[y] = "Sand"
-					}
-				}
-				col := makeColumn(pt.xz, biome, blocks, true)
-				// memo[key] = col
-				out <- col
 			}
-		case 41:
-			fallthrough
-		case 42:
-			fallthrough
-		case 43:
-			// "forest"
-			for _, pt := range pts {
-				elev := elevarr[pt.index]
-				// bathy := bathyarr[pt.index]
-				crust := crustarr[pt.index]
-
-				// key := fmt.Sprintf("%d|%d|%d|%d", lc, elev, bathy, crust)
-
-				var biome string
-				if elev > 92 {
-					biome = "Forest Hills"
-				} else {
-					biome = "Forest"
-				}
-
-				// if col, ok := memo[key]; ok {
-				// 	col.xz = pt.xz
-				// 	out <- col
-				// 	continue
-				// }
-				blocks := make([]string, elev)
-				for y := int16(0); y < elev; y++ {
-					if y == 0 {
-						blocks[y] = "Bedrock"
-					} else if y < (elev - crust - 1) {
-						blocks[y] = "Stone"
-					} else if y < elev-1 {
-						blocks[y] = "Dirt"
-					} else {
-						blocks[y] = "Grass Block"
-					}
-				}
-				// here's where we add the occasional tree sapling
-				// if we place one, set okspawn to false
-				okspawn := true
-				col := makeColumn(pt.xz, biome, blocks, okspawn)
-				// memo[key] = col
-				out <- col
+			if vil, hasVillage = planVillage(r.seed, land); hasVillage {
+				rule.Buildings = 0
 			}
-		case 90:
-			fallthrough
-		case 95:
-			// "swampland"
-			for _, pt := range pts {
-				elev := elevarr[pt.index]
-				// bathy := bathyarr[pt.index]
-				crust := crustarr[pt.index]
-
-				// key := fmt.Sprintf("%d|%d|%d|%d", lc, elev, bathy, crust)
-
-				var biome string
-				if elev > 92 {
-					biome = "Swampland M"
-				} else {
-					biome = "Swampland"
-				}
-
-				// if col, ok := memo[key]; ok {
-				// 	col.xz = pt.xz
-				// 	out <- col
-				// 	continue
-				// }
-				blocks := make([]string, elev)
-				for y := int16(0); y < elev; y++ {
-					if y == 0 {
-						blocks[y] = "Bedrock"
-					} else if y < (elev - crust - 1) {
-						blocks[y] = "Stone"
-					} else if y < elev-1 {
-						blocks[y] = "Dirt"
-					} else {
-						blocks[y] = "Grass Block"
-					}
-				}
-				// here's where we add the occasional tree sapling
-				// if we place one, set okspawn to false
-				okspawn := true
-				col := makeColumn(pt.xz, biome, blocks, okspawn)
-				// memo[key] = col
-				out <- col
+		}
+		coldRule := rule.cold()
+		for _, pt := range pts {
+			if window != nil && !window.contains(pt.xz) {
+				continue
 			}
-		default:
-			// anything else
-			for _, pt := range pts {
-				elev := elevarr[pt.index]
-				// bathy := bathyarr[pt.index]
-				crust := crustarr[pt.index]
-
-				// key := fmt.Sprintf("%d|%d|%d|%d", lc, elev, bathy, crust)
-
-				var biome string
-				if elev > 152 {
-					// Hills+ too
-					biome = "Extreme Hills M"
-				} else if elev > 122 {
-					// Hills+ too
-					biome = "Extreme Hills"
-				} else if elev > 92 {
-					biome = "Extreme Hills Edge"
+			index, ok := md.index(pt.xz)
+			if !ok {
+				continue
+			}
+			temp := temparr[index]
+			rule := rule
+			if r.cold(temp) {
+				rule = coldRule
+			}
+			elev := elevarr[index]
+			bathy := bathyarr[index]
+			rule, crust := rule.soil(crustarr[index], slopearr[index])
+			river := riverarr[index]
+			wc := wayClass(roadarr[index])
+			ew := wc == railway && railEastWest(roadarr, int(index), md.inx, md.iny)
+			var column Column
+			var err error
+			switch {
+			// rivers are carved into land, open water already is water
+			case river > 0 && !rule.Water:
+				column, err = rule.riverColumn(pt.xz, elev, river, crust)
+			case rule.Water:
+				column, err = rule.column(pt.xz, elev, bathy, crust, r.maxdepth)
+			case wc != noWay:
+				column, err = wc.column(rule, pt.xz, elev, bathy, crust, r.maxdepth, ew)
+			case hasVillage && vil.part(pt.xz) != villageNone:
+				column, err = vil.column(rule, pt.xz, elev, bathy, crust, r.maxdepth)
+			default:
+				if beach, ok := r.beachRule(rule, sl, index, elev); ok {
+					column, err = beach.column(pt.xz, elev, bathy, crust, r.maxdepth)
 				} else {
-					// Sunflower Plains?
-					biome = "Plains"
+					column, err = r.landColumn(rule, fld, pt.xz, elev, bathy, crust, canopyarr[index], imperviousarr[index], bounds)
 				}
-
-				// if col, ok := memo[key]; ok {
-				// 	col.xz = pt.xz
-				// 	out <- col
-				// 	continue
-				// }
-				blocks := make([]string, elev)
-				for y := int16(0); y < elev; y++ {
-					if y == 0 {
-						blocks[y] = "Bedrock"
-					} else if y < (elev - crust - 1) {
-						blocks[y] = "Stone"
-					} else if y < elev-1 {
-						blocks[y] = "Dirt"
-					} else {
-						blocks[y] = "Grass Block"
-					}
+			}
+			if err != nil {
+				return err
+			}
+			// ways cross water on bridges
+			if wc != noWay && (rule.Water || river > 0) {
+				if column, err = wc.bridge(column, ew); err != nil {
+					return err
 				}
-				// set okspawn to false if top block is not "ground"
-				// (i.e., if we put grass here)
-				okspawn := true
-				col := makeColumn(pt.xz, biome, blocks, okspawn)
-				// memo[key] = col
-				out <- col
 			}
+			if column, err = r.weather(r.strata(column), temp); err != nil {
+				return err
+			}
+			if err := column.write(w); err != nil {
+				return err
+			}
+			out <- column
 		}
 	}
+	return nil
+}
+
+// landColumn builds the column for one point of land away from rivers
+// and beaches.  Land is paved as often as it is impervious and farmed if
+// the rule has crops, and buildings stand on any of it.  Trees and
+// plants only grow on land which is neither paved nor farmed.
+func (r Region) landColumn(rule Rule, fld field, xz world.XZ, elev int16, bathy int16, crust int16, canopy int16, impervious int16, bounds columnBounds) (Column, error) {
+	var column Column
+	var err error
+	isPaved := paved(r.seed, xz, rule.imperviousness(impervious))
+	switch {
+	case isPaved:
+		column, err = rule.pave().column(xz, elev, bathy, crust, r.maxdepth)
+	case len(rule.Crops) > 0:
+		column, err = rule.cropColumn(xz, elev, crust, r.maxdepth, fld)
+	default:
+		column, err = rule.column(xz, elev, bathy, crust, r.maxdepth)
+	}
+	if err != nil {
+		return Column{}, err
+	}
+
+	if b, ok := rule.building(r.seed, xz); ok && bounds.inside(xz, maxBuildingSide) && int(elev)+int(b.height) < tileheight {
+		column.structure = b
+		column.okspawn = false
+		return column, nil
+	}
+	if isPaved || len(rule.Crops) > 0 {
+		return column, nil
+	}
+	if t, ok := rule.tree(r.seed, xz, canopy); ok && bounds.inside(xz, treeRadius) && int(elev)+int(t.height) < tileheight {
+		column.structure = t
+		column.okspawn = false
+		return column, nil
+	}
+	return rule.plant(r.seed, column)
 }
 
 type Feature struct {
@@ -452,105 +497,42 @@ func (f Feature) LCValue() int {
 	return f.FieldAsInteger(0)
 }
 
-// generates list of points and sends them to a channel
-func (f Feature) genPoints(in chan world.XZ, gti [6]int32) {
-	g := f.Geometry()
-	e := g.Envelope()
-	eminx := int32(e.MinX())
-	eminy := int32(e.MinY())
-	emaxx := int32(e.MaxX())
-	emaxy := int32(e.MaxY())
-
-	for y := eminy; y < emaxy; y -= gti[5] {
-		for x := eminx; x < emaxx; x += gti[1] {
-			in <- world.XZ{X: x, Z: y}
-		}
-	}
-	close(in)
-}
-
 type XZIndex struct {
 	xz    world.XZ
 	index int32
 }
 
-func makeXZIndex(xz world.XZ, index int32, gti [6]int32) XZIndex {
-	return XZIndex{xz: world.XZ{X: xz.X / gti[1], Z: xz.Z / gti[5]}, index: index}
-}
-
-func (f Feature) Points(ds gdal.Dataset, head string) []XZIndex {
-	inx := ds.RasterXSize()
-	iny := ds.RasterYSize()
-	gt := ds.GeoTransform()
-	srs := gdal.CreateSpatialReference(ds.Projection())
-
-	lcarr := make([]int16, inx*iny)
-	lcBand := ds.RasterBand(Landcover)
-	lcrerr := lcBand.IO(gdal.Read, 0, 0, inx, iny, lcarr, inx, iny, 0, 0)
-	if notnil(lcrerr) {
-		panic(lcrerr)
+// Points returns the columns of the feature which have its landcover,
+// with their indexes in the map data.  The feature is clipped to the
+// window, or to the map data if the window is nil, and then filled a
+// row at a time as burn does.
+func (f Feature) Points(md *mapData, window *columnBounds) []XZIndex {
+	g := f.Geometry()
+	cols := md.cols.intersect(envelopeBounds(g.Envelope(), md.gti))
+	if window != nil {
+		cols = cols.intersect(*window)
 	}
-
-	var gti [6]int32
-	for i, v := range gt {
-		gti[i] = int32(v)
+	inx, iny := int(cols.maxX-cols.minX), int(cols.maxZ-cols.minZ)
+	if inx <= 0 || iny <= 0 {
+		return nil
 	}
 
-	in := make(chan world.XZ)
-	out := make(chan XZIndex)
-
-	var wg sync.WaitGroup
-
-	numWorkers := runtime.NumCPU()
-
-	for i := 0; i < numWorkers; i++ {
-		wg.Add(1)
-		go func(i int) {
-			defer wg.Done()
-			ppHead := fmt.Sprintf("%s %d", head, i)
-			f.processPoints(in, out, inx, iny, gti, srs, lcarr, ppHead)
-		}(i)
-	}
-	go func() { wg.Wait(); close(out) }()
-	go f.genPoints(in, gti)
+	// the first row is the column whose south edge is minZ
+	gt := [6]float64{float64(cols.minX * md.gti[1]), float64(md.gti[1]), 0, float64((cols.minZ - 1) * md.gti[5]), 0, float64(md.gti[5])}
+	mask := make([]int16, inx*iny)
+	fill(mask, rings(g, nil), 1, inx, iny, gt)
 
+	lc := int16(f.LCValue())
+	lcarr := md.arrs[Landcover]
 	pts := []XZIndex{}
-	ptcount := 0
-	for pt := range out {
-		if Debug {
-			if ptcount > 1 && ptcount%10000 == 0 {
-				log.Printf("%s: %d columns", head, ptcount)
-			}
-		}
-		ptcount++
-		pts = append(pts, pt)
-	}
-	return pts
-}
-
-func (f Feature) processPoints(in chan world.XZ, out chan XZIndex, inx int, iny int, gti [6]int32, srs gdal.SpatialReference, lcarr []int16, ppHead string) {
-	g := f.Geometry()
-
-	lc := f.LCValue()
-
-	for xz := range in {
-		index, aerr := arrind(xz.X, xz.Z, int32(inx), int32(iny), gti)
-		// JMT: arrind returns nil if coordinates are invalid
-		if aerr != nil {
-			log.Printf("%s: aerr was not nil: %s", ppHead, aerr.Error())
+	for i, v := range mask {
+		if v == 0 {
 			continue
 		}
-		if lcarr[index] != int16(lc) {
-			continue
-		}
-		wkt := fmt.Sprintf("POINT (%f %f)", float64(xz.X)+0.5*float64(gti[1]), float64(xz.Z)-0.5*float64(gti[5]))
-		pt, err := gdal.CreateFromWKT(wkt, srs)
-		if notnil(err) {
-			log.Printf("%s: gdal.CreateFromWKT() error: %s", ppHead, err.Error())
-			continue
-		}
-		if g.Contains(pt) {
-			out <- makeXZIndex(xz, index, gti)
+		xz := world.XZ{X: cols.minX + int32(i%inx), Z: cols.minZ + int32(i/inx)}
+		if index, ok := md.index(xz); ok && lcarr[index] == lc {
+			pts = append(pts, XZIndex{xz: xz, index: index})
 		}
 	}
+	return pts
 }
@@ -1,6 +1,7 @@
 package carto
 
 import (
+	"errors"
 	"io/ioutil"
 	"os"
 	"testing"
@@ -8,6 +9,74 @@ import (
 	"github.com/mathuin/terroir/world"
 )
 
+// columnOf returns a function which fails the test if a column could
+// not be built.
+func columnOf(t *testing.T) func(Column, error) Column {
+	return func(c Column, err error) Column {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+}
+
+var makeColumn_tests = []struct {
+	biome  string
+	blocks []string
+	ok     bool
+}{
+	{"Plains", []string{"Bedrock", "Stone", "Grass Block"}, true},
+	{"Atlantis", []string{"Bedrock", "Stone"}, false},
+	{"Plains", []string{"Bedrock", "Unobtainium"}, false},
+}
+
+func Test_makeColumn(t *testing.T) {
+	for _, tt := range makeColumn_tests {
+		c, err := makeColumn(world.XZ{}, tt.biome, tt.blocks, false)
+		if tt.ok {
+			if err != nil || len(c.blocks) != len(tt.blocks) {
+				t.Errorf("given %v, expected %d blocks, got %d (%v)", tt, len(tt.blocks), len(c.blocks), err)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrInvalidParameter) {
+			t.Errorf("given %v, expected ErrInvalidParameter, got %v", tt, err)
+		}
+	}
+	if _, err := plainsRule.column(world.XZ{}, 64, 0, 3, 30); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (Column{}).withPlant("Unobtainium"); !errors.Is(err, ErrInvalidParameter) {
+		t.Errorf("expected ErrInvalidParameter for an unknown plant, got %v", err)
+	}
+}
+
+var mapDataIndex_tests = []struct {
+	xz    world.XZ
+	index int32
+	ok    bool
+}{
+	{world.XZ{X: 100, Z: -50}, 0, true},
+	{world.XZ{X: 103, Z: -50}, 3, true},
+	{world.XZ{X: 101, Z: -48}, 9, true},
+	{world.XZ{X: 103, Z: -48}, 11, true},
+	{world.XZ{X: 99, Z: -50}, 0, false},
+	{world.XZ{X: 104, Z: -50}, 0, false},
+	{world.XZ{X: 100, Z: -47}, 0, false},
+}
+
+func Test_mapDataIndex(t *testing.T) {
+	// a window of four by three columns
+	md := &mapData{inx: 4, iny: 3, cols: columnBounds{minX: 100, maxX: 104, minZ: -50, maxZ: -47}}
+	for _, tt := range mapDataIndex_tests {
+		index, ok := md.index(tt.xz)
+		if ok != tt.ok || index != tt.index {
+			t.Errorf("given %v, expected %d %v, got %d %v", tt.xz, tt.index, tt.ok, index, ok)
+		}
+	}
+}
+
 var buildWorld_tests = []struct {
 	name   string
 	ll     FloatExtents
@@ -25,11 +94,16 @@ func Test_BuildWorld(t *testing.T) {
 	defer os.RemoveAll(td)
 
 	for _, tt := range buildWorld_tests {
-		r := MakeRegion(tt.name, tt.ll, tt.elname, tt.lcname)
-		r.BuildMap()
+		r, err := MakeRegion(tt.name, tt.ll, tt.elname, tt.lcname)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := r.BuildMap(); err != nil {
+			t.Fatal(err)
+		}
 		w, err := r.BuildWorld()
 		if err != nil {
-			t.Fail()
+			t.Fatal(err)
 		}
 
 		w.SetSaveDir(td)
@@ -6,13 +6,13 @@ import (
 	"log"
 	"math"
 	"os"
-	"os/exec"
 	"path"
 	"sort"
 	"strings"
 
 	"github.com/mathuin/gdal"
 	"github.com/mathuin/terroir/idt"
+	"github.com/mathuin/terroir/world"
 )
 
 var Debug = false
@@ -25,6 +25,11 @@ const (
 	Elevation
 	Bathy
 	Crust
+	River
+	Canopy
+	Impervious
+	Road
+	Temperature
 	NumLayers = iota - 1
 )
 
@@ -54,14 +59,54 @@ type Region struct {
 	trim     int
 	sealevel int
 	maxdepth int
-	albers   map[string]IntExtents
-	wgs84    map[string]FloatExtents
-	vrts     map[string]string
+
+	// map projection and extents in it
+	proj      string
+	projected map[string]IntExtents
+	wgs84     map[string]FloatExtents
+	vrts      map[string]string
+
+	// how elevation is resampled onto the map, and its nodata value
+	resample string
+	nodata   float64
+
+	// vertical scale of the optional bathymetry dataset, zero for vscale
+	bathyvscale int
+
+	// width in meters of river lines and depth in blocks of channels
+	riverwidth float64
+	riverdepth int
+
+	// shoreline width and height in blocks, and the slope of stone beaches
+	beachwidth  int
+	beachheight int
+	beachslope  int
+
+	// which way crop rows run
+	rows string
+
+	// lapse rate in degrees per kilometer, and the latitudes whose sea
+	// level temperatures bring snow and ice
+	lapserate    float64
+	snowlatitude float64
+	icelatitude  float64
+
+	// seed for the world and for every random choice made building it
+	seed int64
+
+	// how chunks are compressed in region files, zero for the world's
+	// default
+	compression      world.Compression
+	compressionLevel int
+
+	// how landcover values are read and become columns
+	scheme Scheme
+	rules  RuleTable
 
 	mapfile string
 }
 
-func MakeRegion(name string, ll FloatExtents, elname string, lcname string) Region {
+func MakeRegion(name string, ll FloatExtents, elname string, lcname string) (Region, error) {
 	scale := 6
 	vscale := 6
 	trim := 0
@@ -72,55 +117,169 @@ func MakeRegion(name string, ll FloatExtents, elname string, lcname string) Regi
 }
 
 // JMT: leading dot is bad
-var datasetDir = "./datasets"
-var mapsDir = "./maps"
+// DatasetDir holds one directory of source data per region.
+var DatasetDir = "./datasets"
+
+// MapsDir is where the generated map GeoTIFFs are written.
+var MapsDir = "./maps"
+
+func MakeRegionFull(name string, ll FloatExtents, elname string, lcname string, scale int, vscale int, trim int, tilesize int, sealevel int, maxdepth int) (Region, error) {
+	params := []struct {
+		name  string
+		value int
+		min   int
+	}{
+		{"scale", scale, 1},
+		{"vscale", vscale, 1},
+		{"trim", trim, 0},
+		{"tilesize", tilesize, 1},
+		{"sealevel", sealevel, 1},
+		{"maxdepth", maxdepth, 1},
+	}
+	for _, p := range params {
+		if p.value < p.min {
+			return Region{}, errorf("MakeRegion", ErrInvalidParameter, "%s %d must be at least %d", p.name, p.value, p.min)
+		}
+	}
 
-func MakeRegionFull(name string, ll FloatExtents, elname string, lcname string, scale int, vscale int, trim int, tilesize int, sealevel int, maxdepth int) Region {
 	vrts := map[string]string{}
-	albers := map[string]IntExtents{}
+	projected := map[string]IntExtents{}
 	wgs84 := map[string]FloatExtents{}
 	for _, key := range keys {
-		albers[key] = IntExtents{}
+		projected[key] = IntExtents{}
 		wgs84[key] = FloatExtents{}
 	}
-	vrts["elevation"] = path.Join(datasetDir, name, elname)
-	vrts["landcover"] = path.Join(datasetDir, name, lcname)
-	mapfile := path.Join(mapsDir, fmt.Sprintf("%s.tif", name))
+	vrts["elevation"] = path.Join(DatasetDir, name, elname)
+	vrts["landcover"] = path.Join(DatasetDir, name, lcname)
+	mapfile := path.Join(MapsDir, fmt.Sprintf("%s.tif", name))
 
-	r := Region{name: name, ll: ll, tilesize: tilesize, scale: scale, vscale: vscale, trim: trim, sealevel: sealevel, maxdepth: maxdepth, vrts: vrts, albers: albers, wgs84: wgs84, mapfile: mapfile}
-	r.generateExtents()
-	return r
+	r := Region{name: name, ll: ll, tilesize: tilesize, scale: scale, vscale: vscale, trim: trim, sealevel: sealevel, maxdepth: maxdepth, vrts: vrts, proj: albers_proj, projected: projected, wgs84: wgs84, resample: "cubic", riverwidth: defaultRiverWidth, riverdepth: defaultRiverDepth, beachwidth: defaultBeachWidth, beachheight: defaultBeachHeight, beachslope: defaultBeachSlope, rows: RowsAuto, lapserate: defaultLapseRate, snowlatitude: defaultSnowLatitude, icelatitude: defaultIceLatitude, scheme: NLCD, rules: NLCD.Rules, mapfile: mapfile}
+	if err := r.generateExtents(); err != nil {
+		return r, err
+	}
+	return r, nil
 }
 
-func (r Region) BuildMap() {
-	td, nerr := ioutil.TempDir("", r.name)
-	if nerr != nil {
-		panic(nerr)
+// SetProjection sets the map projection and recalculates the extents.
+// The projection may be "albers", "utm", "lambert", or anything GDAL
+// accepts as a spatial reference.
+func (r *Region) SetProjection(spec string) error {
+	proj, err := projection(spec, r.ll)
+	if err != nil {
+		return err
 	}
-	defer os.RemoveAll(td)
-	elfile := path.Join(td, "elevation.tif")
+	r.proj = proj
+	return r.generateExtents()
+}
+
+// SetResample sets the method used to resample elevation onto the map:
+// "cubic" (the default), "bilinear", "average", or any other GDAL
+// resampling method.
+func (r *Region) SetResample(name string) error {
+	if _, err := resampleAlg(name); err != nil {
+		return err
+	}
+	r.resample = name
+	return nil
+}
+
+// SetNodata sets the elevation used where the elevation dataset has no
+// data.  It defaults to 0.
+func (r *Region) SetNodata(nodata float64) {
+	r.nodata = nodata
+}
+
+// SetBathymetry adds a bathymetry dataset, whose elevations below sea
+// level replace the depths guessed from landcover.  Its vertical scale
+// is in meters per block, and zero means the same scale as elevation.
+func (r *Region) SetBathymetry(name string, vscale int) error {
+	if vscale < 0 {
+		return errorf("SetBathymetry", ErrInvalidParameter, "bathymetry vscale %d must be at least 0", vscale)
+	}
+	r.vrts["bathymetry"] = ""
+	if name != "" {
+		r.vrts["bathymetry"] = path.Join(DatasetDir, r.name, name)
+	}
+	r.bathyvscale = vscale
+	return nil
+}
+
+func (r Region) bathyVScale() int {
+	if r.bathyvscale == 0 {
+		return r.vscale
+	}
+	return r.bathyvscale
+}
 
-	elExtents := r.albers["elevation"]
+// SetSeed sets the world seed, which also decides where trees grow.
+func (r *Region) SetSeed(seed int64) {
+	r.seed = seed
+}
 
-	path, err := exec.LookPath("gdalwarp")
+// SetCompression sets how chunks are compressed in the region files:
+// "gzip", "zlib" (the default) or "none", and the level for gzip and
+// zlib from -2 (Huffman only) to 9 (best), with -1 the default.
+func (r *Region) SetCompression(name string, level int) error {
+	c, err := world.CompressionNamed(name)
 	if err != nil {
-		panic(err)
+		return wrap("SetCompression", ErrInvalidParameter, err)
+	}
+	if err := c.Validate(level); err != nil {
+		return wrap("SetCompression", ErrInvalidParameter, err)
+	}
+	r.compression = c
+	r.compressionLevel = level
+	return nil
+}
+
+// makeWorld makes an empty world with the region's name, seed and
+// compression.
+func (r Region) makeWorld() world.World {
+	w := world.MakeWorld(r.name)
+	w.SetRandomSeed(r.seed)
+	if r.compression != 0 {
+		// checked by SetCompression
+		w.SetCompression(r.compression, r.compressionLevel)
+	}
+	return w
+}
+
+// SetScheme sets the landcover scheme, replacing the rule table with
+// the scheme's own.
+func (r *Region) SetScheme(s Scheme) {
+	r.scheme = s
+	r.rules = s.Rules
+}
+
+// SetRules replaces the landcover rule table.
+func (r *Region) SetRules(t RuleTable) error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+	r.rules = t.sortedBands()
+	return nil
+}
+
+// BuildMap builds the map GeoTIFF from the region's datasets.
+func (r Region) BuildMap() error {
+	td, nerr := ioutil.TempDir("", r.name)
+	if nerr != nil {
+		return nerr
 	}
+	defer os.RemoveAll(td)
+	elfile := path.Join(td, "elevation.tif")
 
-	warpcmd := exec.Command(path, `-q`, `-multi`, `-t_srs`, albers_proj, `-tr`, fmt.Sprintf("%d", r.scale), fmt.Sprintf("%d", r.scale), `-te`, fmt.Sprintf("%d", elExtents[xMin]), fmt.Sprintf("%d", elExtents[yMin]), fmt.Sprintf("%d", elExtents[xMax]), fmt.Sprintf("%d", elExtents[yMax]), `-r`, `cubic`, `-srcnodata`, `"-340282346638529993179660072199368212480.000"`, `-dstnodata`, `0`, fmt.Sprintf(`%s`, r.vrts["elevation"]), fmt.Sprintf(`%s`, elfile))
+	elExtents := r.projected["elevation"]
 
-	// run the command
-	out, nerr := warpcmd.CombinedOutput()
-	if notnil(nerr) {
-		log.Print(string(out))
-		panic(nerr)
+	werr := r.warp(r.vrts["elevation"], elfile, elExtents, r.resample, r.nodata, gdal.Unknown)
+	if werr != nil {
+		return werr
 	}
-	_ = out
 
 	// open elds
 	elDS, err := gdal.Open(elfile, gdal.ReadOnly)
 	if err != nil {
-		panic(err)
+		return wrap("BuildMap", ErrMissingDataset, err)
 	}
 	defer elDS.Close()
 	if Debug {
@@ -143,7 +302,7 @@ func (r Region) BuildMap() {
 	elBuffer := make([]float32, bufferLen)
 	elrerr := elBand.IO(gdal.Read, 0, 0, rXsize, rYsize, elBuffer, rXsize, rYsize, 0, 0)
 	if notnil(elrerr) {
-		panic(elrerr)
+		return wrap("BuildMap", ErrGDAL, elrerr)
 	}
 
 	// get elmin and elmax
@@ -197,10 +356,10 @@ func (r Region) BuildMap() {
 		log.Print("vscale: ", r.vscale)
 	}
 
-	// build a four-layer GeoTIFF
+	// build a GeoTIFF with one band per layer
 	driver, derr := gdal.GetDriverByName("GTiff")
 	if derr != nil {
-		panic(err)
+		return wrap("BuildMap", ErrGDAL, derr)
 	}
 
 	// remove it if it already exists
@@ -210,38 +369,70 @@ func (r Region) BuildMap() {
 	mapDS := driver.Create(r.mapfile, rXsize, rYsize, NumLayers, gdal.Int16, nil)
 	defer mapDS.Close()
 
-	mapDS.SetGeoTransform(elGT)
+	if err := mapDS.SetGeoTransform(elGT); notnil(err) {
+		return wrap("BuildMap", ErrGDAL, err)
+	}
 
-	mapSRS := gdal.CreateSpatialReference("")
-	mapSRS.FromProj4(albers_proj)
+	mapSRS, serr := spatialReference(r.proj)
+	if serr != nil {
+		return serr
+	}
 	mapWKT, werr := mapSRS.ToWKT()
 	if notnil(werr) {
-		panic(werr)
+		return wrap("BuildMap", ErrProjection, werr)
+	}
+	if err := mapDS.SetProjection(mapWKT); notnil(err) {
+		return wrap("BuildMap", ErrGDAL, err)
 	}
-	mapDS.SetProjection(mapWKT)
 
 	// transform the elevation array
 	elevarr := r.elev(elBuffer)
 	elRaster := mapDS.RasterBand(Elevation)
 	eioerr := elRaster.IO(gdal.Write, 0, 0, rXsize, rYsize, elevarr, rXsize, rYsize, 0, 0)
 	if notnil(eioerr) {
-		panic(eioerr)
+		return wrap("BuildMap", ErrGDAL, eioerr)
+	}
+
+	// temperatures come from the elevation in meters
+	temparr := r.temperatures(elBuffer, rXsize, rYsize)
+	tempRaster := mapDS.RasterBand(Temperature)
+	temperr := tempRaster.IO(gdal.Write, 0, 0, rXsize, rYsize, temparr, rXsize, rYsize, 0, 0)
+	if notnil(temperr) {
+		return wrap("BuildMap", ErrGDAL, temperr)
 	}
 
 	// write the crust array to the raster
-	crustarr := r.crust(rXsize, rYsize)
+	crustarr, cerr := r.crust(rXsize, rYsize)
+	if cerr != nil {
+		return cerr
+	}
 	crustRaster := mapDS.RasterBand(Crust)
 	crusterr := crustRaster.IO(gdal.Write, 0, 0, rXsize, rYsize, crustarr, rXsize, rYsize, 0, 0)
 	if notnil(crusterr) {
-		panic(crusterr)
+		return wrap("BuildMap", ErrGDAL, crusterr)
 	}
 
 	// landcover and depth follow
-	lcExtents := r.albers["landcover"]
+	lcExtents := r.projected["landcover"]
+
+	// landcover in any other projection than the map's is warped onto
+	// the map projection first
+	lcfile := r.vrts["landcover"]
+	same, serr := sameProjection(lcfile, r.proj)
+	if serr != nil {
+		return serr
+	}
+	if !same {
+		lcfile = path.Join(td, "landcover.tif")
+		werr := r.warp(r.vrts["landcover"], lcfile, lcExtents, "near", 0, gdal.Unknown)
+		if werr != nil {
+			return werr
+		}
+	}
 
-	lcDS, err := gdal.Open(r.vrts["landcover"], gdal.ReadOnly)
+	lcDS, err := gdal.Open(lcfile, gdal.ReadOnly)
 	if err != nil {
-		panic(err)
+		return wrap("BuildMap", ErrMissingDataset, err)
 	}
 	defer lcDS.Close()
 	if Debug {
@@ -257,6 +448,9 @@ func (r Region) BuildMap() {
 	lcymax := int((lcf[yMin] - lcGT[3]) / lcGT[5])
 	lcxlen := lcxmax - lcxmin
 	lcylen := lcymax - lcymin
+	if lcxmin < 0 || lcymin < 0 || lcxmax > lcDS.RasterXSize() || lcymax > lcDS.RasterYSize() {
+		return errorf("BuildMap", ErrOutsideRaster, "landcover window (%d, %d)-(%d, %d) outside %dx%d raster %s", lcxmin, lcymin, lcxmax, lcymax, lcDS.RasterXSize(), lcDS.RasterYSize(), lcfile)
+	}
 	if Debug {
 		regionInfo(lcGT, lcExtents)
 	}
@@ -267,22 +461,12 @@ func (r Region) BuildMap() {
 	lcBuffer := make([]byte, lcbufferLen)
 	lcrerr := lcBand.IO(gdal.Read, lcxmin, lcymin, lcxlen, lcylen, lcBuffer, lcxlen, lcylen, 0, 0)
 	if notnil(lcrerr) {
-		panic(lcrerr)
+		return wrap("BuildMap", ErrGDAL, lcrerr)
 	}
 
+	// nodata is treated as water
 	lcNodata, ok := lcBand.NoDataValue()
-	if !ok {
-		lcNodata = 0
-	}
-	// nodata is treated as water, which is 11
-	newlcBuffer := make([]int, lcbufferLen)
-	for i, v := range lcBuffer {
-		// JMT: 0 also represents nodata in NLCD
-		if v == byte(lcNodata) || v == byte(0) {
-			lcBuffer[i] = 11
-		}
-		newlcBuffer[i] = int(lcBuffer[i])
-	}
+	newlcBuffer := r.scheme.values(lcBuffer, lcNodata, ok)
 
 	lccoordslen := lcxlen * lcylen
 	lcCoords := make([][2]float64, lccoordslen)
@@ -302,15 +486,18 @@ func (r Region) BuildMap() {
 	// IDT!
 	lcIDT, lcerr := idt.NewIDT(lcCoords, newlcBuffer)
 	if lcerr != nil {
-		panic(lcerr)
+		return wrap("BuildMap", ErrInvalidParameter, lcerr)
 	}
 
 	deptharr, derr := lcIDT.Call(depthCoords, 31, true)
 	if derr != nil {
-		panic(derr)
+		return wrap("BuildMap", ErrInvalidParameter, derr)
 	}
 
-	bathyBuffer := r.bathy(deptharr, depthxlen, depthylen)
+	bathyBuffer, berr := r.bathy(deptharr, depthxlen, depthylen)
+	if berr != nil {
+		return berr
+	}
 
 	lcarr := []int16{}
 	bathyarr := []int16{}
@@ -322,21 +509,80 @@ func (r Region) BuildMap() {
 		}
 	}
 
+	// measured depths replace the guesses wherever there are any
+	if r.vrts["bathymetry"] != "" {
+		measured, merr := r.measuredBathy(td, elExtents, rXsize, rYsize)
+		if merr != nil {
+			return merr
+		}
+		bathyarr = mergeBathy(bathyarr, measured, bathyNodata, r.bathyVScale(), r.maxdepth)
+	}
+
 	bathyRaster := mapDS.RasterBand(Bathy)
 	bathyerr := bathyRaster.IO(gdal.Write, 0, 0, rXsize, rYsize, bathyarr, rXsize, rYsize, 0, 0)
 	if notnil(bathyerr) {
-		panic(bathyerr)
+		return wrap("BuildMap", ErrGDAL, bathyerr)
 	}
 
 	lcRaster := mapDS.RasterBand(Landcover)
 	lcrerr = lcRaster.IO(gdal.Write, 0, 0, rXsize, rYsize, lcarr, rXsize, rYsize, 0, 0)
 	if notnil(lcrerr) {
-		panic(lcrerr)
+		return wrap("BuildMap", ErrGDAL, lcrerr)
+	}
+
+	// burn the rivers
+	riverarr, rerr := r.rivers(rXsize, rYsize, elGT)
+	if rerr != nil {
+		return rerr
+	}
+	riverRaster := mapDS.RasterBand(River)
+	riverr := riverRaster.IO(gdal.Write, 0, 0, rXsize, rYsize, riverarr, rXsize, rYsize, 0, 0)
+	if notnil(riverr) {
+		return wrap("BuildMap", ErrGDAL, riverr)
+	}
+
+	// burn the roads and railways, then grade the land under them
+	roadarr, roaderr := r.roads(rXsize, rYsize, elGT)
+	if roaderr != nil {
+		return roaderr
+	}
+	roadRaster := mapDS.RasterBand(Road)
+	roadwerr := roadRaster.IO(gdal.Write, 0, 0, rXsize, rYsize, roadarr, rXsize, rYsize, 0, 0)
+	if notnil(roadwerr) {
+		return wrap("BuildMap", ErrGDAL, roadwerr)
+	}
+	landroads := make([]int16, len(roadarr))
+	for i, wc := range roadarr {
+		if riverarr[i] == 0 && !r.rules.Rule(int(lcarr[i])).Water {
+			landroads[i] = wc
+		}
+	}
+	elevarr = grade(elevarr, landroads, rXsize, rYsize)
+	eioerr = elRaster.IO(gdal.Write, 0, 0, rXsize, rYsize, elevarr, rXsize, rYsize, 0, 0)
+	if notnil(eioerr) {
+		return wrap("BuildMap", ErrGDAL, eioerr)
+	}
+
+	// canopy and impervious percentages, if there are any
+	for _, band := range []struct {
+		key   string
+		layer int
+	}{{"canopy", Canopy}, {"impervious", Impervious}} {
+		coverarr, cerr := r.cover(band.key, td, elExtents, rXsize, rYsize)
+		if cerr != nil {
+			return cerr
+		}
+		coverRaster := mapDS.RasterBand(band.layer)
+		covererr := coverRaster.IO(gdal.Write, 0, 0, rXsize, rYsize, coverarr, rXsize, rYsize, 0, 0)
+		if notnil(covererr) {
+			return wrap("BuildMap", ErrGDAL, covererr)
+		}
 	}
 
 	if Debug {
 		datasetInfo(mapDS, "Output")
 	}
+	return nil
 }
 
 func (r Region) elev(orig []float32) []int16 {
@@ -353,7 +599,10 @@ func datasetInfo(ds gdal.Dataset, name string) {
 	gt := ds.GeoTransform()
 	log.Printf("  Origin: %f, %f", gt[0], gt[3])
 	log.Printf("  Pixel size: %f, %f", gt[1], gt[5])
-	histos := datasetHistograms(ds)
+	histos, err := datasetHistograms(ds)
+	if err != nil {
+		log.Printf("  Histograms: %s", err)
+	}
 	for i, v := range histos {
 		log.Printf("  Band %d: %s", i+1, v)
 	}
@@ -393,7 +642,7 @@ func (ri RasterInfo) String() string {
 	return retval
 }
 
-func datasetHistograms(ds gdal.Dataset) []RasterInfo {
+func datasetHistograms(ds gdal.Dataset) ([]RasterInfo, error) {
 	bandCount := ds.RasterCount()
 	retval := make([]RasterInfo, bandCount)
 	for i := 0; i < bandCount; i++ {
@@ -408,7 +657,7 @@ func datasetHistograms(ds gdal.Dataset) []RasterInfo {
 		rball := make([]int16, dsprod)
 		rbrerr := rb.IO(gdal.Read, 0, 0, dsx, dsy, rball, dsx, dsy, 0, 0)
 		if notnil(rbrerr) {
-			panic(rbrerr)
+			return nil, wrap("datasetHistograms", ErrGDAL, rbrerr)
 		}
 		rbh := make(map[int]int)
 		for _, v := range rball {
@@ -416,5 +665,5 @@ func datasetHistograms(ds gdal.Dataset) []RasterInfo {
 		}
 		retval[i] = RasterInfo{datatype: rbdt, buckets: rbh}
 	}
-	return retval
+	return retval, nil
 }
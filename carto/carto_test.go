@@ -1,6 +1,11 @@
 package carto
 
 import (
+	"errors"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
 	"reflect"
 	"testing"
 
@@ -78,16 +83,41 @@ var buildMap_tests = []struct {
 				3: 12367,
 				4: 789,
 			}},
+			// river -- no hydrography
+			RasterInfo{"Int16", map[int]int{
+				0: 65536,
+			}},
+			// canopy -- no dataset
+			RasterInfo{"Int16", map[int]int{
+				-1: 65536,
+			}},
+			// impervious -- no dataset
+			RasterInfo{"Int16", map[int]int{
+				-1: 65536,
+			}},
+			// road -- no transportation
+			RasterInfo{"Int16", map[int]int{
+				0: 65536,
+			}},
+			// temperature -- about 16 degrees at 41 degrees north
+			RasterInfo{"Int16", map[int]int{
+				16: 65536,
+			}},
 		},
 	},
 }
 
 func Test_buildMap(t *testing.T) {
 	for _, tt := range buildMap_tests {
-		r := MakeRegion(tt.name, tt.ll, tt.elname, tt.lcname)
+		r, err := MakeRegion(tt.name, tt.ll, tt.elname, tt.lcname)
+		if err != nil {
+			t.Fatal(err)
+		}
 		r.tilesize = 16
 		// Debug = true
-		r.BuildMap()
+		if err := r.BuildMap(); err != nil {
+			t.Fatal(err)
+		}
 		// Debug = false
 
 		// check the raster minmaxes
@@ -99,7 +129,10 @@ func Test_buildMap(t *testing.T) {
 			datasetInfo(ds, "Test")
 		}
 
-		histos := datasetHistograms(ds)
+		histos, err := datasetHistograms(ds)
+		if err != nil {
+			t.Fatal(err)
+		}
 		if len(histos) != len(tt.histos) {
 			t.Fatalf("len(histos) %d != len(tt.histos) %d", len(histos), len(tt.histos))
 		}
@@ -116,3 +149,145 @@ func Test_buildMap(t *testing.T) {
 		}
 	}
 }
+
+// writeDataset writes a one band GeoTIFF covering the extents in a
+// projection, with each pixel's value a function of its center.
+func writeDataset(filename string, def string, extents FloatExtents, pixel float64, dtype gdal.DataType, value func(x, y float64) float64) error {
+	sr, err := spatialReference(def)
+	if err != nil {
+		return err
+	}
+	wkt, err := sr.ToWKT()
+	if notnil(err) {
+		return err
+	}
+	driver, err := gdal.GetDriverByName("GTiff")
+	if err != nil {
+		return err
+	}
+	xsize := int(math.Ceil((extents[xMax] - extents[xMin]) / pixel))
+	ysize := int(math.Ceil((extents[yMax] - extents[yMin]) / pixel))
+	ds := driver.Create(filename, xsize, ysize, 1, dtype, nil)
+	defer ds.Close()
+	if err := ds.SetGeoTransform([6]float64{extents[xMin], pixel, 0, extents[yMax], 0, -pixel}); notnil(err) {
+		return err
+	}
+	if err := ds.SetProjection(wkt); notnil(err) {
+		return err
+	}
+	buf := make([]float64, xsize*ysize)
+	for i := range buf {
+		buf[i] = value(extents[xMin]+pixel*(float64(i%xsize)+0.5), extents[yMax]-pixel*(float64(i/xsize)+0.5))
+	}
+	return ds.RasterBand(1).IO(gdal.Write, 0, 0, xsize, ysize, buf, xsize, ysize, 0, 0)
+}
+
+// Test_buildMapCORINE builds a map of the bay of Mont Saint-Michel from
+// datasets projected as the European ones come: elevation in latitude
+// and longitude, and CORINE landcover in the European LAEA projection
+// (EPSG:3035).  The west of the landcover is sea and the east is arable
+// land, so landcover which is read without warping it onto the map
+// comes out in the wrong place, if it is found at all.
+func Test_buildMapCORINE(t *testing.T) {
+	td, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(td)
+	datasets, maps := DatasetDir, MapsDir
+	DatasetDir, MapsDir = td, td
+	defer func() { DatasetDir, MapsDir = datasets, maps }()
+	name := "MontSaintMichel"
+	if err := os.MkdirAll(path.Join(td, name), 0775); err != nil {
+		t.Fatal(err)
+	}
+
+	// the datasets reach well beyond the region, and the shore runs
+	// north and south through its middle
+	ll := FloatExtents{-1.50, -1.53, 48.645, 48.625}
+	cover := FloatExtents{-1.45, -1.58, 48.67, 48.60}
+	if err := writeDataset(path.Join(td, name, "elevation.tif"), wgs84_proj, cover, 0.0005, gdal.Float32, func(x, y float64) float64 { return 10 }); err != nil {
+		t.Fatal(err)
+	}
+	laea := "EPSG:3035"
+	shore, err := getCorners(wgs84_proj, laea, FloatExtents{-1.515, -1.515, 48.635, 48.635})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lcCover, err := getCorners(wgs84_proj, laea, cover)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// sea and ocean, then non-irrigated arable land
+	sea, land := 44, 12
+	if err := writeDataset(path.Join(td, name, "landcover.tif"), laea, lcCover, 100, gdal.Byte, func(x, y float64) float64 {
+		if x < shore[xMin] {
+			return float64(sea)
+		}
+		return float64(land)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := MakeRegion(name, ll, "elevation.tif", "landcover.tif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.tilesize = 16
+	if err := r.SetProjection(UTMProjection); err != nil {
+		t.Fatal(err)
+	}
+	r.SetScheme(CORINE)
+	if err := r.BuildMap(); err != nil {
+		t.Fatal(err)
+	}
+
+	ds, err := gdal.Open(r.mapfile, gdal.ReadOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ds.Close()
+	xsize, ysize := ds.RasterXSize(), ds.RasterYSize()
+	lc := make([]int16, xsize*ysize)
+	if err := ds.RasterBand(Landcover).IO(gdal.Read, 0, 0, xsize, ysize, lc, xsize, ysize, 0, 0); notnil(err) {
+		t.Fatal(err)
+	}
+	for y := 0; y < ysize; y++ {
+		if west, east := int(lc[y*xsize]), int(lc[y*xsize+xsize-1]); west != sea || east != land {
+			t.Fatalf("row %d: expected sea %d in the west and land %d in the east, got %d and %d", y, sea, land, west, east)
+		}
+	}
+}
+
+var SetCompression_tests = []struct {
+	name  string
+	level int
+	ok    bool
+}{
+	{"zlib", -1, true},
+	{"gzip", 9, true},
+	{"none", 42, true},
+	{"zlib", 10, false},
+	{"gzip", -3, false},
+	{"lz4", 0, false},
+}
+
+func Test_SetCompression(t *testing.T) {
+	for _, tt := range SetCompression_tests {
+		r := Region{name: "Compression"}
+		err := r.SetCompression(tt.name, tt.level)
+		if (err == nil) != tt.ok {
+			t.Errorf("given %s %d, expected ok %v, got %v", tt.name, tt.level, tt.ok, err)
+			continue
+		}
+		if err != nil {
+			if !errors.Is(err, ErrInvalidParameter) {
+				t.Errorf("given %s %d, expected an invalid parameter, got %v", tt.name, tt.level, err)
+			}
+			continue
+		}
+		if r.compression.String() != tt.name || r.compressionLevel != tt.level {
+			t.Errorf("given %s %d, got %s %d", tt.name, tt.level, r.compression, r.compressionLevel)
+		}
+	}
+}
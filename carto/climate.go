@@ -0,0 +1,177 @@
+package carto
+
+import (
+	"math"
+
+	"github.com/mathuin/terroir/world"
+)
+
+// Mean annual temperature at sea level is roughly equatorTemperature
+// at the equator, falling with the square of the latitude to
+// poleTemperature at the poles.  Temperatures are in degrees Celsius.
+const (
+	equatorTemperature = 27.0
+	poleTemperature    = -26.0
+)
+
+// Air cools by the lapse rate, in degrees per kilometer, going uphill.
+// Land is cold enough for snow wherever it is as cold as the sea level
+// at the snow latitude, and water freezes wherever it is as cold as
+// the sea level at the ice latitude.
+const (
+	defaultLapseRate    = 6.5
+	defaultSnowLatitude = 60.0
+	defaultIceLatitude  = 66.0
+)
+
+// coldVariants maps biomes to the biomes they become where it is cold.
+// Biomes which are not here stay as they are.
+var coldVariants = map[string]string{
+	"Ocean":              "Frozen Ocean",
+	"Deep Ocean":         "Frozen Ocean",
+	"River":              "Frozen River",
+	"Beach":              "Cold Beach",
+	"Plains":             "Ice Plains",
+	"Sunflower Plains":   "Ice Plains",
+	"Desert":             "Ice Plains",
+	"Desert Hills":       "Ice Mountains",
+	"Swampland":          "Ice Plains",
+	"Swampland M":        "Ice Plains",
+	"Extreme Hills":      "Ice Mountains",
+	"Extreme Hills Edge": "Ice Mountains",
+	"Extreme Hills M":    "Ice Mountains",
+	"Extreme Hills+":     "Ice Mountains",
+	"Forest":             "Cold Taiga",
+	"Forest Hills":       "Cold Taiga Hills",
+	"Birch Forest":       "Cold Taiga",
+	"Birch Forest Hills": "Cold Taiga Hills",
+	"Taiga":              "Cold Taiga",
+	"Taiga Hills":        "Cold Taiga Hills",
+	"Taiga M":            "Cold Taiga M",
+	"Mega Taiga":         "Cold Taiga",
+	"Mega Taiga Hills":   "Cold Taiga Hills",
+}
+
+// snowless holds the blocks snow does not lie on: water and ice, snow
+// itself, rails, and the tops of plants and crops.
+var snowless = map[world.Block]bool{
+	world.MakeBlock(railID, 0): true,
+	world.MakeBlock(railID, 1): true,
+}
+
+func init() {
+	for _, name := range []string{"Water", "Ice", "Snow Layer", "Grass", "Fern", "Double Tallgrass Top", "Large Fern Top", "Sunflower Top", "Wheat", "Carrot", "Potato"} {
+		b, err := world.BlockNamed(name)
+		if err != nil {
+			panic(err)
+		}
+		snowless[*b] = true
+	}
+}
+
+// SetClimate sets the lapse rate in degrees per kilometer and the
+// latitudes whose sea level temperatures bring snow and ice.  Zero
+// takes the default.
+func (r *Region) SetClimate(lapseRate float64, snowLatitude float64, iceLatitude float64) error {
+	if lapseRate < 0 {
+		return errorf("SetClimate", ErrInvalidParameter, "lapse rate %f must be at least 0", lapseRate)
+	}
+	for _, p := range []struct {
+		name  string
+		value float64
+	}{{"snow latitude", snowLatitude}, {"ice latitude", iceLatitude}} {
+		if p.value < 0 || p.value > 90 {
+			return errorf("SetClimate", ErrInvalidParameter, "%s %f must be between 0 and 90", p.name, p.value)
+		}
+	}
+	if lapseRate == 0 {
+		lapseRate = defaultLapseRate
+	}
+	if snowLatitude == 0 {
+		snowLatitude = defaultSnowLatitude
+	}
+	if iceLatitude == 0 {
+		iceLatitude = defaultIceLatitude
+	}
+	r.lapserate = lapseRate
+	r.snowlatitude = snowLatitude
+	r.icelatitude = iceLatitude
+	return nil
+}
+
+// seaLevelTemperature returns the mean annual temperature at sea level
+// at a latitude.
+func seaLevelTemperature(lat float64) float64 {
+	f := lat / 90
+	return equatorTemperature + (poleTemperature-equatorTemperature)*f*f
+}
+
+// temperature returns the mean annual temperature at a latitude and an
+// elevation in meters.  Land below sea level is no warmer than the sea.
+func (r Region) temperature(lat float64, meters float64) float64 {
+	return seaLevelTemperature(lat) - r.lapserate*math.Max(meters, 0)/1000
+}
+
+// temperatures returns the temperature of each pixel of the map in
+// whole degrees, from its elevation in meters before any vertical
+// scaling.  Latitude runs evenly from the north edge of the map to the
+// south.
+func (r Region) temperatures(elev []float32, xsize int, ysize int) []int16 {
+	wgs := r.wgs84["elevation"]
+	arr := make([]int16, len(elev))
+	for i, v := range elev {
+		row := float64(i/xsize) + 0.5
+		lat := wgs[yMax] + (wgs[yMin]-wgs[yMax])*row/float64(ysize)
+		arr[i] = int16(math.Round(r.temperature(lat, float64(v))))
+	}
+	return arr
+}
+
+// cold reports whether a temperature brings cold biomes and snow.
+func (r Region) cold(temp int16) bool {
+	return float64(temp) <= seaLevelTemperature(r.snowlatitude)
+}
+
+// frozen reports whether a temperature freezes water.
+func (r Region) frozen(temp int16) bool {
+	return float64(temp) <= seaLevelTemperature(r.icelatitude)
+}
+
+// cold returns the rule with the cold variants of its biomes.
+func (rule Rule) cold() Rule {
+	variant := func(biome string) string {
+		if cold, ok := coldVariants[biome]; ok {
+			return cold
+		}
+		return biome
+	}
+	rule.Biome = variant(rule.Biome)
+	if rule.DeepBiome != "" {
+		rule.DeepBiome = variant(rule.DeepBiome)
+	}
+	bands := make([]BiomeBand, len(rule.Bands))
+	for i, band := range rule.Bands {
+		bands[i] = BiomeBand{Above: band.Above, Biome: variant(band.Biome)}
+	}
+	rule.Bands = bands
+	return rule
+}
+
+// weather freezes water at the top of a column into ice where it is
+// frozen, and lays snow on the ground where it is cold.  Columns with
+// structures are left alone, since the structure stands on the top.
+func (r Region) weather(c Column, temp int16) (Column, error) {
+	if c.structure != nil || len(c.blocks) == 0 {
+		return c, nil
+	}
+	top := c.blocks[len(c.blocks)-1]
+	water, _ := world.BlockNamed("Water")
+	switch {
+	case top == *water && r.frozen(temp):
+		ice, _ := world.BlockNamed("Ice")
+		c.blocks[len(c.blocks)-1] = *ice
+	case r.cold(temp) && !snowless[top]:
+		return c.withPlant("Snow Layer")
+	}
+	return c, nil
+}
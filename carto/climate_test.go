@@ -0,0 +1,117 @@
+package carto
+
+import (
+	"math"
+	"testing"
+
+	"github.com/mathuin/terroir/world"
+)
+
+var seaLevelTemperature_tests = []struct {
+	lat  float64
+	want float64
+}{
+	{0, equatorTemperature},
+	{90, poleTemperature},
+	{-90, poleTemperature},
+	{45, 13.75},
+}
+
+func Test_seaLevelTemperature(t *testing.T) {
+	for _, tt := range seaLevelTemperature_tests {
+		if got := seaLevelTemperature(tt.lat); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("given %f, expected %f, got %f", tt.lat, tt.want, got)
+		}
+	}
+}
+
+func Test_temperatures(t *testing.T) {
+	r := Region{lapserate: defaultLapseRate, wgs84: map[string]FloatExtents{"elevation": {10, 9, 62, 58}}}
+	// two rows, the second much higher
+	elev := []float32{0, -20, 2000, 2000}
+	got := r.temperatures(elev, 2, 2)
+	if got[0] != got[1] {
+		t.Errorf("expected land below sea level as warm as the sea, got %v", got)
+	}
+	north := int16(math.Round(seaLevelTemperature(61)))
+	if got[0] != north {
+		t.Errorf("expected %d at 61 degrees, got %d", north, got[0])
+	}
+	south := int16(math.Round(seaLevelTemperature(59) - 2*defaultLapseRate))
+	if got[2] != south {
+		t.Errorf("expected %d at 59 degrees and 2000 meters, got %d", south, got[2])
+	}
+}
+
+func Test_SetClimate(t *testing.T) {
+	var r Region
+	if err := r.SetClimate(0, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if r.lapserate != defaultLapseRate || r.snowlatitude != defaultSnowLatitude || r.icelatitude != defaultIceLatitude {
+		t.Errorf("expected defaults, got %f %f %f", r.lapserate, r.snowlatitude, r.icelatitude)
+	}
+	for _, bad := range [][3]float64{{-1, 0, 0}, {0, 91, 0}, {0, 0, -5}} {
+		if err := r.SetClimate(bad[0], bad[1], bad[2]); err == nil {
+			t.Errorf("given %v, expected an error", bad)
+		}
+	}
+}
+
+func Test_coldVariants(t *testing.T) {
+	for warm, cold := range coldVariants {
+		for _, biome := range []string{warm, cold} {
+			if _, ok := world.Biome[biome]; !ok {
+				t.Errorf("%s not found in world.Biome", biome)
+			}
+		}
+		if !coldBiomes[cold] {
+			t.Errorf("%s is not a cold biome", cold)
+		}
+	}
+	rule := NLCDRules.Rule(11).cold()
+	if rule.Biome != "Frozen Ocean" || rule.DeepBiome != "Frozen Ocean" {
+		t.Errorf("expected frozen ocean, got %s and %s", rule.Biome, rule.DeepBiome)
+	}
+	rule = plainsRule.cold()
+	if got := rule.biome(160, 0, 30); got != "Ice Mountains" {
+		t.Errorf("expected Ice Mountains, got %s", got)
+	}
+	if plainsRule.Bands[0].Biome != "Extreme Hills M" {
+		t.Error("plainsRule changed")
+	}
+}
+
+var weather_tests = []struct {
+	rule Rule
+	temp int16
+	want string
+}{
+	{plainsRule, 10, "Grass Block"},
+	{plainsRule, 0, "Snow Layer"},
+	{plainsRule, -10, "Snow Layer"},
+	{NLCDRules.Rule(11), 0, "Water"},
+	{NLCDRules.Rule(11), -10, "Ice"},
+	{cropRule, -10, "Wheat"},
+}
+
+func Test_weather(t *testing.T) {
+	r := Region{lapserate: defaultLapseRate, snowlatitude: defaultSnowLatitude, icelatitude: defaultIceLatitude}
+	xz := world.XZ{X: 1, Z: 2}
+	must := columnOf(t)
+	for _, tt := range weather_tests {
+		c := must(tt.rule.column(xz, 64, 5, 2, 30))
+		if len(tt.rule.Crops) > 0 {
+			c = must(c.withPlant("Wheat"))
+		}
+		c = must(r.weather(c, tt.temp))
+		if got, _ := c.blocks[len(c.blocks)-1].BlockName(); got != tt.want {
+			t.Errorf("given %s at %d, expected %s on top, got %s", tt.rule.Biome, tt.temp, tt.want, got)
+		}
+	}
+	c := must(plainsRule.column(xz, 64, 0, 2, 30))
+	c.structure = tree{}
+	if got := must(r.weather(c, -10)); len(got.blocks) != 64 {
+		t.Error("expected no snow under a structure")
+	}
+}
@@ -0,0 +1,309 @@
+package carto
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/mathuin/terroir/world"
+)
+
+// RegionConfig describes a region in a JSON file, so that regions can
+// be kept under version control and rebuilt the same way every time.
+//
+// Dataset file names are relative to the region's directory inside
+// DatasetDir, and the rule table file is relative to the configuration
+// file.  The landcover scheme defaults to NLCD, and a rule table, if
+// given, replaces the scheme's own.  Zero scale parameters take the same
+// defaults as MakeRegion.
+type RegionConfig struct {
+	Name        string         `json:"name"`
+	Bounds      Bounds         `json:"bounds"`
+	Elevation   string         `json:"elevation"`
+	Landcover   string         `json:"landcover"`
+	Bathymetry  string         `json:"bathymetry,omitempty"`
+	BathyVScale int            `json:"bathy_vscale,omitempty"`
+	Hydrography string         `json:"hydrography,omitempty"`
+	RiverWidth  float64        `json:"river_width,omitempty"`
+	RiverDepth  int            `json:"river_depth,omitempty"`
+	BeachWidth  *int           `json:"beach_width,omitempty"`
+	BeachHeight *int           `json:"beach_height,omitempty"`
+	BeachSlope  int            `json:"beach_slope,omitempty"`
+	Canopy      string         `json:"canopy,omitempty"`
+	Impervious  string         `json:"impervious,omitempty"`
+	Transport   string         `json:"transportation,omitempty"`
+	LapseRate   float64        `json:"lapse_rate,omitempty"`
+	SnowLat     float64        `json:"snow_latitude,omitempty"`
+	IceLat      float64        `json:"ice_latitude,omitempty"`
+	Projection  string         `json:"projection,omitempty"`
+	Resample    string         `json:"resample,omitempty"`
+	Nodata      float64        `json:"nodata,omitempty"`
+	Scheme      string         `json:"scheme,omitempty"`
+	Rows        string         `json:"row_direction,omitempty"`
+	Seed        int64          `json:"seed,omitempty"`
+	Scale       int            `json:"scale,omitempty"`
+	VScale      int            `json:"vscale,omitempty"`
+	Trim        int            `json:"trim,omitempty"`
+	TileSize    int            `json:"tilesize,omitempty"`
+	SeaLevel    int            `json:"sealevel,omitempty"`
+	MaxDepth    int            `json:"maxdepth,omitempty"`
+	Rules       string         `json:"rules,omitempty"`
+	Biomes      map[int]string `json:"biomes,omitempty"`
+
+	rules *RuleTable
+}
+
+// Bounds are latitude and longitude boundaries in degrees.
+type Bounds struct {
+	North float64 `json:"north"`
+	South float64 `json:"south"`
+	East  float64 `json:"east"`
+	West  float64 `json:"west"`
+}
+
+func (b Bounds) extents() FloatExtents {
+	return FloatExtents{b.East, b.West, b.North, b.South}
+}
+
+// LoadRegionConfig reads and validates a region configuration file.
+func LoadRegionConfig(filename string) (*RegionConfig, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, wrap("LoadRegionConfig", ErrMissingDataset, err)
+	}
+	defer f.Close()
+	rc, err := readRegionConfig(f, path.Dir(filename))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return rc, nil
+}
+
+// ReadRegionConfig reads and validates a region configuration.
+// Unknown keys are rejected so that typos do not silently fall back
+// to defaults.
+func ReadRegionConfig(r io.Reader) (*RegionConfig, error) {
+	return readRegionConfig(r, ".")
+}
+
+func readRegionConfig(r io.Reader, dir string) (*RegionConfig, error) {
+	rc := new(RegionConfig)
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(rc); err != nil {
+		return nil, wrap("config", ErrInvalidParameter, err)
+	}
+	rc.setDefaults()
+	if err := rc.Validate(); err != nil {
+		return nil, err
+	}
+	if rc.Rules != "" {
+		fn := rc.Rules
+		if !path.IsAbs(fn) {
+			fn = path.Join(dir, fn)
+		}
+		t, err := LoadRuleTable(fn)
+		if err != nil {
+			return nil, fmt.Errorf("rules: %w", err)
+		}
+		rc.rules = t
+	}
+	return rc, nil
+}
+
+func (rc *RegionConfig) setDefaults() {
+	if rc.Scale == 0 {
+		rc.Scale = 6
+	}
+	if rc.VScale == 0 {
+		rc.VScale = 6
+	}
+	if rc.TileSize == 0 {
+		rc.TileSize = 256
+	}
+	if rc.SeaLevel == 0 {
+		rc.SeaLevel = 62
+	}
+	if rc.MaxDepth == 0 {
+		rc.MaxDepth = 30
+	}
+	if rc.BeachWidth == nil {
+		width := defaultBeachWidth
+		rc.BeachWidth = &width
+	}
+	if rc.BeachHeight == nil {
+		height := defaultBeachHeight
+		rc.BeachHeight = &height
+	}
+	if rc.BeachSlope == 0 {
+		rc.BeachSlope = defaultBeachSlope
+	}
+}
+
+// Validate checks the configuration for values which cannot produce a
+// usable region.  Missing datasets are ErrMissingDataset errors, and
+// everything else is ErrInvalidParameter or ErrProjection.
+func (rc RegionConfig) Validate() error {
+	if rc.Name == "" {
+		return errorf("config", ErrInvalidParameter, "name is required")
+	}
+	if strings.ContainsAny(rc.Name, `/\`) {
+		return errorf("config", ErrInvalidParameter, "name %q must not contain path separators", rc.Name)
+	}
+
+	b := rc.Bounds
+	if b.North > 90 || b.South < -90 {
+		return errorf("config", ErrInvalidParameter, "bounds: latitudes must be between -90 and 90")
+	}
+	if b.East > 180 || b.West < -180 {
+		return errorf("config", ErrInvalidParameter, "bounds: longitudes must be between -180 and 180")
+	}
+	if b.North <= b.South {
+		return errorf("config", ErrInvalidParameter, "bounds: north %f must be greater than south %f", b.North, b.South)
+	}
+	if b.East <= b.West {
+		return errorf("config", ErrInvalidParameter, "bounds: east %f must be greater than west %f", b.East, b.West)
+	}
+
+	for key, name := range map[string]string{"elevation": rc.Elevation, "landcover": rc.Landcover} {
+		if name == "" {
+			return errorf("config", ErrInvalidParameter, "%s dataset is required", key)
+		}
+		fn := path.Join(DatasetDir, rc.Name, name)
+		if _, err := os.Stat(fn); err != nil {
+			return wrap("config", ErrMissingDataset, err)
+		}
+	}
+	for _, name := range []string{rc.Bathymetry, rc.Hydrography, rc.Canopy, rc.Impervious, rc.Transport} {
+		if name == "" {
+			continue
+		}
+		fn := path.Join(DatasetDir, rc.Name, name)
+		if _, err := os.Stat(fn); err != nil {
+			return wrap("config", ErrMissingDataset, err)
+		}
+	}
+	if rc.RiverWidth < 0 {
+		return errorf("config", ErrInvalidParameter, "river_width %f must be at least 0", rc.RiverWidth)
+	}
+
+	if rc.LapseRate < 0 {
+		return errorf("config", ErrInvalidParameter, "lapse_rate %f must be at least 0", rc.LapseRate)
+	}
+	for name, lat := range map[string]float64{"snow_latitude": rc.SnowLat, "ice_latitude": rc.IceLat} {
+		if lat < 0 || lat > 90 {
+			return errorf("config", ErrInvalidParameter, "%s %f must be between 0 and 90", name, lat)
+		}
+	}
+
+	if _, err := projection(rc.Projection, b.extents()); err != nil {
+		return err
+	}
+
+	if rc.Resample != "" {
+		if _, err := resampleAlg(rc.Resample); err != nil {
+			return err
+		}
+	}
+
+	if rc.Scheme != "" {
+		if _, err := LookupScheme(rc.Scheme); err != nil {
+			return err
+		}
+	}
+
+	switch strings.ToLower(strings.TrimSpace(rc.Rows)) {
+	case "", RowsAuto, RowsNorthSouth, RowsEastWest:
+	default:
+		return errorf("config", ErrInvalidParameter, "row_direction %q must be %s, %s or %s", rc.Rows, RowsAuto, RowsNorthSouth, RowsEastWest)
+	}
+
+	params := []struct {
+		name  string
+		value int
+		min   int
+	}{
+		{"scale", rc.Scale, 1},
+		{"vscale", rc.VScale, 1},
+		{"trim", rc.Trim, 0},
+		{"tilesize", rc.TileSize, 1},
+		{"sealevel", rc.SeaLevel, 1},
+		{"maxdepth", rc.MaxDepth, 1},
+		{"bathy_vscale", rc.BathyVScale, 0},
+		{"river_depth", rc.RiverDepth, 0},
+		{"beach_width", *rc.BeachWidth, 0},
+		{"beach_height", *rc.BeachHeight, 0},
+		{"beach_slope", rc.BeachSlope, 1},
+	}
+	for _, p := range params {
+		if p.value < p.min {
+			return errorf("config", ErrInvalidParameter, "%s %d must be at least %d", p.name, p.value, p.min)
+		}
+	}
+
+	for lc, biome := range rc.Biomes {
+		if _, ok := world.Biome[biome]; !ok {
+			return errorf("config", ErrInvalidParameter, "biomes: landcover %d: %q not found in world.Biome", lc, biome)
+		}
+	}
+	return nil
+}
+
+// Region builds the region described by the configuration.
+func (rc RegionConfig) Region() (Region, error) {
+	r, err := MakeRegionFull(rc.Name, rc.Bounds.extents(), rc.Elevation, rc.Landcover, rc.Scale, rc.VScale, rc.Trim, rc.TileSize, rc.SeaLevel, rc.MaxDepth)
+	if err != nil {
+		return r, err
+	}
+	if rc.Projection != "" {
+		if err := r.SetProjection(rc.Projection); err != nil {
+			return r, err
+		}
+	}
+	if rc.Resample != "" {
+		if err := r.SetResample(rc.Resample); err != nil {
+			return r, err
+		}
+	}
+	r.SetNodata(rc.Nodata)
+	r.SetSeed(rc.Seed)
+	if err := r.SetBathymetry(rc.Bathymetry, rc.BathyVScale); err != nil {
+		return r, err
+	}
+	if err := r.SetHydrography(rc.Hydrography, rc.RiverWidth, rc.RiverDepth); err != nil {
+		return r, err
+	}
+	if err := r.SetBeaches(*rc.BeachWidth, *rc.BeachHeight, rc.BeachSlope); err != nil {
+		return r, err
+	}
+	if err := r.SetClimate(rc.LapseRate, rc.SnowLat, rc.IceLat); err != nil {
+		return r, err
+	}
+	r.SetCanopy(rc.Canopy)
+	r.SetImpervious(rc.Impervious)
+	r.SetTransportation(rc.Transport)
+	if err := r.SetRowDirection(rc.Rows); err != nil {
+		return r, err
+	}
+	if rc.Scheme != "" {
+		s, err := LookupScheme(rc.Scheme)
+		if err != nil {
+			return r, err
+		}
+		r.SetScheme(s)
+	}
+	if rc.rules != nil {
+		if err := r.SetRules(*rc.rules); err != nil {
+			return r, err
+		}
+	}
+	if len(rc.Biomes) > 0 {
+		if err := r.SetRules(r.rules.withBiomes(rc.Biomes)); err != nil {
+			return r, err
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,121 @@
+package carto
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func Test_LoadRegionConfig(t *testing.T) {
+	rc, err := LoadRegionConfig("datasets/BlockIsland/region.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rc.Name != "BlockIsland" {
+		t.Errorf("expected name BlockIsland, got %s", rc.Name)
+	}
+	want := FloatExtents{-71.575, -71.576, 41.191, 41.189}
+	if rc.Bounds.extents() != want {
+		t.Errorf("expected extents %v, got %v", want, rc.Bounds.extents())
+	}
+}
+
+var readRegionConfig_tests = []struct {
+	json string
+	ok   bool
+}{
+	// minimal, defaults filled in
+	{`{"name": "BlockIsland", "bounds": {"north": 41.191, "south": 41.189, "east": -71.575, "west": -71.576}, "elevation": "elevation.tif", "landcover": "landcover.tif"}`, true},
+	// biome override
+	{`{"name": "BlockIsland", "bounds": {"north": 41.191, "south": 41.189, "east": -71.575, "west": -71.576}, "elevation": "elevation.tif", "landcover": "landcover.tif", "biomes": {"31": "Mesa"}}`, true},
+	// rule table
+	{`{"name": "BlockIsland", "bounds": {"north": 41.191, "south": 41.189, "east": -71.575, "west": -71.576}, "elevation": "elevation.tif", "landcover": "landcover.tif", "rules": "rules/nlcd.json"}`, true},
+	// missing rule table
+	{`{"name": "BlockIsland", "bounds": {"north": 41.191, "south": 41.189, "east": -71.575, "west": -71.576}, "elevation": "elevation.tif", "landcover": "landcover.tif", "rules": "rules/none.json"}`, false},
+	// projection keyword
+	{`{"name": "BlockIsland", "bounds": {"north": 41.191, "south": 41.189, "east": -71.575, "west": -71.576}, "elevation": "elevation.tif", "landcover": "landcover.tif", "projection": "utm"}`, true},
+	// resampling and nodata
+	{`{"name": "BlockIsland", "bounds": {"north": 41.191, "south": 41.189, "east": -71.575, "west": -71.576}, "elevation": "elevation.tif", "landcover": "landcover.tif", "resample": "average", "nodata": -10}`, true},
+	// unknown resampling method
+	{`{"name": "BlockIsland", "bounds": {"north": 41.191, "south": 41.189, "east": -71.575, "west": -71.576}, "elevation": "elevation.tif", "landcover": "landcover.tif", "resample": "smudge"}`, false},
+	// bathymetry
+	{`{"name": "BlockIsland", "bounds": {"north": 41.191, "south": 41.189, "east": -71.575, "west": -71.576}, "elevation": "elevation.tif", "landcover": "landcover.tif", "bathymetry": "elevation.tif", "bathy_vscale": 2}`, true},
+	// missing bathymetry
+	{`{"name": "BlockIsland", "bounds": {"north": 41.191, "south": 41.189, "east": -71.575, "west": -71.576}, "elevation": "elevation.tif", "landcover": "landcover.tif", "bathymetry": "gebco.tif"}`, false},
+	// negative bathymetry scale
+	{`{"name": "BlockIsland", "bounds": {"north": 41.191, "south": 41.189, "east": -71.575, "west": -71.576}, "elevation": "elevation.tif", "landcover": "landcover.tif", "bathymetry": "elevation.tif", "bathy_vscale": -1}`, false},
+	// hydrography
+	{`{"name": "BlockIsland", "bounds": {"north": 41.191, "south": 41.189, "east": -71.575, "west": -71.576}, "elevation": "elevation.tif", "landcover": "landcover.tif", "hydrography": "landcover.tif", "river_width": 20, "river_depth": 3}`, true},
+	// missing hydrography
+	{`{"name": "BlockIsland", "bounds": {"north": 41.191, "south": 41.189, "east": -71.575, "west": -71.576}, "elevation": "elevation.tif", "landcover": "landcover.tif", "hydrography": "nhd.gpkg"}`, false},
+	// canopy and impervious surface
+	{`{"name": "BlockIsland", "bounds": {"north": 41.191, "south": 41.189, "east": -71.575, "west": -71.576}, "elevation": "elevation.tif", "landcover": "landcover.tif", "canopy": "landcover.tif", "impervious": "landcover.tif"}`, true},
+	// missing canopy
+	{`{"name": "BlockIsland", "bounds": {"north": 41.191, "south": 41.189, "east": -71.575, "west": -71.576}, "elevation": "elevation.tif", "landcover": "landcover.tif", "canopy": "canopy.tif"}`, false},
+	// crop rows
+	{`{"name": "BlockIsland", "bounds": {"north": 41.191, "south": 41.189, "east": -71.575, "west": -71.576}, "elevation": "elevation.tif", "landcover": "landcover.tif", "row_direction": "ns"}`, true},
+	{`{"name": "BlockIsland", "bounds": {"north": 41.191, "south": 41.189, "east": -71.575, "west": -71.576}, "elevation": "elevation.tif", "landcover": "landcover.tif", "row_direction": "diagonal"}`, false},
+	// transportation
+	{`{"name": "BlockIsland", "bounds": {"north": 41.191, "south": 41.189, "east": -71.575, "west": -71.576}, "elevation": "elevation.tif", "landcover": "landcover.tif", "transportation": "landcover.tif"}`, true},
+	{`{"name": "BlockIsland", "bounds": {"north": 41.191, "south": 41.189, "east": -71.575, "west": -71.576}, "elevation": "elevation.tif", "landcover": "landcover.tif", "transportation": "roads.osm.pbf"}`, false},
+	// climate
+	{`{"name": "BlockIsland", "bounds": {"north": 41.191, "south": 41.189, "east": -71.575, "west": -71.576}, "elevation": "elevation.tif", "landcover": "landcover.tif", "lapse_rate": 9.8, "snow_latitude": 40, "ice_latitude": 50}`, true},
+	{`{"name": "BlockIsland", "bounds": {"north": 41.191, "south": 41.189, "east": -71.575, "west": -71.576}, "elevation": "elevation.tif", "landcover": "landcover.tif", "lapse_rate": -1}`, false},
+	{`{"name": "BlockIsland", "bounds": {"north": 41.191, "south": 41.189, "east": -71.575, "west": -71.576}, "elevation": "elevation.tif", "landcover": "landcover.tif", "ice_latitude": 91}`, false},
+	// negative river width
+	{`{"name": "BlockIsland", "bounds": {"north": 41.191, "south": 41.189, "east": -71.575, "west": -71.576}, "elevation": "elevation.tif", "landcover": "landcover.tif", "river_width": -5}`, false},
+	// no beaches
+	{`{"name": "BlockIsland", "bounds": {"north": 41.191, "south": 41.189, "east": -71.575, "west": -71.576}, "elevation": "elevation.tif", "landcover": "landcover.tif", "beach_width": 0, "beach_height": 0}`, true},
+	// negative beach width
+	{`{"name": "BlockIsland", "bounds": {"north": 41.191, "south": 41.189, "east": -71.575, "west": -71.576}, "elevation": "elevation.tif", "landcover": "landcover.tif", "beach_width": -2}`, false},
+	// landcover scheme
+	{`{"name": "BlockIsland", "bounds": {"north": 41.191, "south": 41.189, "east": -71.575, "west": -71.576}, "elevation": "elevation.tif", "landcover": "landcover.tif", "scheme": "corine"}`, true},
+	// unknown landcover scheme
+	{`{"name": "BlockIsland", "bounds": {"north": 41.191, "south": 41.189, "east": -71.575, "west": -71.576}, "elevation": "elevation.tif", "landcover": "landcover.tif", "scheme": "anderson"}`, false},
+	// unknown key
+	{`{"name": "BlockIsland", "bounds": {"north": 41.191, "south": 41.189, "east": -71.575, "west": -71.576}, "elevation": "elevation.tif", "landcover": "landcover.tif", "sealvl": 62}`, false},
+	// missing name
+	{`{"bounds": {"north": 41.191, "south": 41.189, "east": -71.575, "west": -71.576}, "elevation": "elevation.tif", "landcover": "landcover.tif"}`, false},
+	// north and south swapped
+	{`{"name": "BlockIsland", "bounds": {"north": 41.189, "south": 41.191, "east": -71.575, "west": -71.576}, "elevation": "elevation.tif", "landcover": "landcover.tif"}`, false},
+	// missing dataset
+	{`{"name": "BlockIsland", "bounds": {"north": 41.191, "south": 41.189, "east": -71.575, "west": -71.576}, "elevation": "nope.tif", "landcover": "landcover.tif"}`, false},
+	// unknown biome
+	{`{"name": "BlockIsland", "bounds": {"north": 41.191, "south": 41.189, "east": -71.575, "west": -71.576}, "elevation": "elevation.tif", "landcover": "landcover.tif", "biomes": {"31": "Moon"}}`, false},
+	// negative trim
+	{`{"name": "BlockIsland", "bounds": {"north": 41.191, "south": 41.189, "east": -71.575, "west": -71.576}, "elevation": "elevation.tif", "landcover": "landcover.tif", "trim": -1}`, false},
+}
+
+var configErrors_tests = []struct {
+	name string
+	load func() error
+	want error
+}{
+	{"missing config", func() error { _, err := LoadRegionConfig("datasets/BlockIsland/none.json"); return err }, ErrMissingDataset},
+	{"malformed config", func() error { _, err := ReadRegionConfig(strings.NewReader(`{"name": `)); return err }, ErrInvalidParameter},
+	{"missing rules", func() error { _, err := LoadRuleTable("rules/none.json"); return err }, ErrMissingDataset},
+	{"malformed rules", func() error { _, err := ReadRuleTable(strings.NewReader(`{"rules": [`)); return err }, ErrInvalidParameter},
+}
+
+func Test_configErrors(t *testing.T) {
+	for _, tt := range configErrors_tests {
+		if err := tt.load(); !errors.Is(err, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, err)
+		}
+	}
+}
+
+func Test_ReadRegionConfig(t *testing.T) {
+	for _, tt := range readRegionConfig_tests {
+		rc, err := ReadRegionConfig(strings.NewReader(tt.json))
+		if tt.ok && err != nil {
+			t.Errorf("given %s, expected success, got %s", tt.json, err)
+		}
+		if !tt.ok && err == nil {
+			t.Errorf("given %s, expected failure, got %+v", tt.json, rc)
+		}
+		if tt.ok && err == nil && (rc.Scale != 6 || rc.TileSize != 256 || rc.SeaLevel != 62) {
+			t.Errorf("given %s, expected defaults, got %+v", tt.json, rc)
+		}
+	}
+}
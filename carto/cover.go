@@ -0,0 +1,106 @@
+package carto
+
+import (
+	"path"
+
+	"github.com/mathuin/gdal"
+	"github.com/mathuin/terroir/world"
+)
+
+// Canopy and impervious surface datasets hold percentages of each pixel
+// covered by tree crowns or by pavement and roofs.  NLCD publishes both
+// on the same grid as its landcover.
+
+// nodata value of the Canopy and Impervious bands
+const coverNodata = -1
+
+// nodata value for warped cover datasets, as used by NLCD
+const coverSourceNodata = 255
+
+// roughly the number of columns under one tree's crown, so that a
+// canopy percentage can become a chance of a tree in each column
+const crownArea = 21
+
+// what impervious surfaces are paved with
+const paving = "Double Stone Slab"
+
+// SetCanopy adds a tree canopy dataset, whose percentages replace the
+// tree densities of the rule table wherever it has data.
+func (r *Region) SetCanopy(name string) {
+	r.setCover("canopy", name)
+}
+
+// SetImpervious adds an impervious surface dataset, whose percentages
+// decide how much of the land is paved.
+func (r *Region) SetImpervious(name string) {
+	r.setCover("impervious", name)
+}
+
+func (r *Region) setCover(key string, name string) {
+	r.vrts[key] = ""
+	if name != "" {
+		r.vrts[key] = path.Join(DatasetDir, r.name, name)
+	}
+}
+
+// cover warps a cover dataset onto the map grid and returns its
+// percentages, with coverNodata wherever there is no data.  Without a
+// dataset every pixel is coverNodata.
+func (r Region) cover(key string, td string, extents IntExtents, xsize int, ysize int) ([]int16, error) {
+	arr := make([]int16, xsize*ysize)
+	if r.vrts[key] == "" {
+		for i := range arr {
+			arr[i] = coverNodata
+		}
+		return arr, nil
+	}
+
+	coverfile := path.Join(td, key+".tif")
+	if err := r.warp(r.vrts[key], coverfile, extents, "bilinear", coverSourceNodata, gdal.Unknown); err != nil {
+		return nil, err
+	}
+	ds, err := gdal.Open(coverfile, gdal.ReadOnly)
+	if err != nil {
+		return nil, wrap(key, ErrMissingDataset, err)
+	}
+	defer ds.Close()
+	if Debug {
+		datasetInfo(ds, key)
+	}
+	if ds.RasterXSize() != xsize || ds.RasterYSize() != ysize {
+		return nil, errorf(key, ErrOutsideRaster, "warped size %dx%d does not match map size %dx%d", ds.RasterXSize(), ds.RasterYSize(), xsize, ysize)
+	}
+	if err := ds.RasterBand(1).IO(gdal.Read, 0, 0, xsize, ysize, arr, xsize, ysize, 0, 0); notnil(err) {
+		return nil, wrap(key, ErrGDAL, err)
+	}
+	return coverPercent(arr), nil
+}
+
+// coverPercent replaces anything which is not a percentage with
+// coverNodata.
+func coverPercent(arr []int16) []int16 {
+	for i, v := range arr {
+		if v < 0 || v > 100 {
+			arr[i] = coverNodata
+		}
+	}
+	return arr
+}
+
+// paved reports whether a column is paved, which is as likely as its
+// impervious percentage.
+func paved(seed int64, xz world.XZ, impervious int16) bool {
+	if impervious <= 0 {
+		return false
+	}
+	return chance(seed, xz, saltPaving)*100 < float64(impervious)
+}
+
+// pave replaces the surface of a land column with the rule's paving.
+func (rule Rule) pave() Rule {
+	rule.Surface = paving
+	if rule.Paving != "" {
+		rule.Surface = rule.Paving
+	}
+	return rule
+}
@@ -0,0 +1,66 @@
+package carto
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mathuin/terroir/world"
+)
+
+func Test_coverPercent(t *testing.T) {
+	got := coverPercent([]int16{0, 50, 100, 101, 255, -5})
+	want := []int16{0, 50, 100, coverNodata, coverNodata, coverNodata}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+var paved_tests = []struct {
+	impervious int16
+	low, high  int
+}{
+	{coverNodata, 0, 0},
+	{0, 0, 0},
+	{25, 2000, 3000},
+	{100, 10000, 10000},
+}
+
+func Test_paved(t *testing.T) {
+	for _, tt := range paved_tests {
+		count := 0
+		for x := int32(0); x < 100; x++ {
+			for z := int32(0); z < 100; z++ {
+				if paved(42, world.XZ{X: x, Z: z}, tt.impervious) {
+					count++
+				}
+			}
+		}
+		if count < tt.low || count > tt.high {
+			t.Errorf("impervious %d: expected %d-%d paved columns, got %d", tt.impervious, tt.low, tt.high, count)
+		}
+	}
+}
+
+var canopyDensities_tests = []struct {
+	trees  map[string]float64
+	canopy int16
+	want   map[string]float64
+}{
+	{nil, 0, map[string]float64{"oak": 0}},
+	{nil, 42, map[string]float64{"oak": 0.42 / crownArea}},
+	{map[string]float64{"oak": 0.03, "birch": 0.01}, 84, map[string]float64{"oak": 0.63 / crownArea, "birch": 0.21 / crownArea}},
+}
+
+func Test_canopyDensities(t *testing.T) {
+	for _, tt := range canopyDensities_tests {
+		got := canopyDensities(tt.trees, tt.canopy)
+		for name, want := range tt.want {
+			if diff := got[name] - want; diff > 1e-9 || diff < -1e-9 {
+				t.Errorf("given %v at %d%%, expected %s %f, got %f", tt.trees, tt.canopy, name, want, got[name])
+			}
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("given %v at %d%%, expected %v, got %v", tt.trees, tt.canopy, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package carto
+
+import (
+	"strings"
+
+	"github.com/mathuin/terroir/world"
+)
+
+// plantBlocks holds the plants a rule may grow, by name, with the blocks
+// they are made of from the bottom up.
+var plantBlocks = map[string][]string{
+	"Grass":            {"Grass"},
+	"Fern":             {"Fern"},
+	"Double Tallgrass": {"Double Tallgrass", "Double Tallgrass Top"},
+	"Large Fern":       {"Large Fern", "Large Fern Top"},
+	"Sunflower":        {"Sunflower", "Sunflower Top"},
+}
+
+// Crop rows are watered by a channel every so many rows, which keeps
+// all of the farmland within the four blocks water reaches.
+const cropRowSpacing = 9
+
+// Row directions: along the long axis of each field, or always
+// north-south or east-west.
+const (
+	RowsAuto       = "auto"
+	RowsNorthSouth = "ns"
+	RowsEastWest   = "ew"
+)
+
+// SetRowDirection sets which way crop rows run: RowsAuto (the default)
+// follows the long axis of each field, and RowsNorthSouth or
+// RowsEastWest run every field the same way.
+func (r *Region) SetRowDirection(dir string) error {
+	dir = strings.ToLower(strings.TrimSpace(dir))
+	switch dir {
+	case "":
+		dir = RowsAuto
+	case RowsAuto, RowsNorthSouth, RowsEastWest:
+	default:
+		return errorf("SetRowDirection", ErrInvalidParameter, "row direction %q must be %s, %s or %s", dir, RowsAuto, RowsNorthSouth, RowsEastWest)
+	}
+	r.rows = dir
+	return nil
+}
+
+// A field is one polygon of farmland, which grows a single crop in rows
+// running one way.
+type field struct {
+	crop       string
+	northSouth bool
+}
+
+// field lays out the crop field for a feature.  The crop is picked by
+// the feature's ID, and in RowsAuto the rows run along the longer side
+// of the feature's envelope.
+func (r Region) field(rule Rule, f Feature) field {
+	fid := world.XZ{X: int32(f.FID())}
+	crop := rule.Crops[hash(r.seed, fid, saltCrop)%uint64(len(rule.Crops))]
+	e := f.Geometry().Envelope()
+	return field{crop: crop, northSouth: rowsNorthSouth(r.rows, e.MaxX()-e.MinX(), e.MaxY()-e.MinY())}
+}
+
+// rowsNorthSouth reports whether rows run north-south in a field of the
+// given width and height.
+func rowsNorthSouth(dir string, width float64, height float64) bool {
+	switch dir {
+	case RowsNorthSouth:
+		return true
+	case RowsEastWest:
+		return false
+	}
+	return height > width
+}
+
+// cropColumn builds the column for one point of a crop field.  Every
+// cropRowSpacing rows there is a water channel level with the farmland,
+// and the other rows grow the field's crop.
+func (rule Rule) cropColumn(xz world.XZ, elev int16, crust int16, maxdepth int, fld field) (Column, error) {
+	row := xz.Z
+	if fld.northSouth {
+		row = xz.X
+	}
+	if mod(row, cropRowSpacing) == 0 {
+		rule.Surface = "Water"
+		column, err := rule.column(xz, elev, 0, crust, maxdepth)
+		column.okspawn = false
+		return column, err
+	}
+	rule.Surface = "Farmland"
+	column, err := rule.column(xz, elev, 0, crust, maxdepth)
+	if err != nil {
+		return Column{}, err
+	}
+	return column.withPlant(fld.crop)
+}
+
+// plant returns the column with a plant on it, if any of the rule's
+// plants grows there.
+func (rule Rule) plant(seed int64, c Column) (Column, error) {
+	name, ok := pick(rule.Plants, chance(seed, c.xz, saltPlant))
+	if !ok {
+		return c, nil
+	}
+	return c.withPlant(plantBlocks[name]...)
+}
+
+// withPlant returns the column with the named blocks stacked on top.
+func (c Column) withPlant(names ...string) (Column, error) {
+	for _, name := range names {
+		b, err := world.BlockNamed(name)
+		if err != nil {
+			return Column{}, wrap("withPlant", ErrInvalidParameter, err)
+		}
+		c.blocks = append(c.blocks, *b)
+	}
+	return c, nil
+}
+
+// mod is the remainder which is never negative.
+func mod(a int32, b int32) int32 {
+	return ((a % b) + b) % b
+}
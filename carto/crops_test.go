@@ -0,0 +1,83 @@
+package carto
+
+import (
+	"testing"
+
+	"github.com/mathuin/terroir/world"
+)
+
+var rowsNorthSouth_tests = []struct {
+	dir           string
+	width, height float64
+	ns            bool
+}{
+	{RowsAuto, 100, 300, true},
+	{RowsAuto, 300, 100, false},
+	{RowsNorthSouth, 300, 100, true},
+	{RowsEastWest, 100, 300, false},
+}
+
+func Test_rowsNorthSouth(t *testing.T) {
+	for _, tt := range rowsNorthSouth_tests {
+		if got := rowsNorthSouth(tt.dir, tt.width, tt.height); got != tt.ns {
+			t.Errorf("given %v, expected %v, got %v", tt, tt.ns, got)
+		}
+	}
+}
+
+var cropColumn_tests = []struct {
+	xz    world.XZ
+	ns    bool
+	top   string
+	spawn bool
+}{
+	{world.XZ{X: 18, Z: 5}, true, "Water", false},
+	{world.XZ{X: 18, Z: 5}, false, "Wheat", true},
+	{world.XZ{X: 5, Z: -9}, false, "Water", false},
+	{world.XZ{X: 5, Z: -8}, false, "Wheat", true},
+}
+
+func Test_cropColumn(t *testing.T) {
+	water, _ := world.BlockNamed("Water")
+	farmland, _ := world.BlockNamed("Farmland")
+	wheat, _ := world.BlockNamed("Wheat")
+	must := columnOf(t)
+	for _, tt := range cropColumn_tests {
+		c := must(cropRule.cropColumn(tt.xz, 70, 3, 30, field{crop: "Wheat", northSouth: tt.ns}))
+		top := c.blocks[len(c.blocks)-1]
+		switch tt.top {
+		case "Water":
+			if len(c.blocks) != 70 || top != *water {
+				t.Errorf("given %v, expected a channel, got %v", tt, c.blocks[len(c.blocks)-2:])
+			}
+		default:
+			if len(c.blocks) != 71 || top != *wheat || c.blocks[69] != *farmland {
+				t.Errorf("given %v, expected wheat on farmland, got %v", tt, c.blocks[len(c.blocks)-2:])
+			}
+		}
+		if c.okspawn != tt.spawn {
+			t.Errorf("given %v, expected okspawn %v, got %v", tt, tt.spawn, c.okspawn)
+		}
+	}
+}
+
+func Test_plant(t *testing.T) {
+	counts := map[int]int{}
+	must := columnOf(t)
+	for x := int32(0); x < 100; x++ {
+		for z := int32(0); z < 100; z++ {
+			xz := world.XZ{X: x, Z: z}
+			c := must(pastureRule.plant(42, must(pastureRule.column(xz, 70, 0, 3, 30))))
+			counts[len(c.blocks)-70]++
+		}
+	}
+	// one block for grass, two for tallgrass and sunflowers
+	for height, want := range map[int]int{0: 5400, 1: 3000, 2: 1600} {
+		if diff := counts[height] - want; diff > want/5 || diff < -want/5 {
+			t.Errorf("expected about %d plants %d blocks high, got %d", want, height, counts[height])
+		}
+	}
+	if c := must(NLCDRules.Default.plant(42, must(NLCDRules.Default.column(world.XZ{}, 70, 0, 3, 30)))); len(c.blocks) != 70 {
+		t.Errorf("expected no plants without any in the rule, got %d blocks", len(c.blocks))
+	}
+}
@@ -6,10 +6,8 @@ import (
 	"github.com/mathuin/terroir/idt"
 )
 
-func (r Region) crust(rXsize int, rYsize int) []int16 {
-	minwidth := 1
-	maxwidth := 5
-	crustrange := maxwidth - minwidth
+func (r Region) crust(rXsize int, rYsize int) ([]int16, error) {
+	crustrange := maxCrust - minCrust
 	coverage := 0.05
 
 	bufferLen := rXsize * rYsize
@@ -19,7 +17,7 @@ func (r Region) crust(rXsize int, rYsize int) []int16 {
 	crustValues := make([]int, numcoords)
 	for i := range crustCoords {
 		crustCoords[i] = [2]float64{float64(rand.Intn(rXsize)), float64(rand.Intn(rYsize))}
-		crustValues[i] = (rand.Int() % crustrange) + minwidth
+		crustValues[i] = (rand.Int() % crustrange) + minCrust
 	}
 
 	crustBase := make([][2]int, bufferLen)
@@ -28,11 +26,11 @@ func (r Region) crust(rXsize int, rYsize int) []int16 {
 	}
 	crustIDT, err := idt.NewIDT(crustCoords, crustValues)
 	if err != nil {
-		panic(err)
+		return nil, wrap("crust", ErrInvalidParameter, err)
 	}
 	crustBuffer, err := crustIDT.Call(crustBase, 31, false)
 	if err != nil {
-		panic(err)
+		return nil, wrap("crust", ErrInvalidParameter, err)
 	}
-	return crustBuffer
+	return crustBuffer, nil
 }
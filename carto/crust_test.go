@@ -6,8 +6,14 @@ import (
 )
 
 func Test_crust(t *testing.T) {
-	r := MakeRegion("Pie", FloatExtents{-71.575, -71.576, 41.189, 41.191}, "", "")
-	crustBuffer := r.crust(100, 150)
+	r, err := MakeRegion("Pie", FloatExtents{-71.575, -71.576, 41.189, 41.191}, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	crustBuffer, err := r.crust(100, 150)
+	if err != nil {
+		t.Fatal(err)
+	}
 	minwidth := int16(1)
 	maxwidth := int16(5)
 	for _, v := range crustBuffer {
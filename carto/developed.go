@@ -0,0 +1,157 @@
+package carto
+
+import (
+	"fmt"
+
+	"github.com/mathuin/terroir/world"
+)
+
+// Buildings stand on a grid of square lots, at most one to a lot, with
+// their corner on the corner of the lot.  Footprints leave room for a
+// street between lots.
+const (
+	lotSize         = 12
+	minBuildingSide = 5
+	maxBuildingSide = lotSize - 3
+	storyHeight     = 4
+	defaultStories  = 2
+)
+
+// what buildings are built of
+var (
+	buildingWalls = []string{"Bricks", "Stone Bricks", "Smooth Sandstone", "White Stained Clay", "Oak Wood Planks"}
+	buildingFloor = "Oak Wood Planks"
+	buildingRoof  = "Double Stone Slab"
+	buildingGlass = "Glass"
+)
+
+// how far a foundation reaches down to the ground
+const maxFoundation = 8
+
+// A building is a box with walls, windows, a door, a floor and a flat
+// roof.  Its corner is the base, and it reaches width blocks east and
+// depth blocks south.
+type building struct {
+	width  int32
+	depth  int32
+	height int32
+	wall   string
+}
+
+// imperviousness returns the impervious percentage of a column, which
+// is the rule's paved share wherever there is no impervious data.
+func (rule Rule) imperviousness(impervious int16) int16 {
+	if impervious == coverNodata {
+		return int16(rule.Paved * 100)
+	}
+	return impervious
+}
+
+// building picks the building, if any, which stands on a column.  Only
+// the corners of lots have buildings, as often as the rule's building
+// density says.
+func (rule Rule) building(seed int64, xz world.XZ) (building, bool) {
+	if rule.Buildings == 0 || mod(xz.X, lotSize) != 0 || mod(xz.Z, lotSize) != 0 {
+		return building{}, false
+	}
+	if chance(seed, xz, saltBuilding) >= rule.Buildings {
+		return building{}, false
+	}
+	h := hash(seed, xz, saltBuildingShape)
+	sides := uint64(maxBuildingSide - minBuildingSide + 1)
+	stories := rule.Stories
+	if stories == 0 {
+		stories = defaultStories
+	}
+	return building{
+		width:  minBuildingSide + int32(h%sides),
+		depth:  minBuildingSide + int32(h/sides%sides),
+		height: storyHeight * (1 + int32(h/sides/sides%uint64(stories))),
+		wall:   buildingWalls[h/sides/sides/uint64(stories)%uint64(len(buildingWalls))],
+	}, true
+}
+
+// build writes the building.  Its floor is level with the base, the
+// ground beneath is filled with foundation, and anything inside is
+// cleared.
+func (b building) build(w *world.World, base world.Point) error {
+	blocks := map[string]world.Block{}
+	for _, name := range []string{b.wall, buildingFloor, buildingRoof, buildingGlass, "Air"} {
+		block, err := world.BlockNamed(name)
+		if err != nil {
+			return err
+		}
+		blocks[name] = *block
+	}
+	air := blocks["Air"]
+
+	set := func(x, y, z int32, name string) error {
+		if err := w.SetBlock(world.MakePoint(base.X+x, base.Y+y, base.Z+z), blocks[name]); err != nil {
+			return fmt.Errorf("building at %s: %s", base, err)
+		}
+		return nil
+	}
+
+	for z := int32(0); z < b.depth; z++ {
+		for x := int32(0); x < b.width; x++ {
+			edge := x == 0 || z == 0 || x == b.width-1 || z == b.depth-1
+
+			// foundation down to the ground
+			for y := int32(-1); y >= -maxFoundation; y-- {
+				below, err := w.Block(world.MakePoint(base.X+x, base.Y+y, base.Z+z))
+				if err != nil {
+					return fmt.Errorf("building at %s: %s", base, err)
+				}
+				if *below != air {
+					break
+				}
+				if err := set(x, y, z, b.wall); err != nil {
+					return err
+				}
+			}
+
+			for y := int32(0); y <= b.height; y++ {
+				name := "Air"
+				switch {
+				case y == 0:
+					name = buildingFloor
+				case y == b.height:
+					name = buildingRoof
+				case y%storyHeight == 0:
+					name = buildingFloor
+				case edge:
+					name = b.wall
+					if b.door(x, z, y) {
+						name = "Air"
+					} else if b.window(x, z, y) {
+						name = buildingGlass
+					}
+				}
+				if err := set(x, y, z, name); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// door reports whether a block of wall is the door, two blocks high in
+// the middle of the south wall.
+func (b building) door(x, z, y int32) bool {
+	return z == b.depth-1 && x == b.width/2 && (y == 1 || y == 2)
+}
+
+// window reports whether a block of wall is a window: every other block
+// along each wall, away from the corners, in the middle of each story.
+func (b building) window(x, z, y int32) bool {
+	if y%storyHeight != 2 {
+		return false
+	}
+	along := x
+	if x == 0 || x == b.width-1 {
+		along = z
+	}
+	corner := (x == 0 || x == b.width-1) && (z == 0 || z == b.depth-1)
+	return !corner && along%2 == 0
+}
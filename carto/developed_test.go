@@ -0,0 +1,105 @@
+package carto
+
+import (
+	"testing"
+
+	"github.com/mathuin/terroir/world"
+)
+
+var imperviousness_tests = []struct {
+	rule       Rule
+	impervious int16
+	want       int16
+}{
+	{highIntensityRule, coverNodata, 90},
+	{highIntensityRule, 15, 15},
+	{NLCDRules.Default, coverNodata, 0},
+	{openSpaceRule, coverNodata, 5},
+}
+
+func Test_imperviousness(t *testing.T) {
+	for _, tt := range imperviousness_tests {
+		if got := tt.rule.imperviousness(tt.impervious); got != tt.want {
+			t.Errorf("given %v, expected %d, got %d", tt.impervious, tt.want, got)
+		}
+	}
+}
+
+func Test_building(t *testing.T) {
+	lots, buildings := 0, 0
+	for x := int32(-120); x < 120; x++ {
+		for z := int32(-120); z < 120; z++ {
+			xz := world.XZ{X: x, Z: z}
+			b, ok := mediumIntensityRule.building(42, xz)
+			if mod(x, lotSize) == 0 && mod(z, lotSize) == 0 {
+				lots++
+			} else if ok {
+				t.Fatalf("building at %v is not on a lot corner", xz)
+			}
+			if !ok {
+				continue
+			}
+			buildings++
+			if b.width < minBuildingSide || b.width > maxBuildingSide || b.depth < minBuildingSide || b.depth > maxBuildingSide {
+				t.Errorf("building at %v is %dx%d", xz, b.width, b.depth)
+			}
+			if b.height%storyHeight != 0 || b.height > storyHeight*int32(mediumIntensityRule.Stories) {
+				t.Errorf("building at %v is %d high", xz, b.height)
+			}
+			if again, _ := mediumIntensityRule.building(42, xz); again != b {
+				t.Errorf("building at %v is not deterministic", xz)
+			}
+		}
+	}
+	if want := int(float64(lots) * mediumIntensityRule.Buildings); buildings < want*4/5 || buildings > want*6/5 {
+		t.Errorf("expected about %d buildings on %d lots, got %d", want, lots, buildings)
+	}
+	if _, ok := openSpaceRule.building(42, world.XZ{}); ok {
+		t.Error("expected no buildings in open space")
+	}
+}
+
+func Test_buildingBuild(t *testing.T) {
+	w := world.MakeWorld("buildings")
+	stone, _ := world.BlockNamed("Stone")
+	for x := int32(0); x < lotSize; x++ {
+		for z := int32(0); z < lotSize; z++ {
+			w.SetBlock(world.MakePoint(x, 63, z), *stone)
+			// a hill inside the footprint
+			if x == 2 && z == 2 {
+				w.SetBlock(world.MakePoint(x, 64, z), *stone)
+				w.SetBlock(world.MakePoint(x, 65, z), *stone)
+			}
+		}
+	}
+	b := building{width: 7, depth: 6, height: 2 * storyHeight, wall: "Bricks"}
+	base := world.MakePoint(0, 64, 0)
+	if err := b.build(&w, base); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[world.Point]string{
+		world.MakePoint(0, 64, 0):                 buildingFloor,
+		world.MakePoint(0, 65, 0):                 "Bricks",
+		world.MakePoint(2, 65, 2):                 "Air",
+		world.MakePoint(3, 65, 5):                 "Air",
+		world.MakePoint(3, 66, 5):                 "Air",
+		world.MakePoint(3, 67, 5):                 "Bricks",
+		world.MakePoint(0, 66, 2):                 buildingGlass,
+		world.MakePoint(3, 64+storyHeight, 3):     buildingFloor,
+		world.MakePoint(6, 64+2*storyHeight, 5):   buildingRoof,
+		world.MakePoint(7, 65, 0):                 "Air",
+		world.MakePoint(0, 64+2*storyHeight+1, 0): "Air",
+		world.MakePoint(0, 63, 0):                 "Stone",
+	}
+	for pt, name := range expected {
+		want, _ := world.BlockNamed(name)
+		got, err := w.Block(pt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *got != *want {
+			t.Errorf("at %s expected %s, got %v", pt, name, *got)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package carto
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kinds of failure, for use with errors.Is.
+var (
+	// ErrMissingDataset means a source dataset or map file could not be
+	// opened.
+	ErrMissingDataset = errors.New("missing dataset")
+	// ErrOutsideRaster means the region extends beyond a raster.
+	ErrOutsideRaster = errors.New("extents outside raster")
+	// ErrProjection means a spatial reference could not be built or a
+	// point could not be transformed.
+	ErrProjection = errors.New("projection failure")
+	// ErrInvalidParameter means a region parameter is out of range.
+	ErrInvalidParameter = errors.New("invalid region parameter")
+	// ErrGDAL means GDAL failed while reading, writing or processing a
+	// raster.
+	ErrGDAL = errors.New("GDAL failure")
+)
+
+// An Error records the operation which failed, the kind of failure, and
+// the underlying error if there is one.
+type Error struct {
+	Op   string
+	Kind error
+	Err  error
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("%s: %s", e.Op, e.Kind)
+	}
+	return fmt.Sprintf("%s: %s: %s", e.Op, e.Kind, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the target is the kind of this error.
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+// wrap returns an Error of the given kind for err, or nil if there was
+// no error.  GDAL reports success as "No Error", which counts as none.
+func wrap(op string, kind error, err error) error {
+	if !notnil(err) {
+		return nil
+	}
+	return &Error{Op: op, Kind: kind, Err: err}
+}
+
+// errorf returns an Error of the given kind with a formatted message.
+func errorf(op string, kind error, format string, args ...interface{}) error {
+	return &Error{Op: op, Kind: kind, Err: fmt.Errorf(format, args...)}
+}
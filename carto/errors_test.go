@@ -0,0 +1,76 @@
+package carto
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+var wrap_tests = []struct {
+	err  error
+	want error
+}{
+	{nil, nil},
+	{errors.New("No Error"), nil},
+	{errors.New("band 4 read failed"), ErrGDAL},
+}
+
+func Test_wrap(t *testing.T) {
+	for _, tt := range wrap_tests {
+		err := wrap("Test", ErrGDAL, tt.err)
+		if tt.want == nil {
+			if err != nil {
+				t.Errorf("given %v, expected nil, got %v", tt.err, err)
+			}
+			continue
+		}
+		if !errors.Is(err, tt.want) {
+			t.Errorf("given %v, expected %v, got %v", tt.err, tt.want, err)
+		}
+		if errors.Unwrap(err) != tt.err {
+			t.Errorf("given %v, expected to unwrap to it, got %v", tt.err, errors.Unwrap(err))
+		}
+	}
+}
+
+func Test_Error(t *testing.T) {
+	err := fmt.Errorf("region.json: %w", errorf("config", ErrMissingDataset, "elevation.tif not found"))
+	if !errors.Is(err, ErrMissingDataset) {
+		t.Errorf("expected ErrMissingDataset, got %v", err)
+	}
+	if errors.Is(err, ErrProjection) {
+		t.Errorf("did not expect ErrProjection, got %v", err)
+	}
+	var e *Error
+	if !errors.As(err, &e) || e.Op != "config" {
+		t.Errorf("expected an *Error for config, got %v", err)
+	}
+	if got, want := err.Error(), "region.json: config: missing dataset: elevation.tif not found"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+var makeRegionFull_tests = []struct {
+	scale    int
+	vscale   int
+	trim     int
+	tilesize int
+	sealevel int
+	maxdepth int
+}{
+	{0, 6, 0, 256, 62, 30},
+	{6, 0, 0, 256, 62, 30},
+	{6, 6, -1, 256, 62, 30},
+	{6, 6, 0, 0, 62, 30},
+	{6, 6, 0, 256, 0, 30},
+	{6, 6, 0, 256, 62, 0},
+}
+
+func Test_MakeRegionFull(t *testing.T) {
+	for _, tt := range makeRegionFull_tests {
+		_, err := MakeRegionFull("Pie", FloatExtents{-71.575, -71.576, 41.189, 41.191}, "", "", tt.scale, tt.vscale, tt.trim, tt.tilesize, tt.sealevel, tt.maxdepth)
+		if !errors.Is(err, ErrInvalidParameter) {
+			t.Errorf("given %+v, expected ErrInvalidParameter, got %v", tt, err)
+		}
+	}
+}
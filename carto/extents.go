@@ -49,9 +49,12 @@ const (
 	yMin
 )
 
-func (r Region) generateExtents() {
-	// get corners from wgs to albers
-	marr := getCorners(wgs84_proj, albers_proj, r.ll)
+func (r Region) generateExtents() error {
+	// get corners from wgs to the map projection
+	marr, err := getCorners(wgs84_proj, r.proj, r.ll)
+	if err != nil {
+		return err
+	}
 
 	realsize := r.scale * r.tilesize
 
@@ -69,13 +72,13 @@ func (r Region) generateExtents() {
 	for i, v := range tiles {
 		nae[i] = v * realsize
 	}
-	r.albers["elevation"] = nae
+	r.projected["elevation"] = nae
 
 	// landcover requires a maxdepth-sized border for calculating depth
 	borderwidth := r.maxdepth * r.scale
 
 	var nal IntExtents
-	for i, v := range r.albers["elevation"] {
+	for i, v := range r.projected["elevation"] {
 		// i % 2 == 0 for "maxes"
 		if i%2 == 0 {
 			nal[i] = v + borderwidth
@@ -83,17 +86,21 @@ func (r Region) generateExtents() {
 			nal[i] = v - borderwidth
 		}
 	}
-	r.albers["landcover"] = nal
+	r.projected["landcover"] = nal
 
-	// get corners from albers back to wgs
-	for maptype := range r.albers {
-		r.wgs84[maptype] = getCorners(albers_proj, wgs84_proj, r.albers[maptype])
+	// get corners from the map projection back to wgs
+	for maptype := range r.projected {
+		wgs, err := getCorners(r.proj, wgs84_proj, r.projected[maptype])
+		if err != nil {
+			return err
+		}
+		r.wgs84[maptype] = wgs
 	}
 
-	return
+	return nil
 }
 
-func getCorners(fromCS string, toCS string, in Extents) FloatExtents {
+func getCorners(fromCS string, toCS string, in Extents) (FloatExtents, error) {
 	if Debug {
 		log.Print("getCorners: ")
 		log.Print("  fromCS: ", fromCS)
@@ -101,10 +108,14 @@ func getCorners(fromCS string, toCS string, in Extents) FloatExtents {
 		log.Print("  in: ", in)
 	}
 
-	fromSR := gdal.CreateSpatialReference("")
-	fromSR.FromProj4(fromCS)
-	toSR := gdal.CreateSpatialReference("")
-	toSR.FromProj4(toCS)
+	fromSR, err := spatialReference(fromCS)
+	if err != nil {
+		return FloatExtents{}, err
+	}
+	toSR, err := spatialReference(toCS)
+	if err != nil {
+		return FloatExtents{}, err
+	}
 
 	fe := in.floats()
 	xmax := fe[0]
@@ -127,14 +138,16 @@ func getCorners(fromCS string, toCS string, in Extents) FloatExtents {
 		}
 		point, err := gdal.CreateFromWKT(wkt, fromSR)
 		if notnil(err) {
-			panic(err)
+			return FloatExtents{}, wrap("getCorners", ErrProjection, err)
+		}
+		if err := point.TransformTo(toSR); notnil(err) {
+			return FloatExtents{}, wrap("getCorners", ErrProjection, err)
 		}
-		point.TransformTo(toSR)
 		if Debug {
 			log.Printf("    after: (%f %f)", point.X(0), point.Y(0))
 		}
 		xfloat = append(xfloat, point.X(0))
 		yfloat = append(yfloat, point.Y(0))
 	}
-	return FloatExtents{xfloat.max(), xfloat.min(), yfloat.max(), yfloat.min()}
+	return FloatExtents{xfloat.max(), xfloat.min(), yfloat.max(), yfloat.min()}, nil
 }
@@ -4,10 +4,11 @@ import "testing"
 
 var generateExtents_tests = []struct {
 	ll     FloatExtents
+	proj   string
 	albers map[string]IntExtents
 	wgs84  map[string]FloatExtents
 }{
-	{FloatExtents{-71.533, -71.62, 41.238, 41.142},
+	{FloatExtents{-71.533, -71.62, 41.238, 41.142}, AlbersProjection,
 		map[string]IntExtents{
 			"elevation": {2015232, 2002944, 2291712, 2273280},
 			"landcover": {2015412, 2002764, 2291892, 2273100},
@@ -21,13 +22,18 @@ var generateExtents_tests = []struct {
 
 func Test_generateExtents(t *testing.T) {
 	for _, tt := range generateExtents_tests {
-		r := MakeRegion("Pie", tt.ll, "", "")
+		r, err := MakeRegion("Pie", tt.ll, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
 		r.tilesize = 1024
-		r.generateExtents()
+		if err := r.SetProjection(tt.proj); err != nil {
+			t.Fatal(err)
+		}
 		for maptype, subarr := range tt.albers {
 			for coord, value := range subarr {
-				if r.albers[maptype][coord] != value {
-					t.Errorf("albers %s: given %+#v, expected %+#v, got %+#v", maptype, tt.ll, tt.albers[maptype], r.albers[maptype])
+				if r.projected[maptype][coord] != value {
+					t.Errorf("albers %s: given %+#v, expected %+#v, got %+#v", maptype, tt.ll, tt.albers[maptype], r.projected[maptype])
 					break
 				}
 			}
@@ -56,7 +62,10 @@ var getCorners_tests = []struct {
 
 func Test_getCorners(t *testing.T) {
 	for _, tt := range getCorners_tests {
-		out := getCorners(tt.fromCS, tt.toCS, tt.in)
+		out, err := getCorners(tt.fromCS, tt.toCS, tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
 		for i, v := range out {
 			if tt.out[i] != v {
 				t.Errorf("Given %s %s %v, wanted %+#v, got %+#v", tt.fromCS, tt.toCS, tt.in, tt.out, out)
@@ -65,3 +74,43 @@ func Test_getCorners(t *testing.T) {
 		}
 	}
 }
+
+var generateExtentsProjected_tests = []struct {
+	name string
+	ll   FloatExtents
+	proj string
+}{
+	{"MontSaintMichel", FloatExtents{-1.49, -1.53, 48.65, 48.62}, UTMProjection},
+	{"Dolomites", FloatExtents{12.2, 11.8, 46.6, 46.4}, LambertProjection},
+	{"Snowdonia", FloatExtents{-3.9, -4.2, 53.1, 52.9}, "EPSG:27700"},
+}
+
+// Outside the US the exact numbers depend on the projection, so check
+// the properties the map relies on instead.
+func Test_generateExtentsProjected(t *testing.T) {
+	for _, tt := range generateExtentsProjected_tests {
+		r, err := MakeRegion(tt.name, tt.ll, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := r.SetProjection(tt.proj); err != nil {
+			t.Fatal(err)
+		}
+		realsize := r.scale * r.tilesize
+		el := r.projected["elevation"]
+		lc := r.projected["landcover"]
+		border := r.maxdepth * r.scale
+		for i, v := range el {
+			if v%realsize != 0 {
+				t.Errorf("%s: elevation extent %d (%d) is not a multiple of %d", tt.name, i, v, realsize)
+			}
+			if i%2 == 0 && lc[i] != v+border || i%2 == 1 && lc[i] != v-border {
+				t.Errorf("%s: landcover extents %v are not elevation extents %v plus a %d border", tt.name, lc, el, border)
+			}
+		}
+		wgs := r.wgs84["elevation"]
+		if wgs[xMax] < tt.ll[xMax] || wgs[xMin] > tt.ll[xMin] || wgs[yMax] < tt.ll[yMax] || wgs[yMin] > tt.ll[yMin] {
+			t.Errorf("%s: elevation extents %v do not contain %v", tt.name, wgs, tt.ll)
+		}
+	}
+}
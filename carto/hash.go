@@ -0,0 +1,74 @@
+package carto
+
+import (
+	"sort"
+
+	"github.com/mathuin/terroir/world"
+)
+
+// Salts keep the random choices made for one column independent of each
+// other.
+const (
+	saltTree uint64 = iota + 1
+	saltTreeHeight
+	saltLeaves
+	saltPaving
+	saltPlant
+	saltCrop
+	saltBuilding
+	saltBuildingShape
+	saltVillageLot
+	saltVillager
+	saltCave
+	saltTunnel
+	saltRavine
+	saltRavineAngle
+	saltRavineFloor
+	saltOre
+	saltBedrock
+	saltGranite
+	saltDiorite
+	saltAndesite
+)
+
+// hash mixes the region seed, a column and a salt into a well-spread
+// 64-bit value.  Every random choice is a hash of where it is made, so
+// the same seed always builds the same world no matter which worker
+// handles which column.
+func hash(seed int64, xz world.XZ, salt uint64) uint64 {
+	h := uint64(seed)
+	for _, v := range []uint64{uint64(uint32(xz.X)), uint64(uint32(xz.Z)), salt} {
+		h = splitmix(h ^ v)
+	}
+	return h
+}
+
+// splitmix is the SplitMix64 finalizer.
+func splitmix(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// chance returns a hash as a number in [0, 1).
+func chance(seed int64, xz world.XZ, salt uint64) float64 {
+	return float64(hash(seed, xz, salt)>>11) / (1 << 53)
+}
+
+// pick chooses a name, each covering a share of the rolls equal to its
+// density, or returns false if the roll is past them all.
+func pick(densities map[string]float64, roll float64) (string, bool) {
+	names := make([]string, 0, len(densities))
+	for name := range densities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		roll -= densities[name]
+		if roll < 0 {
+			return name, true
+		}
+	}
+	return "", false
+}
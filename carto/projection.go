@@ -0,0 +1,94 @@
+package carto
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/mathuin/gdal"
+)
+
+// Projection keywords.  Anything else is passed to GDAL, which accepts
+// proj4 strings, WKT, and EPSG codes such as "EPSG:3035".
+const (
+	// AlbersProjection is the CONUS Albers Equal Area projection.
+	AlbersProjection = "albers"
+	// UTMProjection picks the UTM zone containing the region.
+	UTMProjection = "utm"
+	// LambertProjection builds a Lambert Conformal Conic projection
+	// centered on the region.
+	LambertProjection = "lambert"
+)
+
+// projection turns a projection specification into a definition GDAL
+// understands.  Keywords are resolved against the latlong extents.
+func projection(spec string, ll FloatExtents) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(spec)) {
+	case "", AlbersProjection:
+		return albers_proj, nil
+	case UTMProjection:
+		return utmProj(ll), nil
+	case LambertProjection, "lcc":
+		return lambertProj(ll), nil
+	}
+	if _, err := spatialReference(spec); err != nil {
+		return "", err
+	}
+	return spec, nil
+}
+
+// utmZone returns the UTM zone containing the center of the extents,
+// and whether that center is north of the equator.
+func utmZone(ll FloatExtents) (int, bool) {
+	lon := (ll[xMax] + ll[xMin]) / 2
+	lat := (ll[yMax] + ll[yMin]) / 2
+	zone := int(math.Floor((lon+180)/6)) + 1
+	if zone > 60 {
+		zone = 60
+	}
+	return zone, lat >= 0
+}
+
+func utmProj(ll FloatExtents) string {
+	zone, north := utmZone(ll)
+	south := ""
+	if !north {
+		south = " +south"
+	}
+	return fmt.Sprintf("+proj=utm +zone=%d%s +datum=WGS84 +units=m +no_defs", zone, south)
+}
+
+// lambertProj puts the standard parallels one sixth of the way in from
+// the northern and southern edges of the region.
+func lambertProj(ll FloatExtents) string {
+	span := ll[yMax] - ll[yMin]
+	lat1 := ll[yMin] + span/6
+	lat2 := ll[yMax] - span/6
+	lat0 := (ll[yMax] + ll[yMin]) / 2
+	lon0 := (ll[xMax] + ll[xMin]) / 2
+	return fmt.Sprintf("+proj=lcc +lat_1=%f +lat_2=%f +lat_0=%f +lon_0=%f +x_0=0 +y_0=0 +datum=WGS84 +units=m +no_defs", lat1, lat2, lat0, lon0)
+}
+
+func spatialReference(def string) (gdal.SpatialReference, error) {
+	sr := gdal.CreateSpatialReference("")
+	if err := sr.SetFromUserInput(def); notnil(err) {
+		return sr, errorf("projection", ErrProjection, "%q: %s", def, err)
+	}
+	return sr, nil
+}
+
+// sameProjection reports whether a dataset is already in the projection
+// of a definition, so that it can be read without warping.
+func sameProjection(filename string, def string) (bool, error) {
+	ds, err := gdal.Open(filename, gdal.ReadOnly)
+	if err != nil {
+		return false, wrap("projection", ErrMissingDataset, err)
+	}
+	defer ds.Close()
+	mapSRS, err := spatialReference(def)
+	if err != nil {
+		return false, err
+	}
+	dsSRS := gdal.CreateSpatialReference(ds.Projection())
+	return dsSRS.IsSame(mapSRS), nil
+}
@@ -0,0 +1,52 @@
+package carto
+
+import "testing"
+
+var utmZone_tests = []struct {
+	ll    FloatExtents
+	zone  int
+	north bool
+}{
+	// Block Island
+	{FloatExtents{-71.533, -71.62, 41.238, 41.142}, 19, true},
+	// Mont Saint-Michel
+	{FloatExtents{-1.49, -1.53, 48.65, 48.62}, 30, true},
+	// Sydney Harbour
+	{FloatExtents{151.3, 151.15, -33.8, -33.9}, 56, false},
+	// the antimeridian
+	{FloatExtents{180, 179.9, 0.1, 0}, 60, true},
+}
+
+func Test_utmZone(t *testing.T) {
+	for _, tt := range utmZone_tests {
+		zone, north := utmZone(tt.ll)
+		if zone != tt.zone || north != tt.north {
+			t.Errorf("given %v, expected zone %d north %v, got zone %d north %v", tt.ll, tt.zone, tt.north, zone, north)
+		}
+	}
+}
+
+var projection_tests = []struct {
+	spec string
+	ll   FloatExtents
+	out  string
+}{
+	{"", FloatExtents{-71.533, -71.62, 41.238, 41.142}, albers_proj},
+	{"Albers", FloatExtents{-71.533, -71.62, 41.238, 41.142}, albers_proj},
+	{"utm", FloatExtents{-1.49, -1.53, 48.65, 48.62}, "+proj=utm +zone=30 +datum=WGS84 +units=m +no_defs"},
+	{"utm", FloatExtents{151.3, 151.15, -33.8, -33.9}, "+proj=utm +zone=56 +south +datum=WGS84 +units=m +no_defs"},
+	{"lambert", FloatExtents{16, 10, 50, 44}, "+proj=lcc +lat_1=45.000000 +lat_2=49.000000 +lat_0=47.000000 +lon_0=13.000000 +x_0=0 +y_0=0 +datum=WGS84 +units=m +no_defs"},
+}
+
+func Test_projection(t *testing.T) {
+	for _, tt := range projection_tests {
+		out, err := projection(tt.spec, tt.ll)
+		if err != nil {
+			t.Errorf("given %q, got error %s", tt.spec, err)
+			continue
+		}
+		if out != tt.out {
+			t.Errorf("given %q %v, expected %q, got %q", tt.spec, tt.ll, tt.out, out)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package carto
+
+import (
+	"math"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/mathuin/gdal"
+	"github.com/mathuin/terroir/world"
+)
+
+// Hydrography defaults: lines become channels this many meters wide,
+// and channels are carved this many blocks deep.
+const (
+	defaultRiverWidth = 12.0
+	defaultRiverDepth = 2
+)
+
+// what rivers flow over
+const riverbed = "Sand"
+
+// SetHydrography adds a hydrography layer, any vector file OGR can read
+// such as a shapefile or GeoPackage.  Polygons are burned into the River
+// band as they are, while lines are first widened to width meters.
+// Channels are carved depth blocks deep.  A width or depth of zero takes
+// the default.
+func (r *Region) SetHydrography(name string, width float64, depth int) error {
+	if width < 0 {
+		return errorf("SetHydrography", ErrInvalidParameter, "river width %f must be at least 0", width)
+	}
+	if depth < 0 {
+		return errorf("SetHydrography", ErrInvalidParameter, "river depth %d must be at least 0", depth)
+	}
+	if width == 0 {
+		width = defaultRiverWidth
+	}
+	if depth == 0 {
+		depth = defaultRiverDepth
+	}
+	r.vrts["hydrography"] = ""
+	if name != "" {
+		r.vrts["hydrography"] = path.Join(DatasetDir, r.name, name)
+	}
+	r.riverwidth = width
+	r.riverdepth = depth
+	return nil
+}
+
+// rivers burns the hydrography layer onto the map grid, returning the
+// channel depth of each pixel, or zero where there is no river.
+func (r Region) rivers(xsize int, ysize int, gt [6]float64) ([]int16, error) {
+	arr := make([]int16, xsize*ysize)
+	if r.vrts["hydrography"] == "" {
+		return arr, nil
+	}
+
+	mapSR, err := spatialReference(r.proj)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(r.vrts["hydrography"]); err != nil {
+		return nil, wrap("rivers", ErrMissingDataset, err)
+	}
+	ds := gdal.OpenDataSource(r.vrts["hydrography"], 0)
+	defer ds.Destroy()
+	lc := ds.LayerCount()
+	if lc == 0 {
+		return nil, errorf("rivers", ErrMissingDataset, "no layers in %s", r.vrts["hydrography"])
+	}
+
+	for l := 0; l < lc; l++ {
+		layer := ds.LayerByIndex(l)
+		fc, ok := layer.FeatureCount(true)
+		if !ok {
+			return nil, errorf("rivers", ErrGDAL, "layer %d FeatureCount NOT OK", l)
+		}
+		layer.ResetReading()
+		for i := 0; i < fc; i++ {
+			f := layer.NextFeature()
+			g := f.Geometry().Clone()
+			if err := g.TransformTo(mapSR); notnil(err) {
+				return nil, wrap("rivers", ErrProjection, err)
+			}
+			switch g.Type() {
+			case gdal.GT_Polygon, gdal.GT_MultiPolygon:
+			default:
+				b := g.Buffer(r.riverwidth/2, 8)
+				g.Destroy()
+				g = b
+			}
+			burn(arr, g, int16(r.riverdepth), xsize, ysize, gt)
+			g.Destroy()
+			f.Destroy()
+		}
+	}
+	return arr, nil
+}
+
+// burn sets every pixel whose center is inside the geometry to value,
+// unless it already has a value no greater.  The geometry is filled a
+// row at a time from the crossings of its rings with the row of pixel
+// centers, even-odd so that holes stay empty.
+func burn(arr []int16, g gdal.Geometry, value int16, xsize int, ysize int, gt [6]float64) {
+	if g.IsEmpty() {
+		return
+	}
+	fill(arr, rings(g, nil), value, xsize, ysize, gt)
+}
+
+// rings appends the rings of a polygon, or of every polygon in a
+// collection, as lists of points.
+func rings(g gdal.Geometry, rs [][][2]float64) [][][2]float64 {
+	if n := g.GeometryCount(); n > 0 {
+		for i := 0; i < n; i++ {
+			rs = rings(g.Geometry(i), rs)
+		}
+		return rs
+	}
+	ring := make([][2]float64, g.PointCount())
+	for i := range ring {
+		ring[i] = [2]float64{g.X(i), g.Y(i)}
+	}
+	return append(rs, ring)
+}
+
+// fill burns the area inside the rings, as burn does.
+func fill(arr []int16, rs [][][2]float64, value int16, xsize int, ysize int, gt [6]float64) {
+	minx, maxx, miny, maxy := math.Inf(1), math.Inf(-1), math.Inf(1), math.Inf(-1)
+	for _, ring := range rs {
+		for _, p := range ring {
+			minx, maxx = math.Min(minx, p[0]), math.Max(maxx, p[0])
+			miny, maxy = math.Min(miny, p[1]), math.Max(maxy, p[1])
+		}
+	}
+	if minx > maxx {
+		return
+	}
+	x0, x1, y0, y1 := window(minx, maxx, miny, maxy, gt, xsize, ysize)
+	crossings := []float64{}
+	for y := y0; y < y1; y++ {
+		yc := gt[3] + (float64(y)+0.5)*gt[5]
+		crossings = crossings[:0]
+		for _, ring := range rs {
+			for i := range ring {
+				a, b := ring[i], ring[(i+1)%len(ring)]
+				if (a[1] > yc) != (b[1] > yc) {
+					crossings = append(crossings, a[0]+(yc-a[1])*(b[0]-a[0])/(b[1]-a[1]))
+				}
+			}
+		}
+		sort.Float64s(crossings)
+		for i := 0; i+1 < len(crossings); i += 2 {
+			// pixels whose centers are from one crossing up to the next
+			xa := max(int(math.Ceil((crossings[i]-gt[0])/gt[1]-0.5)), x0)
+			xb := min(int(math.Ceil((crossings[i+1]-gt[0])/gt[1]-0.5)), x1)
+			for x := xa; x < xb; x++ {
+				if old := arr[x+y*xsize]; old == 0 || old > value {
+					arr[x+y*xsize] = value
+				}
+			}
+		}
+	}
+}
+
+// window returns the range of pixels, clipped to the raster, which may
+// have centers inside the envelope.
+func window(minx float64, maxx float64, miny float64, maxy float64, gt [6]float64, xsize int, ysize int) (x0 int, x1 int, y0 int, y1 int) {
+	x0 = int(math.Floor((minx - gt[0]) / gt[1]))
+	x1 = int(math.Ceil((maxx - gt[0]) / gt[1]))
+	// north up, so maxy is the first row
+	y0 = int(math.Floor((maxy - gt[3]) / gt[5]))
+	y1 = int(math.Ceil((miny - gt[3]) / gt[5]))
+	clip := func(v int, size int) int { return min(max(v, 0), size) }
+	return clip(x0, xsize), clip(x1, xsize), clip(y0, ysize), clip(y1, ysize)
+}
+
+// coldBiomes are the biomes cold enough for rivers to freeze.
+var coldBiomes = map[string]bool{
+	"Frozen Ocean":      true,
+	"Frozen River":      true,
+	"Ice Plains":        true,
+	"Ice Mountains":     true,
+	"Ice Plains Spikes": true,
+	"Cold Beach":        true,
+	"Cold Taiga":        true,
+	"Cold Taiga Hills":  true,
+	"Cold Taiga M":      true,
+}
+
+// riverColumn carves a channel into the column for one point.  The
+// water surface is one block below the banks, and the channel is depth
+// blocks deep over a bed of sand.
+func (rule Rule) riverColumn(xz world.XZ, elev int16, depth int16, crust int16) (Column, error) {
+	top := elev - 1
+	blocks := make([]string, top)
+	for y := int16(0); y < top; y++ {
+		if y == 0 {
+			blocks[y] = "Bedrock"
+		} else if y < (top - depth - crust) {
+			blocks[y] = "Stone"
+		} else if y < (top - depth) {
+			blocks[y] = riverbed
+		} else {
+			blocks[y] = "Water"
+		}
+	}
+	biome := "River"
+	if coldBiomes[rule.biome(elev, 0, 0)] {
+		biome = "Frozen River"
+	}
+	return makeColumn(xz, biome, blocks, false)
+}
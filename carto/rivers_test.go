@@ -0,0 +1,140 @@
+package carto
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mathuin/terroir/world"
+)
+
+var window_tests = []struct {
+	minx, maxx, miny, maxy float64
+	x0, x1, y0, y1         int
+}{
+	// inside
+	{1012, 1030, 1940, 1970, 2, 5, 5, 10},
+	// pixel edges
+	{1006, 1012, 1988, 1994, 1, 2, 1, 2},
+	// clipped
+	{900, 1030, 1900, 2100, 0, 5, 0, 10},
+	// outside
+	{2000, 2100, 0, 100, 10, 10, 10, 10},
+}
+
+func Test_window(t *testing.T) {
+	gt := [6]float64{1000, 6, 0, 2000, 0, -6}
+	for _, tt := range window_tests {
+		x0, x1, y0, y1 := window(tt.minx, tt.maxx, tt.miny, tt.maxy, gt, 10, 10)
+		if x0 != tt.x0 || x1 != tt.x1 || y0 != tt.y0 || y1 != tt.y1 {
+			t.Errorf("given %v, expected %d-%d, %d-%d, got %d-%d, %d-%d", tt, tt.x0, tt.x1, tt.y0, tt.y1, x0, x1, y0, y1)
+		}
+	}
+}
+
+var fill_tests = []struct {
+	name  string
+	rings [][][2]float64
+	want  []string
+}{
+	{"square", [][][2]float64{{{1, 1}, {4, 1}, {4, 4}, {1, 4}}}, []string{
+		"00000",
+		"02220",
+		"02220",
+		"02220",
+		"00001",
+	}},
+	{"hole", [][][2]float64{{{0, 0}, {5, 0}, {5, 5}, {0, 5}}, {{2, 2}, {3, 2}, {3, 3}, {2, 3}}}, []string{
+		"22222",
+		"22222",
+		"22022",
+		"22222",
+		"22221",
+	}},
+	{"triangle", [][][2]float64{{{0, 0}, {5, 0}, {0, 5}}}, []string{
+		"00000",
+		"20000",
+		"22000",
+		"22200",
+		"22221",
+	}},
+	{"outside", [][][2]float64{{{10, 10}, {15, 10}, {15, 15}}}, []string{
+		"00000",
+		"00000",
+		"00000",
+		"00000",
+		"00001",
+	}},
+	{"empty", [][][2]float64{{}}, []string{
+		"00000",
+		"00000",
+		"00000",
+		"00000",
+		"00001",
+	}},
+}
+
+func Test_fill(t *testing.T) {
+	// one unit pixels, with row 0 from y 4 to 5
+	gt := [6]float64{0, 1, 0, 5, 0, -1}
+	for _, tt := range fill_tests {
+		arr := make([]int16, 25)
+		// a lower value already there is kept
+		arr[24] = 1
+		fill(arr, tt.rings, 2, 5, 5, gt)
+		for y, row := range tt.want {
+			got := ""
+			for x := 0; x < 5; x++ {
+				got += fmt.Sprint(arr[x+y*5])
+			}
+			if got != row {
+				t.Errorf("%s: expected row %d to be %s, got %s", tt.name, y, row, got)
+			}
+		}
+	}
+}
+
+var riverColumn_tests = []struct {
+	rule  Rule
+	biome string
+}{
+	{NLCDRules.Default, "River"},
+	{forestRule, "River"},
+	{Rule{Biome: "Ice Plains", Surface: "Snow", Subsurface: "Dirt"}, "Frozen River"},
+}
+
+func Test_riverColumn(t *testing.T) {
+	xz := world.XZ{X: 4, Z: 9}
+	elev, depth, crust := int16(70), int16(2), int16(3)
+	must := columnOf(t)
+	for _, tt := range riverColumn_tests {
+		got := must(tt.rule.riverColumn(xz, elev, depth, crust))
+		names := make([]string, elev-1)
+		for y := range names {
+			switch {
+			case y == 0:
+				names[y] = "Bedrock"
+			case y < 64:
+				names[y] = "Stone"
+			case y < 67:
+				names[y] = "Sand"
+			default:
+				names[y] = "Water"
+			}
+		}
+		want := must(makeColumn(xz, tt.biome, names, false))
+		if got.biome != want.biome {
+			t.Errorf("%s: expected biome %d, got %d", tt.rule.Biome, want.biome, got.biome)
+		}
+		if len(got.blocks) != len(want.blocks) {
+			t.Fatalf("%s: expected %d blocks, got %d", tt.rule.Biome, len(want.blocks), len(got.blocks))
+		}
+		for y := range want.blocks {
+			if got.blocks[y] != want.blocks[y] {
+				t.Errorf("%s: block %d: expected %v, got %v", tt.rule.Biome, y, want.blocks[y], got.blocks[y])
+			}
+		}
+		if got.okspawn {
+			t.Errorf("%s: rivers should not be spawn points", tt.rule.Biome)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package carto
+
+import (
+	"math"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/mathuin/gdal"
+	"github.com/mathuin/terroir/world"
+)
+
+// A wayClass is a class of road or railway.  Where ways cross, the
+// lower class wins.
+type wayClass int16
+
+const (
+	noWay wayClass = iota
+	railway
+	majorRoad
+	minorRoad
+	footpath
+)
+
+// widths of each class of way in meters
+var wayWidths = map[wayClass]float64{
+	railway:   4,
+	majorRoad: 12,
+	minorRoad: 8,
+	footpath:  3,
+}
+
+// what each class of way is surfaced with
+var waySurfaces = map[wayClass]string{
+	railway:   "Gravel",
+	majorRoad: "Stone",
+	minorRoad: "Gravel",
+	footpath:  "Gravel",
+}
+
+// what bridges are decked with
+const bridgeDeck = "Oak Wood Planks"
+
+// Rail block ID, whose data is 0 for straight rails running north-south
+// and 1 for east-west.
+const railID = 66
+
+// how many times the elevation along ways is smoothed
+const gradePasses = 3
+
+// SetTransportation adds a transportation layer, any line vector file OGR
+// can read such as an OpenStreetMap PBF extract or a TIGER roads
+// shapefile.  Roads and railways are burned into the Road band with
+// widths by class.
+func (r *Region) SetTransportation(name string) {
+	r.vrts["transportation"] = ""
+	if name != "" {
+		r.vrts["transportation"] = path.Join(DatasetDir, r.name, name)
+	}
+}
+
+// roads burns the transportation layer onto the map grid, returning the
+// class of way on each pixel, or noWay.
+func (r Region) roads(xsize int, ysize int, gt [6]float64) ([]int16, error) {
+	arr := make([]int16, xsize*ysize)
+	if r.vrts["transportation"] == "" {
+		return arr, nil
+	}
+
+	mapSR, err := spatialReference(r.proj)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(r.vrts["transportation"]); err != nil {
+		return nil, wrap("roads", ErrMissingDataset, err)
+	}
+	ds := gdal.OpenDataSource(r.vrts["transportation"], 0)
+	defer ds.Destroy()
+	lc := ds.LayerCount()
+	if lc == 0 {
+		return nil, errorf("roads", ErrMissingDataset, "no layers in %s", r.vrts["transportation"])
+	}
+
+	for l := 0; l < lc; l++ {
+		layer := ds.LayerByIndex(l)
+		fc, ok := layer.FeatureCount(true)
+		if !ok {
+			return nil, errorf("roads", ErrGDAL, "layer %d FeatureCount NOT OK", l)
+		}
+		layer.ResetReading()
+		for i := 0; i < fc; i++ {
+			f := layer.NextFeature()
+			wc := featureWayClass(f)
+			switch f.Geometry().Type() {
+			case gdal.GT_LineString, gdal.GT_MultiLineString:
+			default:
+				wc = noWay
+			}
+			if wc == noWay {
+				f.Destroy()
+				continue
+			}
+			g := f.Geometry().Clone()
+			if err := g.TransformTo(mapSR); notnil(err) {
+				return nil, wrap("roads", ErrProjection, err)
+			}
+			b := g.Buffer(wayWidths[wc]/2, 8)
+			burn(arr, b, int16(wc), xsize, ysize, gt)
+			b.Destroy()
+			g.Destroy()
+			f.Destroy()
+		}
+	}
+	return arr, nil
+}
+
+// featureWayClass classifies a feature from the fields an OpenStreetMap
+// extract or a TIGER shapefile has.
+func featureWayClass(f gdal.Feature) wayClass {
+	field := func(name string) string {
+		i := f.FieldIndex(name)
+		if i < 0 {
+			return ""
+		}
+		return f.FieldAsString(i)
+	}
+	rail := field("railway")
+	if rail == "" {
+		rail = osmTag(field("other_tags"), "railway")
+	}
+	return classifyWay(field("highway"), rail, field("MTFCC"))
+}
+
+// osmTag finds a tag in the other_tags field of an OpenStreetMap
+// feature, which looks like "key"=>"value","key"=>"value".
+func osmTag(tags string, key string) string {
+	prefix := `"` + key + `"=>"`
+	i := strings.Index(tags, prefix)
+	if i < 0 {
+		return ""
+	}
+	value := tags[i+len(prefix):]
+	if j := strings.Index(value, `"`); j >= 0 {
+		value = value[:j]
+	}
+	return value
+}
+
+// classifyWay classifies a way by its OpenStreetMap highway and railway
+// tags or its MAF/TIGER feature class code.
+func classifyWay(highway string, rail string, mtfcc string) wayClass {
+	switch rail {
+	case "rail", "light_rail", "narrow_gauge", "tram", "preserved":
+		return railway
+	}
+	switch strings.TrimSuffix(highway, "_link") {
+	case "motorway", "trunk", "primary", "secondary":
+		return majorRoad
+	case "tertiary", "unclassified", "residential", "service", "living_street", "road":
+		return minorRoad
+	case "track", "path", "footway", "cycleway", "bridleway", "pedestrian":
+		return footpath
+	}
+	switch {
+	case strings.HasPrefix(mtfcc, "R1"):
+		return railway
+	case mtfcc == "S1100" || mtfcc == "S1200" || mtfcc == "S1630":
+		return majorRoad
+	case mtfcc == "S1400" || mtfcc == "S1640" || mtfcc == "S1730" || mtfcc == "S1740" || mtfcc == "S1780":
+		return minorRoad
+	case mtfcc == "S1500" || mtfcc == "S1710" || mtfcc == "S1720" || mtfcc == "S1820" || mtfcc == "S1830":
+		return footpath
+	}
+	return noWay
+}
+
+// grade smooths the elevation along ways, so that each pixel of way
+// becomes the average of the way around it.
+func grade(elev []int16, ways []int16, inx int, iny int) []int16 {
+	out := make([]int16, len(elev))
+	copy(out, elev)
+	for pass := 0; pass < gradePasses; pass++ {
+		prev := make([]int16, len(out))
+		copy(prev, out)
+		for i, wc := range ways {
+			if wc == 0 {
+				continue
+			}
+			x, y := i%inx, i/inx
+			sum, n := 0, 0
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					nx, ny := x+dx, y+dy
+					if nx < 0 || nx >= inx || ny < 0 || ny >= iny || ways[nx+ny*inx] == 0 {
+						continue
+					}
+					sum += int(prev[nx+ny*inx])
+					n++
+				}
+			}
+			out[i] = int16(math.Round(float64(sum) / float64(n)))
+		}
+	}
+	return out
+}
+
+// railEastWest reports whether the rail on a pixel runs east-west, which
+// it does when there is more railway beside it than above and below.
+func railEastWest(ways []int16, i int, inx int, iny int) bool {
+	x, y := i%inx, i/inx
+	isRail := func(nx, ny int) int {
+		if nx < 0 || nx >= inx || ny < 0 || ny >= iny || wayClass(ways[nx+ny*inx]) != railway {
+			return 0
+		}
+		return 1
+	}
+	return isRail(x-1, y)+isRail(x+1, y) > isRail(x, y-1)+isRail(x, y+1)
+}
+
+// column builds the column for one point of way: the rule's column
+// surfaced for the way, with rails on railways.
+func (wc wayClass) column(rule Rule, xz world.XZ, elev int16, bathy int16, crust int16, maxdepth int, ew bool) (Column, error) {
+	rule.Surface = waySurfaces[wc]
+	c, err := rule.column(xz, elev, bathy, crust, maxdepth)
+	if err != nil {
+		return Column{}, err
+	}
+	return wc.rails(c, ew), nil
+}
+
+// bridge decks over a water column.
+func (wc wayClass) bridge(c Column, ew bool) (Column, error) {
+	c, err := c.withPlant(bridgeDeck)
+	if err != nil {
+		return Column{}, err
+	}
+	c = wc.rails(c, ew)
+	c.okspawn = false
+	return c, nil
+}
+
+// rails lays rails on top of a railway column.
+func (wc wayClass) rails(c Column, ew bool) Column {
+	if wc != railway {
+		return c
+	}
+	data := 0
+	if ew {
+		data = 1
+	}
+	c.blocks = append(c.blocks, world.MakeBlock(railID, data))
+	return c
+}
@@ -0,0 +1,128 @@
+package carto
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mathuin/terroir/world"
+)
+
+var classifyWay_tests = []struct {
+	highway, rail, mtfcc string
+	wc                   wayClass
+}{
+	{"motorway", "", "", majorRoad},
+	{"primary_link", "", "", majorRoad},
+	{"residential", "", "", minorRoad},
+	{"footway", "", "", footpath},
+	{"", "rail", "", railway},
+	{"", "abandoned", "", noWay},
+	{"", "", "S1100", majorRoad},
+	{"", "", "S1400", minorRoad},
+	{"", "", "S1710", footpath},
+	{"", "", "R1011", railway},
+	{"", "", "H3010", noWay},
+}
+
+func Test_classifyWay(t *testing.T) {
+	for _, tt := range classifyWay_tests {
+		if got := classifyWay(tt.highway, tt.rail, tt.mtfcc); got != tt.wc {
+			t.Errorf("given %v, expected %d, got %d", tt, tt.wc, got)
+		}
+	}
+}
+
+var osmTag_tests = []struct {
+	tags, key, value string
+}{
+	{`"railway"=>"rail","usage"=>"main"`, "railway", "rail"},
+	{`"electrified"=>"no","railway"=>"light_rail"`, "railway", "light_rail"},
+	{`"bridge"=>"yes"`, "railway", ""},
+	{"", "railway", ""},
+}
+
+func Test_osmTag(t *testing.T) {
+	for _, tt := range osmTag_tests {
+		if got := osmTag(tt.tags, tt.key); got != tt.value {
+			t.Errorf("given %q, expected %q, got %q", tt.tags, tt.value, got)
+		}
+	}
+}
+
+func Test_grade(t *testing.T) {
+	// a road climbing a step, beside a hill which stays put
+	elev := []int16{
+		60, 60, 60, 60, 60,
+		70, 70, 70, 70, 70,
+		90, 90, 90, 90, 90,
+	}
+	ways := []int16{
+		0, 0, 0, 0, 0,
+		3, 3, 3, 3, 3,
+		0, 0, 0, 0, 0,
+	}
+	got := grade(elev, ways, 5, 3)
+	want := []int16{
+		60, 60, 60, 60, 60,
+		70, 70, 70, 70, 70,
+		90, 90, 90, 90, 90,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("flat road: expected %v, got %v", want, got)
+	}
+
+	elev = []int16{60, 64, 72, 72, 80}
+	ways = []int16{3, 3, 3, 3, 3}
+	got = grade(elev, ways, 5, 1)
+	for i := 1; i < len(got); i++ {
+		if d := got[i] - got[i-1]; d < 0 || d > 4 {
+			t.Errorf("graded road %v still has a step of %d", got, d)
+		}
+	}
+	if elev[2] != 72 {
+		t.Error("grade changed its input")
+	}
+}
+
+func Test_railEastWest(t *testing.T) {
+	rr := int16(railway)
+	ways := []int16{
+		0, rr, 0,
+		rr, rr, rr,
+		0, 0, 0,
+	}
+	if !railEastWest(ways, 4, 3, 3) {
+		t.Error("expected east-west rail in the middle")
+	}
+	if railEastWest(ways, 1, 3, 3) {
+		t.Error("expected north-south rail at the top")
+	}
+}
+
+func Test_wayColumn(t *testing.T) {
+	stone, _ := world.BlockNamed("Stone")
+	gravel, _ := world.BlockNamed("Gravel")
+	deck, _ := world.BlockNamed(bridgeDeck)
+	xz := world.XZ{X: 1, Z: 2}
+	must := columnOf(t)
+
+	c := must(majorRoad.column(NLCDRules.Default, xz, 70, 0, 3, 30, false))
+	if len(c.blocks) != 70 || c.blocks[69] != *stone {
+		t.Errorf("expected a stone road, got %v", c.blocks[len(c.blocks)-1])
+	}
+
+	c = must(railway.column(NLCDRules.Default, xz, 70, 0, 3, 30, true))
+	if len(c.blocks) != 71 || c.blocks[69] != *gravel || c.blocks[70] != world.MakeBlock(railID, 1) {
+		t.Errorf("expected east-west rails on gravel, got %v", c.blocks[len(c.blocks)-2:])
+	}
+
+	water := must(NLCDRules.Rule(11).column(xz, 62, 5, 3, 30))
+	c = must(minorRoad.bridge(water, false))
+	if len(c.blocks) != 63 || c.blocks[62] != *deck || c.okspawn {
+		t.Errorf("expected a bridge deck, got %v", c.blocks[len(c.blocks)-1])
+	}
+	c = must(railway.bridge(water, false))
+	if len(c.blocks) != 64 || c.blocks[63] != world.MakeBlock(railID, 0) {
+		t.Errorf("expected rails on the bridge, got %v", c.blocks[len(c.blocks)-1])
+	}
+}
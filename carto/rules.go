@@ -0,0 +1,306 @@
+package carto
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/mathuin/terroir/world"
+)
+
+// A Rule describes how the columns for one landcover value are built.
+//
+// Land columns are Bedrock at the bottom, Stone up to the crust, crust
+// blocks of Subsurface, and a single block of Surface on top.  Water
+// columns fill the top bathy blocks with Surface instead, and the crust
+// beneath the water is Subsurface.
+//
+// Trees maps kinds of tree to the share of land columns which grow one,
+// and Plants does the same for grass and flowers.  Rules with Crops are
+// farmed, each field growing one of them.
+//
+// Developed land is paved with Paving on the Paved share of its columns
+// unless there is impervious surface data, and Buildings is the share
+// of lots with a building up to Stories stories high.  Large enough
+// features of Village rules are laid out as villages instead.
+//
+// Soil sets how deep the crust is, so that steep mountains can be bare
+// stone and valleys can have deep dirt.
+type Rule struct {
+	Biome      string             `json:"biome"`
+	Bands      []BiomeBand        `json:"bands,omitempty"`
+	DeepBiome  string             `json:"deep_biome,omitempty"`
+	Surface    string             `json:"surface"`
+	Subsurface string             `json:"subsurface"`
+	Water      bool               `json:"water,omitempty"`
+	Spawn      bool               `json:"spawn,omitempty"`
+	Trees      map[string]float64 `json:"trees,omitempty"`
+	Plants     map[string]float64 `json:"plants,omitempty"`
+	Crops      []string           `json:"crops,omitempty"`
+	Paving     string             `json:"paving,omitempty"`
+	Paved      float64            `json:"paved,omitempty"`
+	Buildings  float64            `json:"buildings,omitempty"`
+	Stories    int                `json:"stories,omitempty"`
+	Village    bool               `json:"village,omitempty"`
+	Soil       *Soil              `json:"soil,omitempty"`
+}
+
+// A BiomeBand replaces the biome of a rule for columns whose elevation
+// is above a threshold.  The highest matching band wins.
+type BiomeBand struct {
+	Above int16  `json:"above"`
+	Biome string `json:"biome"`
+}
+
+// A RuleTable maps landcover values to rules.  Values without a rule
+// use the default rule.
+type RuleTable struct {
+	Rules   map[int]Rule `json:"rules"`
+	Default Rule         `json:"default"`
+}
+
+// NLCDRules reproduces the original NLCD 2011 interpretation.
+var NLCDRules = RuleTable{
+	Rules: map[int]Rule{
+		// open water
+		11: {Biome: "Ocean", DeepBiome: "Deep Ocean", Surface: "Water", Subsurface: "Gravel", Water: true},
+		// developed, open space to high intensity
+		21: openSpaceRule,
+		22: lowIntensityRule,
+		23: mediumIntensityRule,
+		24: highIntensityRule,
+		// barren land
+		31: {Biome: "Desert", Bands: []BiomeBand{{92, "Desert Hills"}}, Surface: "Sand", Subsurface: "Sandstone", Spawn: true},
+		// forest
+		41: deciduousRule,
+		42: evergreenRule,
+		43: mixedRule,
+		// pasture/hay and cultivated crops
+		81: pastureRule,
+		82: cropRule,
+		// wetlands
+		90: swampRule,
+		95: swampRule,
+	},
+	Default: plainsRule,
+}
+
+var plainsRule = Rule{
+	Biome: "Plains",
+	Bands: []BiomeBand{
+		{152, "Extreme Hills M"},
+		{122, "Extreme Hills"},
+		{92, "Extreme Hills Edge"},
+	},
+	Surface:    "Grass Block",
+	Subsurface: "Dirt",
+	Spawn:      true,
+}
+
+var pastureRule = Rule{Biome: "Plains", Bands: plainsRule.Bands, Surface: "Grass Block", Subsurface: "Dirt", Spawn: true, Plants: map[string]float64{"Grass": 0.3, "Double Tallgrass": 0.15, "Sunflower": 0.01}}
+
+var openSpaceRule = Rule{Biome: "Plains", Bands: plainsRule.Bands, Surface: "Grass Block", Subsurface: "Dirt", Spawn: true, Trees: map[string]float64{"oak": 0.005}, Paving: "Gravel", Paved: 0.05, Village: true}
+
+var lowIntensityRule = Rule{Biome: "Plains", Bands: plainsRule.Bands, Surface: "Grass Block", Subsurface: "Dirt", Spawn: true, Paved: 0.3, Buildings: 0.3, Stories: 2, Village: true}
+
+var mediumIntensityRule = Rule{Biome: "Plains", Bands: plainsRule.Bands, Surface: "Grass Block", Subsurface: "Dirt", Spawn: true, Paved: 0.6, Buildings: 0.6, Stories: 3}
+
+var highIntensityRule = Rule{Biome: "Plains", Bands: plainsRule.Bands, Surface: "Grass Block", Subsurface: "Dirt", Spawn: true, Paved: 0.9, Buildings: 0.9, Stories: 8}
+
+var cropRule = Rule{Biome: "Plains", Bands: plainsRule.Bands, Surface: "Grass Block", Subsurface: "Dirt", Spawn: true, Crops: []string{"Wheat", "Carrot", "Potato"}}
+
+var forestRule = Rule{Biome: "Forest", Bands: []BiomeBand{{92, "Forest Hills"}}, Surface: "Grass Block", Subsurface: "Dirt", Spawn: true}
+
+var deciduousRule = Rule{Biome: "Forest", Bands: []BiomeBand{{92, "Forest Hills"}}, Surface: "Grass Block", Subsurface: "Dirt", Spawn: true, Trees: map[string]float64{"oak": 0.03, "birch": 0.01}}
+
+var evergreenRule = Rule{Biome: "Forest", Bands: []BiomeBand{{92, "Forest Hills"}}, Surface: "Grass Block", Subsurface: "Dirt", Spawn: true, Trees: map[string]float64{"spruce": 0.04}}
+
+var mixedRule = Rule{Biome: "Forest", Bands: []BiomeBand{{92, "Forest Hills"}}, Surface: "Grass Block", Subsurface: "Dirt", Spawn: true, Trees: map[string]float64{"oak": 0.015, "birch": 0.005, "spruce": 0.02}}
+
+var swampRule = Rule{Biome: "Swampland", Bands: []BiomeBand{{92, "Swampland M"}}, Surface: "Grass Block", Subsurface: "Dirt", Spawn: true, Soil: &Soil{Min: 3, Max: 8}}
+
+// LoadRuleTable reads and validates a rule table file.
+func LoadRuleTable(filename string) (*RuleTable, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, wrap("LoadRuleTable", ErrMissingDataset, err)
+	}
+	defer f.Close()
+	t, err := ReadRuleTable(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return t, nil
+}
+
+// ReadRuleTable reads and validates a rule table.
+func ReadRuleTable(r io.Reader) (*RuleTable, error) {
+	t := new(RuleTable)
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(t); err != nil {
+		return nil, wrap("rules", ErrInvalidParameter, err)
+	}
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	st := t.sortedBands()
+	return &st, nil
+}
+
+// Validate checks that every biome and block named by the table exists.
+func (t RuleTable) Validate() error {
+	if err := t.Default.validate(); err != nil {
+		return errorf("rules", ErrInvalidParameter, "default: %w", err)
+	}
+	for lc, rule := range t.Rules {
+		if err := rule.validate(); err != nil {
+			return errorf("rules", ErrInvalidParameter, "landcover %d: %w", lc, err)
+		}
+	}
+	return nil
+}
+
+func (rule Rule) validate() error {
+	biomes := []string{rule.Biome}
+	for _, band := range rule.Bands {
+		biomes = append(biomes, band.Biome)
+	}
+	if rule.DeepBiome != "" {
+		biomes = append(biomes, rule.DeepBiome)
+	}
+	for _, biome := range biomes {
+		if _, ok := world.Biome[biome]; !ok {
+			return fmt.Errorf("biome %q not found in world.Biome", biome)
+		}
+	}
+	for _, block := range []string{rule.Surface, rule.Subsurface} {
+		if _, err := world.BlockNamed(block); err != nil {
+			return err
+		}
+	}
+	if err := validateDensities("tree", rule.Trees, func(name string) bool { _, ok := treeKinds[name]; return ok }); err != nil {
+		return err
+	}
+	if err := validateDensities("plant", rule.Plants, func(name string) bool { _, ok := plantBlocks[name]; return ok }); err != nil {
+		return err
+	}
+	for _, crop := range rule.Crops {
+		if _, err := world.BlockNamed(crop); err != nil {
+			return err
+		}
+	}
+	if rule.Paving != "" {
+		if _, err := world.BlockNamed(rule.Paving); err != nil {
+			return err
+		}
+	}
+	for what, share := range map[string]float64{"paved": rule.Paved, "buildings": rule.Buildings} {
+		if share < 0 || share > 1 {
+			return fmt.Errorf("%s %f must be between 0 and 1", what, share)
+		}
+	}
+	if rule.Stories < 0 {
+		return fmt.Errorf("stories %d must be at least 0", rule.Stories)
+	}
+	if rule.Soil != nil {
+		if err := rule.Soil.validate(); err != nil {
+			return err
+		}
+	}
+	if rule.Village && (rule.Water || len(rule.Crops) > 0) {
+		return fmt.Errorf("villages cannot be built on water or crops")
+	}
+	return nil
+}
+
+// sortedBands returns a copy of the table with the bands of each rule
+// sorted from the highest down.  The bands are copied before sorting,
+// since rules and tables share them.
+func (t RuleTable) sortedBands() RuleTable {
+	nt := RuleTable{Rules: make(map[int]Rule, len(t.Rules)), Default: t.Default}
+	nt.Default.Bands = sortBands(t.Default.Bands)
+	for lc, rule := range t.Rules {
+		rule.Bands = sortBands(rule.Bands)
+		nt.Rules[lc] = rule
+	}
+	return nt
+}
+
+func sortBands(bands []BiomeBand) []BiomeBand {
+	if bands == nil {
+		return nil
+	}
+	sorted := append([]BiomeBand{}, bands...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Above > sorted[j].Above })
+	return sorted
+}
+
+// Rule returns the rule for a landcover value.
+func (t RuleTable) Rule(lc int) Rule {
+	if rule, ok := t.Rules[lc]; ok {
+		return rule
+	}
+	return t.Default
+}
+
+// withBiomes returns a copy of the table in which each listed landcover
+// value always gets the given biome.
+func (t RuleTable) withBiomes(biomes map[int]string) RuleTable {
+	nt := RuleTable{Rules: make(map[int]Rule, len(t.Rules)), Default: t.Default}
+	for lc, rule := range t.Rules {
+		nt.Rules[lc] = rule
+	}
+	for lc, biome := range biomes {
+		rule := nt.Rule(lc)
+		rule.Biome = biome
+		rule.Bands = nil
+		rule.DeepBiome = ""
+		nt.Rules[lc] = rule
+	}
+	return nt
+}
+
+// biome picks the biome for a column.
+func (rule Rule) biome(elev int16, bathy int16, maxdepth int) string {
+	if rule.Water {
+		if rule.DeepBiome != "" && int(bathy) >= maxdepth-1 {
+			return rule.DeepBiome
+		}
+		return rule.Biome
+	}
+	for _, band := range rule.Bands {
+		if elev > band.Above {
+			return band.Biome
+		}
+	}
+	return rule.Biome
+}
+
+// column builds the column for one point.
+func (rule Rule) column(xz world.XZ, elev int16, bathy int16, crust int16, maxdepth int) (Column, error) {
+	// depth of the surface layer
+	depth := int16(1)
+	if rule.Water {
+		depth = bathy
+	}
+
+	blocks := make([]string, elev)
+	for y := int16(0); y < elev; y++ {
+		if y == 0 {
+			blocks[y] = "Bedrock"
+		} else if y < (elev - depth - crust) {
+			blocks[y] = "Stone"
+		} else if y < (elev - depth) {
+			blocks[y] = rule.Subsurface
+		} else {
+			blocks[y] = rule.Surface
+		}
+	}
+	// water makes a bad spawn point, and so do trees, which are added
+	// by processFeatures
+	okspawn := rule.Spawn && !rule.Water
+	return makeColumn(xz, rule.biome(elev, bathy, maxdepth), blocks, okspawn)
+}
@@ -0,0 +1,190 @@
+package carto
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mathuin/terroir/world"
+)
+
+// legacyColumn is the hardcoded landcover switch which NLCDRules
+// replaced, kept here to prove the table reproduces it.
+func legacyColumn(xz world.XZ, lc int, elev int16, bathy int16, crust int16, maxdepth int) (Column, error) {
+	var biome string
+	var surface, subsurface string
+	switch lc {
+	case 11:
+		if int(bathy) >= maxdepth-1 {
+			biome = "Deep Ocean"
+		} else {
+			biome = "Ocean"
+		}
+		blocks := make([]string, elev)
+		for y := int16(0); y < elev; y++ {
+			if y == 0 {
+				blocks[y] = "Bedrock"
+			} else if y < (elev - bathy - crust) {
+				blocks[y] = "Stone"
+			} else if y < (elev - bathy) {
+				blocks[y] = "Gravel"
+			} else {
+				blocks[y] = "Water"
+			}
+		}
+		return makeColumn(xz, biome, blocks, false)
+	case 31:
+		biome, surface, subsurface = "Desert", "Sand", "Sandstone"
+		if elev > 92 {
+			biome = "Desert Hills"
+		}
+	case 41, 42, 43:
+		biome, surface, subsurface = "Forest", "Grass Block", "Dirt"
+		if elev > 92 {
+			biome = "Forest Hills"
+		}
+	case 90, 95:
+		biome, surface, subsurface = "Swampland", "Grass Block", "Dirt"
+		if elev > 92 {
+			biome = "Swampland M"
+		}
+	default:
+		surface, subsurface = "Grass Block", "Dirt"
+		if elev > 152 {
+			biome = "Extreme Hills M"
+		} else if elev > 122 {
+			biome = "Extreme Hills"
+		} else if elev > 92 {
+			biome = "Extreme Hills Edge"
+		} else {
+			biome = "Plains"
+		}
+	}
+	blocks := make([]string, elev)
+	for y := int16(0); y < elev; y++ {
+		if y == 0 {
+			blocks[y] = "Bedrock"
+		} else if y < (elev - crust - 1) {
+			blocks[y] = "Stone"
+		} else if y < elev-1 {
+			blocks[y] = subsurface
+		} else {
+			blocks[y] = surface
+		}
+	}
+	return makeColumn(xz, biome, blocks, true)
+}
+
+func Test_NLCDRules(t *testing.T) {
+	maxdepth := 30
+	xz := world.XZ{X: 3, Z: -7}
+	must := columnOf(t)
+	for _, lc := range []int{11, 21, 22, 23, 24, 31, 41, 42, 43, 52, 71, 81, 82, 90, 95} {
+		for _, elev := range []int16{40, 62, 92, 93, 122, 123, 152, 153, 200} {
+			for _, bathy := range []int16{0, 1, 5, 28, 29, 30} {
+				for _, crust := range []int16{1, 3, 5} {
+					want := must(legacyColumn(xz, lc, elev, bathy, crust, maxdepth))
+					got := must(NLCDRules.Rule(lc).column(xz, elev, bathy, crust, maxdepth))
+					if !reflect.DeepEqual(want, got) {
+						t.Fatalf("lc %d elev %d bathy %d crust %d: expected %+v, got %+v", lc, elev, bathy, crust, want, got)
+					}
+				}
+			}
+		}
+	}
+}
+
+var loadRuleTable_tests = []struct {
+	filename string
+	rules    RuleTable
+}{
+	{"rules/nlcd.json", NLCDRules},
+	{"rules/corine.json", CORINERules},
+}
+
+func Test_LoadRuleTable(t *testing.T) {
+	for _, tt := range loadRuleTable_tests {
+		rt, err := LoadRuleTable(tt.filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(*rt, tt.rules) {
+			t.Errorf("%s does not match the built-in rules:\n%+v\n%+v", tt.filename, *rt, tt.rules)
+		}
+	}
+}
+
+var readRuleTable_tests = []struct {
+	json string
+	ok   bool
+}{
+	{`{"rules": {"11": {"biome": "Ocean", "surface": "Water", "subsurface": "Sand", "water": true}}, "default": {"biome": "Plains", "surface": "Grass Block", "subsurface": "Dirt"}}`, true},
+	{`{"rules": {}, "default": {"biome": "Plains", "surface": "Grass Block", "subsurface": "Dirt", "bands": [{"above": 80, "biome": "Ice Plains"}]}}`, true},
+	{`{"rules": {}, "default": {"biome": "Moon", "surface": "Grass Block", "subsurface": "Dirt"}}`, false},
+	{`{"rules": {"31": {"biome": "Desert", "surface": "Cheese", "subsurface": "Dirt"}}, "default": {"biome": "Plains", "surface": "Grass Block", "subsurface": "Dirt"}}`, false},
+	{`{"rules": {}, "default": {"biome": "Plains", "surface": "Grass Block", "subsurface": "Dirt", "trees": true}}`, false},
+	{`{"rules": {}, "default": {"biome": "Plains", "surface": "Grass Block", "subsurface": "Dirt", "trees": {"oak": 0.1, "spruce": 0.2}}}`, true},
+	{`{"rules": {}, "default": {"biome": "Plains", "surface": "Grass Block", "subsurface": "Dirt", "trees": {"palm": 0.1}}}`, false},
+	{`{"rules": {}, "default": {"biome": "Plains", "surface": "Grass Block", "subsurface": "Dirt", "trees": {"oak": -0.1}}}`, false},
+	{`{"rules": {}, "default": {"biome": "Plains", "surface": "Grass Block", "subsurface": "Dirt", "trees": {"oak": 0.6, "birch": 0.6}}}`, false},
+	{`{"rules": {}, "default": {"biome": "Plains", "surface": "Grass Block", "subsurface": "Dirt", "village": true}}`, true},
+	{`{"rules": {}, "default": {"biome": "Ocean", "surface": "Water", "subsurface": "Sand", "water": true, "village": true}}`, false},
+	{`{"rules": {}, "default": {"biome": "Plains", "surface": "Grass Block", "subsurface": "Dirt", "soil": {"min": 0, "max": 2, "bare": 3}}}`, true},
+	{`{"rules": {}, "default": {"biome": "Plains", "surface": "Grass Block", "subsurface": "Dirt", "soil": {"min": 4, "max": 2}}}`, false},
+}
+
+func Test_ReadRuleTable(t *testing.T) {
+	for _, tt := range readRuleTable_tests {
+		_, err := ReadRuleTable(strings.NewReader(tt.json))
+		if tt.ok != (err == nil) {
+			t.Errorf("given %s, expected ok %v, got %v", tt.json, tt.ok, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrInvalidParameter) {
+			t.Errorf("given %s, expected ErrInvalidParameter, got %v", tt.json, err)
+		}
+	}
+}
+
+func Test_biomeBands(t *testing.T) {
+	rt, err := ReadRuleTable(strings.NewReader(`{"rules": {}, "default": {"biome": "Plains", "surface": "Grass Block", "subsurface": "Dirt", "bands": [{"above": 92, "biome": "Extreme Hills Edge"}, {"above": 152, "biome": "Extreme Hills M"}]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule := rt.Rule(71)
+	for elev, want := range map[int16]string{60: "Plains", 100: "Extreme Hills Edge", 160: "Extreme Hills M"} {
+		if got := rule.biome(elev, 0, 30); got != want {
+			t.Errorf("elev %d: expected %s, got %s", elev, want, got)
+		}
+	}
+}
+
+func Test_sortedBands(t *testing.T) {
+	shared := []BiomeBand{{92, "Extreme Hills Edge"}, {152, "Extreme Hills M"}}
+	rule := Rule{Biome: "Plains", Bands: shared, Surface: "Grass Block", Subsurface: "Dirt"}
+	var r Region
+	if err := r.SetRules(RuleTable{Rules: map[int]Rule{71: rule}, Default: rule}); err != nil {
+		t.Fatal(err)
+	}
+	if shared[0].Above != 92 {
+		t.Errorf("shared bands reordered: %v", shared)
+	}
+	for _, rule := range []Rule{r.rules.Rule(71), r.rules.Default} {
+		if rule.Bands[0].Above != 152 {
+			t.Errorf("expected bands sorted from the highest down, got %v", rule.Bands)
+		}
+	}
+}
+
+func Test_withBiomes(t *testing.T) {
+	rt := NLCDRules.withBiomes(map[int]string{31: "Mesa", 71: "Savanna"})
+	if got := rt.Rule(31).biome(120, 0, 30); got != "Mesa" {
+		t.Errorf("expected Mesa, got %s", got)
+	}
+	if got := rt.Rule(71).biome(160, 0, 30); got != "Savanna" {
+		t.Errorf("expected Savanna, got %s", got)
+	}
+	if got := NLCDRules.Rule(31).biome(120, 0, 30); got != "Desert Hills" {
+		t.Errorf("NLCDRules changed: expected Desert Hills, got %s", got)
+	}
+}
@@ -0,0 +1,135 @@
+package carto
+
+import (
+	"sort"
+	"strings"
+)
+
+// A Scheme describes how to read the values in a landcover dataset:
+// which classes are water, which classes mean there is no data, and the
+// rule table which turns classes into terrain.
+type Scheme struct {
+	Name   string
+	Water  []int16
+	Nodata []int16
+	// Fill replaces nodata values, and should be one of the water
+	// classes since data is usually missing offshore.
+	Fill  int16
+	Rules RuleTable
+}
+
+// NLCD is the National Land Cover Database 2011 scheme used in the
+// United States.
+var NLCD = Scheme{
+	Name:   "nlcd",
+	Water:  []int16{11},
+	Nodata: []int16{0},
+	Fill:   11,
+	Rules:  NLCDRules,
+}
+
+// CORINE is the 44-class CORINE Land Cover scheme used in Europe, as
+// found in the grid codes of the CLC rasters.
+var CORINE = Scheme{
+	Name:   "corine",
+	Water:  []int16{40, 41, 42, 43, 44, 50},
+	Nodata: []int16{0, 48, 128, 255},
+	Fill:   44,
+	Rules:  CORINERules,
+}
+
+// Schemes holds the built-in schemes by name.
+var Schemes = map[string]Scheme{
+	NLCD.Name:   NLCD,
+	CORINE.Name: CORINE,
+}
+
+// LookupScheme returns the built-in scheme with the given name.
+func LookupScheme(name string) (Scheme, error) {
+	if s, ok := Schemes[strings.ToLower(strings.TrimSpace(name))]; ok {
+		return s, nil
+	}
+	names := []string{}
+	for n := range Schemes {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return Scheme{}, errorf("scheme", ErrInvalidParameter, "%q not found (known schemes: %s)", name, strings.Join(names, ", "))
+}
+
+// isNodata reports whether the value is one of the scheme's nodata
+// classes.
+func (s Scheme) isNodata(v int16) bool {
+	for _, n := range s.Nodata {
+		if v == n {
+			return true
+		}
+	}
+	return false
+}
+
+// values converts raw landcover values, replacing both the dataset's
+// own nodata value and the scheme's nodata classes with the fill class.
+func (s Scheme) values(buf []byte, nodata float64, hasNodata bool) []int {
+	out := make([]int, len(buf))
+	for i, v := range buf {
+		if (hasNodata && v == byte(nodata)) || s.isNodata(int16(v)) {
+			out[i] = int(s.Fill)
+		} else {
+			out[i] = int(v)
+		}
+	}
+	return out
+}
+
+// CORINERules interprets the CORINE Land Cover classes.
+var CORINERules = RuleTable{
+	Rules: map[int]Rule{
+		// urban fabric, industrial and commercial units
+		1: highIntensityRule,
+		2: lowIntensityRule,
+		3: mediumIntensityRule,
+		// green urban areas, sport and leisure facilities
+		10: openSpaceRule,
+		11: openSpaceRule,
+		// mineral extraction, dump and construction sites
+		7: {Biome: "Plains", Surface: "Gravel", Subsurface: "Stone", Spawn: true},
+		8: {Biome: "Plains", Surface: "Gravel", Subsurface: "Dirt", Spawn: true},
+		9: {Biome: "Plains", Surface: "Coarse Dirt", Subsurface: "Dirt", Spawn: true},
+		// arable land and pastures
+		12: cropRule,
+		13: cropRule,
+		18: pastureRule,
+		// forest
+		23: deciduousRule,
+		24: {Biome: "Taiga", Bands: []BiomeBand{{92, "Taiga Hills"}}, Surface: "Grass Block", Subsurface: "Dirt", Spawn: true, Trees: evergreenRule.Trees},
+		25: mixedRule,
+		29: forestRule,
+		// sclerophyllous vegetation
+		28: {Biome: "Savanna", Bands: []BiomeBand{{92, "Savanna Plateau"}}, Surface: "Grass Block", Subsurface: "Dirt", Spawn: true},
+		// beaches, dunes, sands
+		30: {Biome: "Beach", Surface: "Sand", Subsurface: "Sandstone", Spawn: true},
+		// bare rocks, sparsely vegetated and burnt areas
+		31: {Biome: "Extreme Hills", Bands: []BiomeBand{{152, "Extreme Hills M"}}, Surface: "Stone", Subsurface: "Stone", Spawn: true},
+		32: {Biome: "Extreme Hills Edge", Bands: []BiomeBand{{122, "Extreme Hills"}}, Surface: "Coarse Dirt", Subsurface: "Gravel", Spawn: true, Soil: &Soil{Min: 0, Max: 3, Bare: 2}},
+		33: {Biome: "Plains", Surface: "Coarse Dirt", Subsurface: "Dirt", Spawn: true},
+		// glaciers and perpetual snow
+		34: {Biome: "Ice Plains", Bands: []BiomeBand{{92, "Ice Mountains"}}, Surface: "Snow", Subsurface: "Packed Ice", Spawn: true},
+		// wetlands
+		35: swampRule,
+		36: swampRule,
+		37: swampRule,
+		// salines and intertidal flats
+		38: {Biome: "Beach", Surface: "Sand", Subsurface: "Clay", Spawn: true},
+		39: {Biome: "Beach", Surface: "Sand", Subsurface: "Clay", Spawn: true},
+		// inland waters
+		40: {Biome: "River", Surface: "Water", Subsurface: "Gravel", Water: true},
+		41: {Biome: "River", Surface: "Water", Subsurface: "Gravel", Water: true},
+		50: {Biome: "River", Surface: "Water", Subsurface: "Gravel", Water: true},
+		// marine waters
+		42: {Biome: "Ocean", Surface: "Water", Subsurface: "Sand", Water: true},
+		43: {Biome: "Ocean", DeepBiome: "Deep Ocean", Surface: "Water", Subsurface: "Sand", Water: true},
+		44: {Biome: "Ocean", DeepBiome: "Deep Ocean", Surface: "Water", Subsurface: "Gravel", Water: true},
+	},
+	Default: NLCDRules.Default,
+}
@@ -0,0 +1,75 @@
+package carto
+
+import (
+	"reflect"
+	"testing"
+)
+
+var lookupScheme_tests = []struct {
+	name string
+	want string
+	ok   bool
+}{
+	{"nlcd", "nlcd", true},
+	{"CORINE", "corine", true},
+	{" corine ", "corine", true},
+	{"anderson", "", false},
+}
+
+func Test_LookupScheme(t *testing.T) {
+	for _, tt := range lookupScheme_tests {
+		s, err := LookupScheme(tt.name)
+		if tt.ok != (err == nil) {
+			t.Errorf("given %q, expected ok %v, got %v", tt.name, tt.ok, err)
+			continue
+		}
+		if s.Name != tt.want {
+			t.Errorf("given %q, expected %q, got %q", tt.name, tt.want, s.Name)
+		}
+	}
+}
+
+var schemeValues_tests = []struct {
+	scheme    Scheme
+	buf       []byte
+	nodata    float64
+	hasNodata bool
+	want      []int
+}{
+	{NLCD, []byte{0, 11, 21, 41, 95}, 0, false, []int{11, 11, 21, 41, 95}},
+	{NLCD, []byte{0, 11, 21, 255}, 255, true, []int{11, 11, 21, 11}},
+	{CORINE, []byte{0, 1, 23, 44, 48, 50, 128, 255}, 0, false, []int{44, 1, 23, 44, 44, 50, 44, 44}},
+	{CORINE, []byte{12, 200}, 200, true, []int{12, 44}},
+}
+
+func Test_schemeValues(t *testing.T) {
+	for _, tt := range schemeValues_tests {
+		got := tt.scheme.values(tt.buf, tt.nodata, tt.hasNodata)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s given %v (nodata %v %v), expected %v, got %v", tt.scheme.Name, tt.buf, tt.nodata, tt.hasNodata, tt.want, got)
+		}
+	}
+}
+
+// Every built-in scheme must turn its water classes into water columns,
+// and fill nodata with water.
+func Test_schemeWater(t *testing.T) {
+	for _, s := range Schemes {
+		if err := s.Rules.Validate(); err != nil {
+			t.Errorf("%s: %s", s.Name, err)
+		}
+		for _, w := range s.Water {
+			if !s.Rules.Rule(int(w)).Water {
+				t.Errorf("%s: water class %d does not have a water rule", s.Name, w)
+			}
+		}
+		if !s.Rules.Rule(int(s.Fill)).Water {
+			t.Errorf("%s: fill class %d does not have a water rule", s.Name, s.Fill)
+		}
+		for lc, rule := range s.Rules.Rules {
+			if rule.Water && !reflect.DeepEqual(nomatch([]int16{int16(lc)}, s.Water), []string{}) {
+				t.Errorf("%s: class %d has a water rule but is not a water class", s.Name, lc)
+			}
+		}
+	}
+}
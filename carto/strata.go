@@ -0,0 +1,117 @@
+package carto
+
+import (
+	"github.com/mathuin/terroir/world"
+)
+
+// The Crust band gives each column a soil depth between minCrust and
+// maxCrust blocks.
+const (
+	minCrust = 1
+	maxCrust = 5
+)
+
+// Soil describes how deep the soil of a rule is.  The depths of the
+// Crust band are scaled to between Min and Max blocks, and the soil
+// thins on slopes until, at Bare blocks per block or steeper, it is
+// only Min deep.  A Bare of zero leaves slopes alone.  Land with no
+// soil at all is bare stone.
+type Soil struct {
+	Min  int16 `json:"min"`
+	Max  int16 `json:"max"`
+	Bare int16 `json:"bare,omitempty"`
+}
+
+// soil for rules without their own, which keeps the Crust band's depths
+// except on cliffs
+var defaultSoil = Soil{Min: minCrust, Max: maxCrust, Bare: 8}
+
+// what land with no soil is made of
+const bareRock = "Stone"
+
+// Bedrock is solid at the bottom of the world, and thins out at random
+// up to bedrockLayers blocks high.
+const bedrockLayers = 5
+
+// Stone variants make blobs in the stone below variantTop, where the
+// noise for each variant is over variantThreshold.
+const (
+	variantScale     = 8.0
+	variantThreshold = 0.55
+	variantTop       = 80
+)
+
+var stoneVariants = []struct {
+	name string
+	salt uint64
+}{
+	{"Granite", saltGranite},
+	{"Diorite", saltDiorite},
+	{"Andesite", saltAndesite},
+}
+
+func (s Soil) validate() error {
+	if s.Min < 0 || s.Max < s.Min {
+		return errorf("soil", ErrInvalidParameter, "soil depths %d to %d must be at least 0 and in order", s.Min, s.Max)
+	}
+	if s.Bare < 0 {
+		return errorf("soil", ErrInvalidParameter, "bare slope %d must be at least 0", s.Bare)
+	}
+	return nil
+}
+
+// soil returns the rule and the soil depth for a column from its crust
+// depth and its slope.  Where there is no soil left the rule's surface
+// becomes bare stone.
+func (rule Rule) soil(crust int16, slope int16) (Rule, int16) {
+	s := defaultSoil
+	if rule.Soil != nil {
+		s = *rule.Soil
+	}
+	if crust < minCrust {
+		crust = minCrust
+	}
+	if crust > maxCrust {
+		crust = maxCrust
+	}
+	depth := s.Min + (crust-minCrust)*(s.Max-s.Min)/(maxCrust-minCrust)
+	if s.Bare > 0 {
+		flat := s.Bare - slope
+		if flat < 0 {
+			flat = 0
+		}
+		depth = s.Min + (depth-s.Min)*flat/s.Bare
+	}
+	if depth == 0 && !rule.Water {
+		rule.Surface = bareRock
+	}
+	return rule, depth
+}
+
+// strata roughens the bottom of a column with bedrock and mixes stone
+// variants into its stone.
+func (r Region) strata(c Column) Column {
+	stone, _ := world.BlockNamed("Stone")
+	bedrock, _ := world.BlockNamed("Bedrock")
+	for y, b := range c.blocks {
+		if b != *stone {
+			continue
+		}
+		if y < bedrockLayers && chance(r.seed, c.xz, saltBedrock|uint64(y)<<32)*bedrockLayers < float64(bedrockLayers-y) {
+			c.blocks[y] = *bedrock
+			continue
+		}
+		if y >= variantTop {
+			break
+		}
+		x, fy, z := float64(c.xz.X)/variantScale, float64(y)/variantScale, float64(c.xz.Z)/variantScale
+		for _, v := range stoneVariants {
+			if noise(r.seed, v.salt, x, fy, z) > variantThreshold {
+				variant, _ := world.BlockNamed(v.name)
+				c.blocks[y] = *variant
+				break
+			}
+		}
+	}
+	return c
+}
@@ -0,0 +1,78 @@
+package carto
+
+import (
+	"testing"
+
+	"github.com/mathuin/terroir/world"
+)
+
+var soil_tests = []struct {
+	rule    Rule
+	crust   int16
+	slope   int16
+	depth   int16
+	surface string
+}{
+	// the default keeps the crust band except on cliffs
+	{plainsRule, 1, 0, 1, "Grass Block"},
+	{plainsRule, 4, 0, 4, "Grass Block"},
+	{plainsRule, 5, 4, 3, "Grass Block"},
+	{plainsRule, 5, 8, 1, "Grass Block"},
+	{plainsRule, 9, 0, 5, "Grass Block"},
+	// deep soil in swamps, on any slope
+	{swampRule, 1, 0, 3, "Grass Block"},
+	{swampRule, 5, 10, 8, "Grass Block"},
+	// bare stone on steep slopes
+	{CORINERules.Rule(32), 5, 0, 3, "Coarse Dirt"},
+	{CORINERules.Rule(32), 5, 1, 1, "Coarse Dirt"},
+	{CORINERules.Rule(32), 5, 2, 0, bareRock},
+}
+
+func Test_soil(t *testing.T) {
+	for _, tt := range soil_tests {
+		rule, depth := tt.rule.soil(tt.crust, tt.slope)
+		if depth != tt.depth || rule.Surface != tt.surface {
+			t.Errorf("given %s crust %d slope %d, expected %d of %s, got %d of %s", tt.rule.Biome, tt.crust, tt.slope, tt.depth, tt.surface, depth, rule.Surface)
+		}
+	}
+}
+
+func Test_strata(t *testing.T) {
+	r := Region{seed: 42}
+	names := map[string]int{}
+	bedrockTop := 0
+	must := columnOf(t)
+	for x := int32(0); x < 32; x++ {
+		for z := int32(0); z < 32; z++ {
+			xz := world.XZ{X: x, Z: z}
+			c := r.strata(must(plainsRule.column(xz, 64, 0, 3, 30)))
+			if again := r.strata(must(plainsRule.column(xz, 64, 0, 3, 30))); again.blocks[3] != c.blocks[3] {
+				t.Fatalf("strata at %v are not deterministic", xz)
+			}
+			for y, b := range c.blocks {
+				name, _ := b.BlockName()
+				names[name]++
+				if name == "Bedrock" && y > bedrockTop {
+					bedrockTop = y
+				}
+				if y == 0 && name != "Bedrock" {
+					t.Errorf("expected bedrock at the bottom of %v, got %s", xz, name)
+				}
+			}
+			if name, _ := c.blocks[63].BlockName(); name != "Grass Block" {
+				t.Errorf("expected the surface left alone at %v, got %s", xz, name)
+			}
+		}
+	}
+	if bedrockTop == 0 || bedrockTop >= bedrockLayers {
+		t.Errorf("expected bedrock up to %d, got up to %d", bedrockLayers-1, bedrockTop)
+	}
+	for _, v := range stoneVariants {
+		if names[v.name] == 0 {
+			t.Errorf("expected some %s", v.name)
+		}
+	}
+	if names["Stone"] < names["Granite"]+names["Diorite"]+names["Andesite"] {
+		t.Errorf("expected mostly stone, got %v", names)
+	}
+}
@@ -0,0 +1,243 @@
+package carto
+
+import (
+	"log"
+	"math"
+
+	"github.com/mathuin/gdal"
+	"github.com/mathuin/terroir/world"
+)
+
+// A streamed world is built one region file at a time, along with
+// streamMargin blocks all around it so that everything reaching into
+// the region from outside (caves and ravines, trees, buildings and
+// villages, and light) is built as well.  Only the region's own chunks
+// are kept.  Every column comes out as it would in a whole build, since
+// everything is decided by the seed and the map.  Each part is lit on
+// its own, and light spreads no further than world.MaxLight blocks, so
+// with the margin wider than that, torches, lava and sky light under
+// overhangs light the region across its edges as a whole build would.
+const (
+	regionBlocks = 512
+	streamMargin = 96
+)
+
+// StreamWorld builds the world a region at a time, writing each region
+// file to dir as soon as it is done and then dropping its chunks, so
+// that only a region and its margin is held in memory however large the
+// map.  Only the bands of the map under them are read, and features are
+// clipped to them before they are filled.  Villages are planned first,
+// once for the whole world.  The world it returns has the spawn point
+// and villages but no chunks, and Write finishes it off with the level
+// and villages files.
+func (r *Region) StreamWorld(dir string) (*world.World, error) {
+	w := r.makeWorld()
+	if err := w.SetSaveDir(dir); err != nil {
+		return nil, err
+	}
+	spawnpt := world.MakePoint(0, 0, 0)
+
+	bounds, err := r.mapExtent()
+	if err != nil {
+		return nil, err
+	}
+	layer, err := r.polygonize()
+	if err != nil {
+		return nil, err
+	}
+	plans, err := r.planVillages(layer)
+	if err != nil {
+		return nil, err
+	}
+
+	regions := regionsOf(bounds)
+	for i, rXZ := range regions {
+		if Debug {
+			log.Printf("streaming region %v (%d of %d)", rXZ, i+1, len(regions))
+		}
+		keep := regionBounds(rXZ)
+		window := keep.grow(streamMargin)
+
+		// only the bands of the region and its margin are read
+		md, err := r.readMap(&window)
+		if err != nil {
+			return nil, err
+		}
+		// the part has no save directory until it is built, so that
+		// no chunk is ever read back from the files being written
+		part := r.makeWorld()
+		pt, err := r.buildWindow(&part, md, layer, plans, r.shoreline(md), &window, &keep)
+		if err != nil {
+			return nil, err
+		}
+		if pt.Y > spawnpt.Y {
+			spawnpt = pt
+		}
+		if err := part.SetSaveDir(dir); err != nil {
+			return nil, err
+		}
+		if err := part.FlushRegion(rXZ); err != nil {
+			return nil, err
+		}
+		// a village belongs to the region its well is in
+		for _, v := range part.Villages() {
+			if keep.contains(world.XZ{X: v.Center.X, Z: v.Center.Z}) {
+				w.AddVillage(v)
+			}
+		}
+	}
+	w.SetSpawn(spawnpt)
+
+	return &w, nil
+}
+
+// planVillages plans the village of every feature with room for one,
+// keyed by feature.  A feature is read a region at a time, once to find
+// the middle of its land and again to find the column nearest it, and
+// its village is laid out from the land around that column alone.
+// However large the feature, no more than a region of it is held at
+// once, and it is planned as a whole build would plan it.
+func (r *Region) planVillages(layer gdal.Layer) (map[int64]village, error) {
+	ds, err := gdal.Open(r.mapfile, gdal.ReadOnly)
+	if err != nil {
+		return nil, wrap("planVillages", ErrMissingDataset, err)
+	}
+	defer ds.Close()
+	md, err := readBands(ds, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// eachLand passes the feature's land inside the window to fn and
+	// returns how many of its points are inside
+	bands := []int{Landcover, Elevation, River, Road}
+	eachLand := func(f Feature, window columnBounds, fn func(world.XZ, int16)) (int, error) {
+		wmd, err := readBands(ds, &window, bands)
+		if err != nil {
+			return 0, err
+		}
+		pts := f.Points(wmd, &window)
+		for _, pt := range pts {
+			if elev, ok := wmd.villageLand(pt); ok {
+				fn(pt.xz, elev)
+			}
+		}
+		return len(pts), nil
+	}
+
+	fc, ok := layer.FeatureCount(true)
+	if !ok {
+		return nil, errorf("planVillages", ErrGDAL, "outLayer.FeatureCount NOT OK")
+	}
+	plans := map[int64]village{}
+	layer.ResetReading()
+	for i := 0; i < fc; i++ {
+		f := Feature{layer.NextFeature()}
+		if !r.rules.Rule(f.LCValue()).Village {
+			continue
+		}
+		pieces := regionPieces(md.cols.intersect(envelopeBounds(f.Geometry().Envelope(), md.gti)))
+
+		var m villageMiddle
+		count := 0
+		for _, p := range pieces {
+			n, err := eachLand(f, p, func(xz world.XZ, _ int16) { m.add(xz) })
+			if err != nil {
+				return nil, err
+			}
+			count += n
+		}
+		if count < minVillageColumns || m.count < minVillageColumns {
+			continue
+		}
+		m.settle()
+		for _, p := range pieces {
+			if _, err := eachLand(f, p, func(xz world.XZ, _ int16) { m.near(xz) }); err != nil {
+				return nil, err
+			}
+		}
+
+		land := map[world.XZ]int16{}
+		if _, err := eachLand(f, villageBox(m.center), func(xz world.XZ, elev int16) { land[xz] = elev }); err != nil {
+			return nil, err
+		}
+		if v, ok := layVillage(r.seed, m.center, land); ok {
+			plans[f.FID()] = v
+		}
+	}
+	return plans, nil
+}
+
+// regionPieces splits the bounds along region file edges, so that no
+// piece is larger than a region.
+func regionPieces(b columnBounds) []columnBounds {
+	pieces := []columnBounds{}
+	if b.maxX <= b.minX || b.maxZ <= b.minZ {
+		return pieces
+	}
+	for _, rXZ := range regionsOf(b) {
+		pieces = append(pieces, regionBounds(rXZ).intersect(b))
+	}
+	return pieces
+}
+
+// regionsOf returns the region files covering the bounds, in order.
+func regionsOf(b columnBounds) []world.XZ {
+	regions := []world.XZ{}
+	for z := floorDiv(b.minZ, regionBlocks); z <= floorDiv(b.maxZ-1, regionBlocks); z++ {
+		for x := floorDiv(b.minX, regionBlocks); x <= floorDiv(b.maxX-1, regionBlocks); x++ {
+			regions = append(regions, world.XZ{X: x, Z: z})
+		}
+	}
+	return regions
+}
+
+// regionBounds returns the columns of a region file.
+func regionBounds(rXZ world.XZ) columnBounds {
+	return columnBounds{minX: rXZ.X * regionBlocks, maxX: (rXZ.X + 1) * regionBlocks, minZ: rXZ.Z * regionBlocks, maxZ: (rXZ.Z + 1) * regionBlocks}
+}
+
+// grow returns the bounds with margin more columns on every side.
+func (b columnBounds) grow(margin int32) columnBounds {
+	return columnBounds{minX: b.minX - margin, maxX: b.maxX + margin, minZ: b.minZ - margin, maxZ: b.maxZ + margin}
+}
+
+// intersect returns the columns within both bounds.  They are empty,
+// with the maximum no more than the minimum, if the bounds do not
+// overlap.
+func (b columnBounds) intersect(o columnBounds) columnBounds {
+	lo := func(a, b int32) int32 { return int32(max(int(a), int(b))) }
+	hi := func(a, b int32) int32 { return int32(min(int(a), int(b))) }
+	c := columnBounds{minX: lo(b.minX, o.minX), maxX: hi(b.maxX, o.maxX), minZ: lo(b.minZ, o.minZ), maxZ: hi(b.maxZ, o.maxZ)}
+	c.maxX, c.maxZ = lo(c.maxX, c.minX), lo(c.maxZ, c.minZ)
+	return c
+}
+
+// envelopeBounds returns the columns which may be inside an envelope in
+// map coordinates.  Map coordinates run north while columns run south,
+// and each column is named for its south edge.
+func envelopeBounds(e gdal.Envelope, gti [6]int32) columnBounds {
+	return columnBounds{
+		minX: int32(math.Floor(e.MinX() / float64(gti[1]))),
+		maxX: int32(math.Ceil(e.MaxX() / float64(gti[1]))),
+		minZ: int32(math.Floor(e.MaxY()/float64(gti[5]))) + 1,
+		maxZ: int32(math.Ceil(e.MinY()/float64(gti[5]))) + 1,
+	}
+}
+
+// overlaps reports whether an envelope in map coordinates reaches into
+// the bounds.  Map coordinates run north while columns run south.
+func (b columnBounds) overlaps(e gdal.Envelope, gti [6]int32) bool {
+	minX, maxX := int32(e.MinX())/gti[1], int32(e.MaxX())/gti[1]
+	minZ, maxZ := int32(e.MaxY())/gti[5], int32(e.MinY())/gti[5]
+	return minX < b.maxX && maxX >= b.minX && minZ < b.maxZ && maxZ >= b.minZ
+}
+
+// floorDiv divides, rounding toward negative infinity.
+func floorDiv(a int32, b int32) int32 {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
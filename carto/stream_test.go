@@ -0,0 +1,133 @@
+package carto
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mathuin/terroir/world"
+)
+
+var regionsOf_tests = []struct {
+	bounds  columnBounds
+	regions []world.XZ
+}{
+	{columnBounds{minX: 0, maxX: 512, minZ: 0, maxZ: 512}, []world.XZ{{X: 0, Z: 0}}},
+	{columnBounds{minX: 10, maxX: 20, minZ: 10, maxZ: 20}, []world.XZ{{X: 0, Z: 0}}},
+	{columnBounds{minX: 500, maxX: 513, minZ: 0, maxZ: 10}, []world.XZ{{X: 0, Z: 0}, {X: 1, Z: 0}}},
+	{columnBounds{minX: -1, maxX: 1, minZ: -513, maxZ: -512}, []world.XZ{{X: -1, Z: -2}, {X: 0, Z: -2}}},
+	{columnBounds{minX: -600, maxX: 0, minZ: 0, maxZ: 600}, []world.XZ{{X: -2, Z: 0}, {X: -1, Z: 0}, {X: -2, Z: 1}, {X: -1, Z: 1}}},
+}
+
+func Test_regionsOf(t *testing.T) {
+	for _, tt := range regionsOf_tests {
+		if regions := regionsOf(tt.bounds); !reflect.DeepEqual(regions, tt.regions) {
+			t.Errorf("given %v, expected %v, got %v", tt.bounds, tt.regions, regions)
+		}
+	}
+}
+
+func Test_regionBounds(t *testing.T) {
+	for _, rXZ := range []world.XZ{{X: 0, Z: 0}, {X: -1, Z: 2}, {X: 3, Z: -4}} {
+		b := regionBounds(rXZ)
+		if regions := regionsOf(b); !reflect.DeepEqual(regions, []world.XZ{rXZ}) {
+			t.Errorf("region %v: bounds %v cover %v", rXZ, b, regions)
+		}
+		window := b.grow(streamMargin)
+		for _, xz := range []world.XZ{{X: b.minX, Z: b.minZ}, {X: b.maxX - 1, Z: b.maxZ - 1}} {
+			if !b.contains(xz) || !window.contains(xz) {
+				t.Errorf("region %v: expected %v inside", rXZ, xz)
+			}
+			if chunk := xz.Point(0).ChunkXZ(); (world.XZ{X: chunk.X >> 5, Z: chunk.Z >> 5}) != rXZ {
+				t.Errorf("region %v: column %v is in the chunk %v of another region", rXZ, xz, chunk)
+			}
+		}
+		for _, xz := range []world.XZ{{X: b.minX - 1, Z: b.minZ}, {X: b.maxX, Z: b.maxZ - 1}} {
+			if b.contains(xz) || !window.contains(xz) {
+				t.Errorf("region %v: expected %v in the margin only", rXZ, xz)
+			}
+		}
+		if window.contains(world.XZ{X: b.maxX + streamMargin, Z: b.minZ}) {
+			t.Errorf("region %v: expected the margin to end", rXZ)
+		}
+	}
+}
+
+var intersect_tests = []struct {
+	a, b, want columnBounds
+}{
+	{columnBounds{0, 10, 0, 10}, columnBounds{5, 20, -5, 5}, columnBounds{5, 10, 0, 5}},
+	{columnBounds{0, 10, 0, 10}, columnBounds{2, 3, 4, 5}, columnBounds{2, 3, 4, 5}},
+	// no overlap leaves them empty
+	{columnBounds{0, 10, 0, 10}, columnBounds{20, 30, 0, 10}, columnBounds{20, 20, 0, 10}},
+	{columnBounds{0, 10, 0, 10}, columnBounds{0, 10, -20, -10}, columnBounds{0, 10, 0, 0}},
+}
+
+func Test_intersect(t *testing.T) {
+	for _, tt := range intersect_tests {
+		if got := tt.a.intersect(tt.b); got != tt.want {
+			t.Errorf("given %v and %v, expected %v, got %v", tt.a, tt.b, tt.want, got)
+		}
+		if got := tt.b.intersect(tt.a); got != tt.want {
+			t.Errorf("given %v and %v, expected %v, got %v", tt.b, tt.a, tt.want, got)
+		}
+	}
+}
+
+var regionPieces_tests = []struct {
+	bounds columnBounds
+	pieces int
+}{
+	{columnBounds{minX: 10, maxX: 20, minZ: 10, maxZ: 20}, 1},
+	{columnBounds{minX: 0, maxX: 512, minZ: 0, maxZ: 512}, 1},
+	// a feature larger than a region
+	{columnBounds{minX: -100, maxX: 1100, minZ: 10, maxZ: 600}, 8},
+	{columnBounds{minX: 5, maxX: 5, minZ: 0, maxZ: 10}, 0},
+}
+
+func Test_regionPieces(t *testing.T) {
+	for _, tt := range regionPieces_tests {
+		pieces := regionPieces(tt.bounds)
+		if len(pieces) != tt.pieces {
+			t.Errorf("given %v, expected %d pieces, got %v", tt.bounds, tt.pieces, pieces)
+			continue
+		}
+		area := int64(0)
+		for i, p := range pieces {
+			if p.maxX-p.minX > regionBlocks || p.maxZ-p.minZ > regionBlocks || len(regionsOf(p)) != 1 {
+				t.Errorf("given %v, piece %v is not within one region", tt.bounds, p)
+			}
+			if p.intersect(tt.bounds) != p {
+				t.Errorf("given %v, piece %v is outside it", tt.bounds, p)
+			}
+			for _, q := range pieces[i+1:] {
+				if o := p.intersect(q); o.maxX > o.minX && o.maxZ > o.minZ {
+					t.Errorf("given %v, pieces %v and %v overlap", tt.bounds, p, q)
+				}
+			}
+			area += int64(p.maxX-p.minX) * int64(p.maxZ-p.minZ)
+		}
+		if want := int64(tt.bounds.maxX-tt.bounds.minX) * int64(tt.bounds.maxZ-tt.bounds.minZ); area != want {
+			t.Errorf("given %v, expected pieces covering %d columns, got %d", tt.bounds, want, area)
+		}
+	}
+}
+
+func Test_streamMargin(t *testing.T) {
+	// light from the margin reaches as far into the region as it would
+	// in a whole build
+	if streamMargin < world.MaxLight {
+		t.Errorf("margin %d is narrower than light spreads, %d", streamMargin, world.MaxLight)
+	}
+	// and the margin is made of whole chunks
+	if streamMargin%16 != 0 {
+		t.Errorf("margin %d is not a whole number of chunks", streamMargin)
+	}
+}
+
+func Test_floorDiv(t *testing.T) {
+	for _, tt := range [][3]int32{{0, 512, 0}, {511, 512, 0}, {512, 512, 1}, {-1, 512, -1}, {-512, 512, -1}, {-513, 512, -2}} {
+		if got := floorDiv(tt[0], tt[1]); got != tt[2] {
+			t.Errorf("%d / %d: expected %d, got %d", tt[0], tt[1], tt[2], got)
+		}
+	}
+}
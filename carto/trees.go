@@ -0,0 +1,197 @@
+package carto
+
+import (
+	"fmt"
+
+	"github.com/mathuin/terroir/world"
+)
+
+// A structure is built on top of the terrain once every column is in
+// place, since it may reach into its neighbors.  The base is the first
+// block above the column.
+type structure interface {
+	build(w *world.World, base world.Point) error
+}
+
+// A treeKind describes the blocks and the range of trunk heights of one
+// kind of tree.  Conifers have layered leaves up most of the trunk,
+// while broadleaf trees have a round crown at the top.
+type treeKind struct {
+	wood      string
+	leaves    string
+	minHeight int32
+	maxHeight int32
+	conifer   bool
+}
+
+// treeKinds holds the kinds of tree a rule may grow, by name.
+var treeKinds = map[string]treeKind{
+	"oak":    {wood: "Oak Wood (Vertical)", leaves: "Oak Leaves", minHeight: 4, maxHeight: 6},
+	"birch":  {wood: "Birch Wood (Vertical)", leaves: "Birch Leaves", minHeight: 5, maxHeight: 7},
+	"spruce": {wood: "Spruce Wood (Vertical)", leaves: "Spruce Leaves", minHeight: 6, maxHeight: 9, conifer: true},
+}
+
+// how far leaves reach from the trunk
+const treeRadius = 2
+
+// A tree is a trunk of height blocks with leaves around and above it.
+type tree struct {
+	kind   treeKind
+	height int32
+	// corners of the crown are trimmed at random
+	seed int64
+}
+
+// A leafLayer is a square of leaves around the trunk.  Unless corners
+// is set, its corners are left off.
+type leafLayer struct {
+	y       int32
+	radius  int32
+	corners bool
+}
+
+// tree picks the tree, if any, which grows on a column.  Without canopy
+// data each kind of tree in the rule covers a share of the columns equal
+// to its density.  With it, trees grow as often as the canopy percentage
+// calls for, in the proportions of the rule's densities.
+func (rule Rule) tree(seed int64, xz world.XZ, canopy int16) (tree, bool) {
+	densities := rule.Trees
+	if canopy != coverNodata {
+		densities = canopyDensities(rule.Trees, canopy)
+	}
+	name, ok := pick(densities, chance(seed, xz, saltTree))
+	if !ok {
+		return tree{}, false
+	}
+	kind := treeKinds[name]
+	height := kind.minHeight + int32(hash(seed, xz, saltTreeHeight)%uint64(kind.maxHeight-kind.minHeight+1))
+	return tree{kind: kind, height: height, seed: seed}, true
+}
+
+// canopyDensities scales tree densities so that trees cover the canopy
+// percentage of the land.  Rules without trees grow oaks, since canopy
+// data finds trees in yards and parks too.
+func canopyDensities(trees map[string]float64, canopy int16) map[string]float64 {
+	total := 0.0
+	for _, density := range trees {
+		total += density
+	}
+	if total == 0 {
+		trees, total = map[string]float64{"oak": 1}, 1
+	}
+	scale := float64(canopy) / 100 / crownArea / total
+	densities := make(map[string]float64, len(trees))
+	for name, density := range trees {
+		densities[name] = density * scale
+	}
+	return densities
+}
+
+// layers returns the leaves of the tree from the top down.
+func (t tree) layers() []leafLayer {
+	h := t.height
+	if t.kind.conifer {
+		layers := []leafLayer{{h, 0, false}}
+		for y := h - 1; y >= 2; y-- {
+			layers = append(layers, leafLayer{y, 1 + (h-1-y)%2, false})
+		}
+		return layers
+	}
+	return []leafLayer{{h, 1, false}, {h - 1, 1, true}, {h - 2, 2, true}, {h - 3, 2, true}}
+}
+
+// build writes the trunk and then the leaves, which only fill air so
+// that they never cut into the terrain or another tree's trunk.
+func (t tree) build(w *world.World, base world.Point) error {
+	wood, err := world.BlockNamed(t.kind.wood)
+	if err != nil {
+		return err
+	}
+	leaves, err := world.BlockNamed(t.kind.leaves)
+	if err != nil {
+		return err
+	}
+	air := world.MakeBlock(0, 0)
+
+	for y := int32(0); y < t.height; y++ {
+		if err := w.SetBlock(world.MakePoint(base.X, base.Y+y, base.Z), *wood); err != nil {
+			return fmt.Errorf("tree at %s: %s", base, err)
+		}
+	}
+	for _, l := range t.layers() {
+		for dz := -l.radius; dz <= l.radius; dz++ {
+			for dx := -l.radius; dx <= l.radius; dx++ {
+				if l.radius > 0 && abs32(dx) == l.radius && abs32(dz) == l.radius {
+					xz := world.XZ{X: base.X + dx, Z: base.Z + dz}
+					if !l.corners || hash(t.seed, xz, saltLeaves|uint64(l.y)<<32)%2 == 0 {
+						continue
+					}
+				}
+				pt := world.MakePoint(base.X+dx, base.Y+l.y, base.Z+dz)
+				b, err := w.Block(pt)
+				if err != nil {
+					return fmt.Errorf("tree at %s: %s", base, err)
+				}
+				if *b != air {
+					continue
+				}
+				if err := w.SetBlock(pt, *leaves); err != nil {
+					return fmt.Errorf("tree at %s: %s", base, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func abs32(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// columnBounds are the columns covered by the map.  Anything reaching
+// past them would create chunks outside the region.
+type columnBounds struct {
+	minX, maxX int32
+	minZ, maxZ int32
+}
+
+// mapBounds returns the bounds of a map with the given geotransform and
+// size.
+func mapBounds(gti [6]int32, inx int, iny int) columnBounds {
+	minX := gti[0] / gti[1]
+	minZ := gti[3] / gti[5]
+	return columnBounds{minX: minX, maxX: minX + int32(inx), minZ: minZ, maxZ: minZ + int32(iny)}
+}
+
+// inside reports whether everything within margin blocks of the column
+// is well inside the bounds.
+func (b columnBounds) inside(xz world.XZ, margin int32) bool {
+	return xz.X-margin > b.minX && xz.X+margin < b.maxX && xz.Z-margin > b.minZ && xz.Z+margin < b.maxZ
+}
+
+// contains reports whether the column is within the bounds.
+func (b columnBounds) contains(xz world.XZ) bool {
+	return xz.X >= b.minX && xz.X < b.maxX && xz.Z >= b.minZ && xz.Z < b.maxZ
+}
+
+// validateDensities checks that every name is known, that every
+// density is between 0 and 1, and that they total no more than 1.
+func validateDensities(what string, densities map[string]float64, known func(string) bool) error {
+	total := 0.0
+	for name, density := range densities {
+		if !known(name) {
+			return fmt.Errorf("%s %q not found", what, name)
+		}
+		if density < 0 || density > 1 {
+			return fmt.Errorf("%s %q density %f must be between 0 and 1", what, name, density)
+		}
+		total += density
+	}
+	if total > 1 {
+		return fmt.Errorf("%s densities total %f, more than 1", what, total)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package carto
+
+import (
+	"math"
+	"testing"
+
+	"github.com/mathuin/terroir/world"
+)
+
+func Test_hash(t *testing.T) {
+	xz := world.XZ{X: 100, Z: -200}
+	if hash(1, xz, saltTree) != hash(1, xz, saltTree) {
+		t.Error("hash is not deterministic")
+	}
+	for _, other := range []uint64{hash(2, xz, saltTree), hash(1, world.XZ{X: 101, Z: -200}, saltTree), hash(1, xz, saltTreeHeight)} {
+		if other == hash(1, xz, saltTree) {
+			t.Error("hash ignores its input")
+		}
+	}
+}
+
+var tree_tests = []struct {
+	rule  Rule
+	kinds []string
+}{
+	{NLCDRules.Default, nil},
+	{deciduousRule, []string{"birch", "oak"}},
+	{evergreenRule, []string{"spruce"}},
+	{mixedRule, []string{"birch", "oak", "spruce"}},
+}
+
+func Test_tree(t *testing.T) {
+	const side = 200
+	for _, tt := range tree_tests {
+		counts := map[string]int{}
+		for x := int32(0); x < side; x++ {
+			for z := int32(0); z < side; z++ {
+				tr, ok := tt.rule.tree(42, world.XZ{X: x, Z: z}, coverNodata)
+				if !ok {
+					continue
+				}
+				if tr.height < tr.kind.minHeight || tr.height > tr.kind.maxHeight {
+					t.Errorf("%s: height %d out of range", tr.kind.wood, tr.height)
+				}
+				for name, kind := range treeKinds {
+					if kind == tr.kind {
+						counts[name]++
+					}
+				}
+			}
+		}
+		if len(counts) != len(tt.kinds) {
+			t.Errorf("%s: expected kinds %v, got %v", tt.rule.Biome, tt.kinds, counts)
+		}
+		for _, name := range tt.kinds {
+			want := tt.rule.Trees[name] * side * side
+			if math.Abs(float64(counts[name])-want) > want/4 {
+				t.Errorf("%s: expected about %.0f %s trees, got %d", tt.rule.Biome, want, name, counts[name])
+			}
+		}
+	}
+}
+
+func Test_treeBuild(t *testing.T) {
+	w := world.MakeWorld("trees")
+	base := world.MakePoint(8, 64, 8)
+	air := world.MakeBlock(0, 0)
+	for _, name := range []string{"oak", "birch", "spruce"} {
+		tr := tree{kind: treeKinds[name], height: treeKinds[name].maxHeight, seed: 1}
+		if err := tr.build(&w, base); err != nil {
+			t.Fatal(err)
+		}
+		wood, _ := world.BlockNamed(tr.kind.wood)
+		leaves, _ := world.BlockNamed(tr.kind.leaves)
+		for y := int32(0); y < tr.height; y++ {
+			b, err := w.Block(world.MakePoint(base.X, base.Y+y, base.Z))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *b != *wood {
+				t.Errorf("%s: expected wood at %d, got %v", name, y, *b)
+			}
+		}
+		b, err := w.Block(world.MakePoint(base.X, base.Y+tr.height, base.Z))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *b != *leaves {
+			t.Errorf("%s: expected leaves on top, got %v", name, *b)
+		}
+		for _, pt := range []world.Point{world.MakePoint(base.X+treeRadius+1, base.Y+tr.height-2, base.Z), world.MakePoint(base.X, base.Y+tr.height+1, base.Z)} {
+			b, err := w.Block(pt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *b != air {
+				t.Errorf("%s: expected air at %s, got %v", name, pt, *b)
+			}
+		}
+		// clear the trunk for the next kind
+		for y := int32(0); y <= tr.height; y++ {
+			w.SetBlock(world.MakePoint(base.X, base.Y+y, base.Z), air)
+		}
+	}
+}
+
+var columnBounds_tests = []struct {
+	xz     world.XZ
+	inside bool
+}{
+	{world.XZ{X: 100, Z: -200}, true},
+	{world.XZ{X: 97, Z: -200}, true},
+	{world.XZ{X: 96, Z: -200}, false},
+	{world.XZ{X: 100, Z: -300}, false},
+	{world.XZ{X: 113, Z: -180}, false},
+}
+
+func Test_columnBounds(t *testing.T) {
+	// 20 by 30 columns at scale 6 with the corner at X 94, Z -210
+	b := mapBounds([6]int32{564, 6, 0, 1260, 0, -6}, 20, 30)
+	for _, tt := range columnBounds_tests {
+		if got := b.inside(tt.xz, treeRadius); got != tt.inside {
+			t.Errorf("given %v, expected %v, got %v", tt.xz, tt.inside, got)
+		}
+	}
+}
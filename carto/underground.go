@@ -0,0 +1,266 @@
+package carto
+
+import (
+	"math"
+	"sort"
+
+	"github.com/mathuin/terroir/world"
+)
+
+// The underground is dug out once every column is in place, since caves
+// and veins of ore cross from one column to the next.  Every choice is
+// a hash of the world seed, so the same seed always digs the same caves.
+
+// An ore is scattered through each chunk in veins of up to size blocks,
+// as in vanilla.  Veins start evenly between minY and maxY, or around
+// the middle of them if centered.
+type ore struct {
+	name     string
+	veins    int
+	size     int
+	minY     int32
+	maxY     int32
+	centered bool
+}
+
+var ores = []ore{
+	{name: "Coal Ore", veins: 20, size: 17, minY: 0, maxY: 128},
+	{name: "Iron Ore", veins: 20, size: 9, minY: 0, maxY: 64},
+	{name: "Gold Ore", veins: 2, size: 9, minY: 0, maxY: 32},
+	{name: "Redstone Ore", veins: 8, size: 8, minY: 0, maxY: 16},
+	{name: "Diamond Ore", veins: 1, size: 8, minY: 0, maxY: 16},
+	{name: "Lapis Lazuli Ore", veins: 1, size: 7, minY: 0, maxY: 32, centered: true},
+}
+
+// Caves are the tunnels where two noise fields both come close to
+// zero.  The fields are stretched sideways, so tunnels run mostly level.
+const (
+	caveScale  = 16.0
+	caveSquash = 2.0
+	caveWidth  = 0.08
+	// nothing is dug below this, to keep the bedrock whole
+	caveFloor = 6
+)
+
+// One chunk in ravineEvery has a ravine: a long, narrow cut up to
+// ravineDepth blocks deep.
+const (
+	ravineEvery     = 64
+	ravineMinLength = 32
+	ravineMaxLength = 80
+	ravineDepth     = 24
+	ravineWidth     = 3
+)
+
+// diggable holds the blocks caves are dug out of and ores replace.
+var diggable = map[world.Block]bool{}
+
+// flooding holds the blocks no cave may open on to: water, and the sand
+// and gravel which would fall in and let it through.
+var flooding = map[world.Block]bool{}
+
+func init() {
+	for _, name := range []string{"Stone", "Granite", "Diorite", "Andesite"} {
+		b, err := world.BlockNamed(name)
+		if err != nil {
+			panic(err)
+		}
+		diggable[*b] = true
+	}
+	for _, name := range []string{"Water", "Ice", "Lava", "Sand", "Gravel"} {
+		b, err := world.BlockNamed(name)
+		if err != nil {
+			panic(err)
+		}
+		flooding[*b] = true
+	}
+}
+
+// underground digs caves and ravines and then scatters ore through the
+// stone of the columns, which maps each column to its height.
+func underground(w *world.World, columns map[world.XZ]int32) error {
+	seed := w.RandomSeed
+	air, err := world.BlockNamed("Air")
+	if err != nil {
+		return err
+	}
+
+	for xz, height := range columns {
+		for y := int32(caveFloor); y < height; y++ {
+			if !cave(seed, float64(xz.X), float64(y), float64(xz.Z)) {
+				continue
+			}
+			if err := dig(w, xz.Point(y), *air); err != nil {
+				return err
+			}
+		}
+	}
+
+	chunks := chunksOf(columns)
+	for _, cXZ := range chunks {
+		if err := ravine(w, seed, cXZ, *air); err != nil {
+			return err
+		}
+	}
+	for _, cXZ := range chunks {
+		for i, o := range ores {
+			if err := o.scatter(w, seed, cXZ, uint64(i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// chunksOf returns the chunks the columns are in, in order.
+func chunksOf(columns map[world.XZ]int32) []world.XZ {
+	seen := map[world.XZ]bool{}
+	chunks := []world.XZ{}
+	for xz := range columns {
+		cXZ := xz.Point(0).ChunkXZ()
+		if !seen[cXZ] {
+			seen[cXZ] = true
+			chunks = append(chunks, cXZ)
+		}
+	}
+	sort.Slice(chunks, func(i, j int) bool {
+		if chunks[i].Z != chunks[j].Z {
+			return chunks[i].Z < chunks[j].Z
+		}
+		return chunks[i].X < chunks[j].X
+	})
+	return chunks
+}
+
+// block returns the block at a point, and false if the point is not in
+// any chunk of the world.
+func block(w *world.World, pt world.Point) (world.Block, bool) {
+	if !w.HasChunk(pt.ChunkXZ()) || pt.Y < 0 || pt.Y >= tileheight {
+		return world.Block{}, false
+	}
+	b, err := w.Block(pt)
+	if err != nil {
+		return world.Block{}, false
+	}
+	return *b, true
+}
+
+// dig replaces a diggable block unless it is next to a flooding one.
+func dig(w *world.World, pt world.Point, b world.Block) error {
+	here, ok := block(w, pt)
+	if !ok || !diggable[here] {
+		return nil
+	}
+	for _, d := range [][3]int32{{1, 0, 0}, {-1, 0, 0}, {0, 1, 0}, {0, -1, 0}, {0, 0, 1}, {0, 0, -1}} {
+		if next, ok := block(w, world.MakePoint(pt.X+d[0], pt.Y+d[1], pt.Z+d[2])); ok && flooding[next] {
+			return nil
+		}
+	}
+	return w.SetBlock(pt, b)
+}
+
+// cave reports whether a block is inside a cave.
+func cave(seed int64, x float64, y float64, z float64) bool {
+	x, y, z = x/caveScale, y*caveSquash/caveScale, z/caveScale
+	return math.Abs(noise(seed, saltCave, x, y, z)) < caveWidth && math.Abs(noise(seed, saltTunnel, x, y, z)) < caveWidth
+}
+
+// noise is smooth value noise in [-1, 1] with features about one unit
+// apart.
+func noise(seed int64, salt uint64, x float64, y float64, z float64) float64 {
+	x0, y0, z0 := math.Floor(x), math.Floor(y), math.Floor(z)
+	fx, fy, fz := smoothstep(x-x0), smoothstep(y-y0), smoothstep(z-z0)
+	lattice := func(dx, dy, dz float64) float64 {
+		xz := world.XZ{X: int32(x0 + dx), Z: int32(z0 + dz)}
+		return chance(seed, xz, salt|uint64(uint32(int32(y0+dy)))<<32)*2 - 1
+	}
+	lerp := func(a, b, t float64) float64 { return a + (b-a)*t }
+	return lerp(
+		lerp(lerp(lattice(0, 0, 0), lattice(1, 0, 0), fx), lerp(lattice(0, 0, 1), lattice(1, 0, 1), fx), fz),
+		lerp(lerp(lattice(0, 1, 0), lattice(1, 1, 0), fx), lerp(lattice(0, 1, 1), lattice(1, 1, 1), fx), fz),
+		fy)
+}
+
+func smoothstep(t float64) float64 {
+	return t * t * (3 - 2*t)
+}
+
+// ravine digs the chunk's ravine, if it has one.  Ravines are widest and
+// deepest in the middle and taper to nothing at the ends.
+func ravine(w *world.World, seed int64, cXZ world.XZ, air world.Block) error {
+	h := hash(seed, cXZ, saltRavine)
+	if h%ravineEvery != 0 {
+		return nil
+	}
+	h /= ravineEvery
+	length := float64(ravineMinLength + int(h%(ravineMaxLength-ravineMinLength)))
+	angle := chance(seed, cXZ, saltRavineAngle) * 2 * math.Pi
+	floor := float64(caveFloor + int(hash(seed, cXZ, saltRavineFloor)%32))
+	x0, z0 := float64(cXZ.X*16+8), float64(cXZ.Z*16+8)
+	dx, dz := math.Cos(angle), math.Sin(angle)
+
+	for t := 0.0; t < length; t++ {
+		taper := math.Sin(math.Pi * t / length)
+		width := ravineWidth * taper
+		top := floor + ravineDepth*taper
+		cx, cz := x0+dx*t, z0+dz*t
+		for x := math.Floor(cx - width); x <= cx+width; x++ {
+			for z := math.Floor(cz - width); z <= cz+width; z++ {
+				if math.Hypot(x-cx, z-cz) > width {
+					continue
+				}
+				for y := floor; y < top; y++ {
+					if err := dig(w, world.MakePoint(int32(x), int32(y), int32(z)), air); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// scatter lays the ore's veins in a chunk.  Each vein wanders from its
+// start a block at a time, replacing any diggable block it passes.
+func (o ore) scatter(w *world.World, seed int64, cXZ world.XZ, index uint64) error {
+	b, err := world.BlockNamed(o.name)
+	if err != nil {
+		return err
+	}
+	span := uint64(o.maxY - o.minY)
+	for v := 0; v < o.veins; v++ {
+		salt := saltOre | index<<8 | uint64(v)<<16
+		h := hash(seed, cXZ, salt)
+		x := cXZ.X*16 + int32(h%16)
+		z := cXZ.Z*16 + int32(h/16%16)
+		y := o.minY + int32(h/256%span)
+		if o.centered {
+			// the sum of two rolls peaks in the middle
+			y = o.minY + int32((h/256%span+h/256/span%span)/2)
+		}
+		for i := 0; i < o.size; i++ {
+			pt := world.MakePoint(x, y, z)
+			if here, ok := block(w, pt); ok && diggable[here] {
+				if err := w.SetBlock(pt, *b); err != nil {
+					return err
+				}
+			}
+			step := hash(seed, cXZ, salt|uint64(i+1)<<32) % 6
+			switch step {
+			case 0:
+				x++
+			case 1:
+				x--
+			case 2:
+				y++
+			case 3:
+				y--
+			case 4:
+				z++
+			case 5:
+				z--
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package carto
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mathuin/terroir/world"
+)
+
+func Test_noise(t *testing.T) {
+	for i := 0; i < 1000; i++ {
+		x, y, z := float64(i)*0.37, float64(i)*0.11, float64(i)*-0.53
+		n := noise(42, saltCave, x, y, z)
+		if n < -1 || n > 1 {
+			t.Fatalf("noise at %f, %f, %f is %f", x, y, z, n)
+		}
+		if again := noise(42, saltCave, x, y, z); again != n {
+			t.Fatalf("noise at %f, %f, %f is not deterministic", x, y, z)
+		}
+		// smooth at small steps
+		if next := noise(42, saltCave, x+0.01, y, z); next-n > 0.1 || n-next > 0.1 {
+			t.Fatalf("noise jumps from %f to %f at %f, %f, %f", n, next, x, y, z)
+		}
+	}
+	if noise(42, saltCave, 0, 0, 0) == noise(43, saltCave, 0, 0, 0) {
+		t.Error("expected different seeds to make different noise")
+	}
+}
+
+// undergroundWorld builds four chunks of stone with a lake on the west
+// side, and digs its underground.
+func undergroundWorld(t *testing.T, seed int64) (*world.World, map[world.XZ]int32) {
+	w := world.MakeWorld("underground")
+	w.SetRandomSeed(seed)
+	names := map[int32]string{0: "Bedrock", 60: "Grass Block"}
+	columns := map[world.XZ]int32{}
+	for x := int32(0); x < 32; x++ {
+		for z := int32(0); z < 32; z++ {
+			xz := world.XZ{X: x, Z: z}
+			for y := int32(0); y <= 60; y++ {
+				name, ok := names[y]
+				switch {
+				case x < 8 && y > 40:
+					name = "Water"
+				case !ok:
+					name = "Stone"
+				}
+				b, _ := world.BlockNamed(name)
+				w.SetBlock(xz.Point(y), *b)
+			}
+			columns[xz] = 61
+		}
+	}
+	if err := underground(&w, columns); err != nil {
+		t.Fatal(err)
+	}
+	return &w, columns
+}
+
+func Test_underground(t *testing.T) {
+	w, columns := undergroundWorld(t, 42)
+	water, _ := world.BlockNamed("Water")
+	air, _ := world.BlockNamed("Air")
+	bedrock, _ := world.BlockNamed("Bedrock")
+	counts := map[string]int{}
+	for xz := range columns {
+		for y := int32(0); y < 61; y++ {
+			b, _ := block(w, xz.Point(y))
+			name, _ := b.BlockName()
+			counts[name]++
+			if y == 0 && b != *bedrock {
+				t.Errorf("expected bedrock under %v, got %s", xz, name)
+			}
+			if b != *air || y > 40 && xz.X < 8 {
+				continue
+			}
+			for _, d := range [][3]int32{{1, 0, 0}, {-1, 0, 0}, {0, 1, 0}, {0, -1, 0}, {0, 0, 1}, {0, 0, -1}} {
+				if next, ok := block(w, world.MakePoint(xz.X+d[0], y+d[1], xz.Z+d[2])); ok && next == *water {
+					t.Errorf("cave at %v, %d opens on to water", xz, y)
+				}
+			}
+		}
+	}
+	if counts["Air"] == 0 {
+		t.Error("expected caves")
+	}
+	for _, name := range []string{"Coal Ore", "Iron Ore"} {
+		if counts[name] == 0 {
+			t.Errorf("expected %s", name)
+		}
+	}
+
+	again, _ := undergroundWorld(t, 42)
+	if !reflect.DeepEqual(w.ChunkMap, again.ChunkMap) {
+		t.Error("underground is not deterministic")
+	}
+}
@@ -0,0 +1,383 @@
+package carto
+
+import (
+	"fmt"
+
+	"github.com/mathuin/terroir/world"
+)
+
+// Villages are laid out around a well in the middle of a feature, with
+// a path running out from it in each direction and lots along both
+// sides of each path.  Most lots have a house and the rest are farms.
+const (
+	minVillageColumns = 600
+	villageRadius     = 32
+	// paths are three wide
+	villagePathHalf = 1
+	// lots are five by five, with their middles this far from the
+	// middle of the path
+	villageLotHalf   = 2
+	villageLotOffset = villagePathHalf + 2 + villageLotHalf
+	// distance along a path from one lot to the next
+	villageLotSpacing = 8
+	villageFirstLot   = 6
+	// one lot in this many is a farm
+	villageFarmEvery = 3
+	// floor to roof
+	villageHouseHeight = 4
+	// villagers have five professions, from farmer to butcher
+	villageProfessions = 5
+)
+
+// what villages are built of
+var (
+	villagePath    = "Gravel"
+	villageWalls   = "Oak Wood Planks"
+	villageCorners = "Oak Wood (Vertical)"
+	villageFloor   = "Cobblestone"
+	villageRoof    = "Oak Wood Planks"
+	villageGlass   = "Glass"
+)
+
+// Wooden door block ID.  The lower half's data is the direction it
+// faces, and the upper half's is 8.
+const doorID = 64
+
+// what a village uses a column for
+type villagePart int
+
+const (
+	villageNone villagePart = iota
+	villagePathPart
+	villageLotPart
+)
+
+// directions paths run from the well, and their door data
+var villageDirections = []world.XZ{{X: 1}, {Z: 1}, {X: -1}, {Z: -1}}
+
+// A villageLot is a house or a farm.  Inside is the direction away from
+// the path, and the door of a house is in the wall facing the path.
+type villageLot struct {
+	center world.XZ
+	elev   int16
+	inside world.XZ
+	door   world.XZ
+	farm   bool
+}
+
+// A village is planned for a whole feature and built from the column
+// of its well.
+type village struct {
+	seed   int64
+	center world.XZ
+	parts  map[world.XZ]villagePart
+	lots   []villageLot
+}
+
+// planVillage lays out a village on land, which maps each column a
+// village may use to its elevation.  It returns false if there is no
+// room for a well and at least one house.
+func planVillage(seed int64, land map[world.XZ]int16) (village, bool) {
+	if len(land) < minVillageColumns {
+		return village{}, false
+	}
+	var m villageMiddle
+	for xz := range land {
+		m.add(xz)
+	}
+	m.settle()
+	for xz := range land {
+		m.near(xz)
+	}
+	return layVillage(seed, m.center, land)
+}
+
+// A villageMiddle finds the column of a feature's land nearest its
+// middle, where the well goes.  The land may be gathered a piece at a
+// time: every column is added to find the mean, then after settle every
+// column is offered again to find the one nearest it.
+type villageMiddle struct {
+	count  int
+	sumX   int64
+	sumZ   int64
+	mean   world.XZ
+	center world.XZ
+	best   int32
+}
+
+// add counts a column toward the mean.
+func (m *villageMiddle) add(xz world.XZ) {
+	m.count++
+	m.sumX += int64(xz.X)
+	m.sumZ += int64(xz.Z)
+}
+
+// settle works out the mean of the columns added.
+func (m *villageMiddle) settle() {
+	if m.count > 0 {
+		m.mean = world.XZ{X: int32(m.sumX / int64(m.count)), Z: int32(m.sumZ / int64(m.count))}
+	}
+	m.best = -1
+}
+
+// near keeps the column if it is the nearest the mean so far, taking
+// the northernmost and then westernmost of any as near.
+func (m *villageMiddle) near(xz world.XZ) {
+	d := abs32(xz.X-m.mean.X) + abs32(xz.Z-m.mean.Z)
+	if m.best < 0 || d < m.best || (d == m.best && (xz.Z < m.center.Z || (xz.Z == m.center.Z && xz.X < m.center.X))) {
+		m.center, m.best = xz, d
+	}
+}
+
+// villageBox returns the columns a village with its well at center may
+// use.  Paths run no further than villageRadius from the well and lots
+// lie beside them.
+func villageBox(center world.XZ) columnBounds {
+	return columnBounds{minX: center.X, maxX: center.X + 1, minZ: center.Z, maxZ: center.Z + 1}.grow(villageRadius)
+}
+
+// layVillage lays out a village around its well at center.  Only the
+// land inside villageBox(center) is looked at.
+func layVillage(seed int64, center world.XZ, land map[world.XZ]int16) (village, bool) {
+	v := village{seed: seed, center: center, parts: map[world.XZ]villagePart{}}
+	free := func(xz world.XZ) bool {
+		_, ok := land[xz]
+		return ok && v.parts[xz] == villageNone
+	}
+	at := func(d world.XZ, along int32, across int32) world.XZ {
+		return world.XZ{X: center.X + d.X*along - d.Z*across, Z: center.Z + d.Z*along + d.X*across}
+	}
+
+	// the well and the path around it
+	for dz := int32(-villagePathHalf - 1); dz <= villagePathHalf+1; dz++ {
+		for dx := int32(-villagePathHalf - 1); dx <= villagePathHalf+1; dx++ {
+			xz := world.XZ{X: center.X + dx, Z: center.Z + dz}
+			if !free(xz) {
+				return village{}, false
+			}
+			v.parts[xz] = villagePathPart
+			if abs32(dx) <= 1 && abs32(dz) <= 1 {
+				v.parts[xz] = villageLotPart
+			}
+		}
+	}
+
+	for _, d := range villageDirections {
+		// the path runs out until it leaves the land
+		length := int32(villagePathHalf + 1)
+		for s := length + 1; s <= villageRadius; s++ {
+			ok := true
+			for q := int32(-villagePathHalf); q <= villagePathHalf; q++ {
+				ok = ok && free(at(d, s, q))
+			}
+			if !ok {
+				break
+			}
+			for q := int32(-villagePathHalf); q <= villagePathHalf; q++ {
+				v.parts[at(d, s, q)] = villagePathPart
+			}
+			length = s
+		}
+
+		for s := int32(villageFirstLot); s+villageLotHalf <= length; s += villageLotSpacing {
+			for _, side := range []int32{1, -1} {
+				if lot, ok := v.lot(land, free, at, d, s, side); ok {
+					v.lots = append(v.lots, lot)
+				}
+			}
+		}
+	}
+
+	for _, lot := range v.lots {
+		if !lot.farm {
+			return v, true
+		}
+	}
+	return village{}, false
+}
+
+// lot claims the lot beside a path, if all of it is free, along with
+// the step from the path to its door.
+func (v *village) lot(land map[world.XZ]int16, free func(world.XZ) bool, at func(world.XZ, int32, int32) world.XZ, d world.XZ, along int32, side int32) (villageLot, bool) {
+	cells := []world.XZ{}
+	for a := along - villageLotHalf; a <= along+villageLotHalf; a++ {
+		for q := int32(villageLotOffset - villageLotHalf); q <= villageLotOffset+villageLotHalf; q++ {
+			cells = append(cells, at(d, a, side*q))
+		}
+	}
+	step := at(d, along, side*(villagePathHalf+1))
+	for _, xz := range append(cells, step) {
+		if !free(xz) {
+			return villageLot{}, false
+		}
+	}
+	for _, xz := range cells {
+		v.parts[xz] = villageLotPart
+	}
+	v.parts[step] = villagePathPart
+
+	center := at(d, along, side*villageLotOffset)
+	door := at(d, along, side*(villageLotOffset-villageLotHalf))
+	return villageLot{
+		center: center,
+		elev:   land[center],
+		inside: world.XZ{X: door.X - step.X, Z: door.Z - step.Z},
+		door:   door,
+		farm:   hash(v.seed, center, saltVillageLot)%villageFarmEvery == 0,
+	}, true
+}
+
+// part returns what the village uses a column for.
+func (v village) part(xz world.XZ) villagePart {
+	return v.parts[xz]
+}
+
+// column builds the column for one point of the village.  Paths are
+// surfaced with gravel, and the well carries the village itself.
+func (v village) column(rule Rule, xz world.XZ, elev int16, bathy int16, crust int16, maxdepth int) (Column, error) {
+	if v.parts[xz] == villagePathPart {
+		rule.Surface = villagePath
+	}
+	column, err := rule.column(xz, elev, bathy, crust, maxdepth)
+	if err != nil {
+		return Column{}, err
+	}
+	if v.parts[xz] == villageLotPart {
+		column.okspawn = false
+	}
+	if xz == v.center {
+		column.structure = v
+	}
+	return column, nil
+}
+
+// build writes the well at the base, then each house and farm, and
+// adds a villager to each house and the village to the world.
+func (v village) build(w *world.World, base world.Point) error {
+	blocks := map[string]world.Block{}
+	for _, name := range []string{villageWalls, villageCorners, villageFloor, villageRoof, villageGlass, "Water", "Farmland", "Wheat", "Dirt", "Air"} {
+		block, err := world.BlockNamed(name)
+		if err != nil {
+			return err
+		}
+		blocks[name] = *block
+	}
+	set := func(x, y, z int32, b world.Block) error {
+		if err := w.SetBlock(world.MakePoint(x, y, z), b); err != nil {
+			return fmt.Errorf("village at %s: %s", base, err)
+		}
+		return nil
+	}
+
+	// the well is a pool with a rim
+	for dz := int32(-1); dz <= 1; dz++ {
+		for dx := int32(-1); dx <= 1; dx++ {
+			x, z := base.X+dx, base.Z+dz
+			rim := dx != 0 || dz != 0
+			below, above := blocks["Water"], blocks["Air"]
+			if rim {
+				below, above = blocks[villageFloor], blocks[villageFloor]
+			}
+			if err := set(x, base.Y-1, z, below); err != nil {
+				return err
+			}
+			if err := set(x, base.Y, z, above); err != nil {
+				return err
+			}
+		}
+	}
+
+	doors := []world.Door{}
+	for _, lot := range v.lots {
+		y := int32(lot.elev)
+		for dz := int32(-villageLotHalf); dz <= villageLotHalf; dz++ {
+			for dx := int32(-villageLotHalf); dx <= villageLotHalf; dx++ {
+				x, z := lot.center.X+dx, lot.center.Z+dz
+				edge := abs32(dx) == villageLotHalf || abs32(dz) == villageLotHalf
+				corner := abs32(dx) == villageLotHalf && abs32(dz) == villageLotHalf
+
+				// fill any dip beneath the lot
+				for fy := y - 1; fy >= y-maxFoundation; fy-- {
+					b, err := w.Block(world.MakePoint(x, fy, z))
+					if err != nil {
+						return fmt.Errorf("village at %s: %s", base, err)
+					}
+					if *b != blocks["Air"] {
+						break
+					}
+					if err := set(x, fy, z, blocks["Dirt"]); err != nil {
+						return err
+					}
+				}
+
+				column := lot.house(dx, dz, edge, corner, blocks)
+				if lot.farm {
+					column = lot.farmland(dx, dz, edge, blocks)
+				}
+				for i, b := range column {
+					if err := set(x, y+int32(i)-1, z, b); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		if lot.farm {
+			continue
+		}
+		doors = append(doors, world.Door{Point: lot.door.Point(y + 1), InsideX: lot.inside.X, InsideZ: lot.inside.Z})
+		profession := int32(hash(v.seed, lot.center, saltVillager) % villageProfessions)
+		if err := w.AddEntity(lot.center.Point(y+1), world.MakeVillager(lot.center.Point(y+1), profession)); err != nil {
+			return fmt.Errorf("village at %s: %s", base, err)
+		}
+	}
+
+	w.AddVillage(world.Village{Center: base, Radius: villageRadius, Population: int32(len(doors)), Doors: doors})
+	return nil
+}
+
+// house returns the blocks of one column of a house, from the ground
+// beneath the floor up to the roof.
+func (lot villageLot) house(dx, dz int32, edge bool, corner bool, blocks map[string]world.Block) []world.Block {
+	column := []world.Block{blocks[villageFloor], blocks[villageFloor]}
+	isDoor := lot.center.X+dx == lot.door.X && lot.center.Z+dz == lot.door.Z
+	for y := int32(1); y < villageHouseHeight; y++ {
+		b := blocks["Air"]
+		switch {
+		case corner:
+			b = blocks[villageCorners]
+		case isDoor && y == 1:
+			b = world.MakeBlock(doorID, doorFacing(lot.inside))
+		case isDoor && y == 2:
+			b = world.MakeBlock(doorID, 8)
+		case edge && y == 2 && (dx == 0 || dz == 0):
+			b = blocks[villageGlass]
+		case edge:
+			b = blocks[villageWalls]
+		}
+		column = append(column, b)
+	}
+	return append(column, blocks[villageRoof])
+}
+
+// farmland returns the blocks of one column of a farm: a log border,
+// and wheat either side of a water channel through the middle.
+func (lot villageLot) farmland(dx, dz int32, edge bool, blocks map[string]world.Block) []world.Block {
+	switch {
+	case edge:
+		return []world.Block{blocks[villageCorners], blocks["Air"]}
+	case dx*lot.inside.X+dz*lot.inside.Z == 0:
+		return []world.Block{blocks["Water"], blocks["Air"]}
+	}
+	return []world.Block{blocks["Farmland"], blocks["Wheat"]}
+}
+
+// doorFacing returns the data of the lower half of a door facing a
+// direction: east, south, west or north.
+func doorFacing(d world.XZ) int {
+	for i, v := range villageDirections {
+		if v == d {
+			return i
+		}
+	}
+	return 0
+}
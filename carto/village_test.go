@@ -0,0 +1,151 @@
+package carto
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mathuin/terroir/world"
+)
+
+// flatLand returns a square of land of the given half-width at one
+// elevation.
+func flatLand(half int32, elev int16) map[world.XZ]int16 {
+	land := map[world.XZ]int16{}
+	for x := -half; x <= half; x++ {
+		for z := -half; z <= half; z++ {
+			land[world.XZ{X: x, Z: z}] = elev
+		}
+	}
+	return land
+}
+
+var planVillage_tests = []struct {
+	land map[world.XZ]int16
+	ok   bool
+}{
+	{flatLand(40, 64), true},
+	{flatLand(14, 64), true},
+	{flatLand(10, 64), false},
+}
+
+func Test_planVillage(t *testing.T) {
+	for _, tt := range planVillage_tests {
+		v, ok := planVillage(42, tt.land)
+		if ok != tt.ok {
+			t.Errorf("given %d columns, expected ok %v, got %v", len(tt.land), tt.ok, ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if v.center != (world.XZ{}) {
+			t.Errorf("expected the well in the middle, got %v", v.center)
+		}
+		for xz := range v.parts {
+			if _, ok := tt.land[xz]; !ok {
+				t.Errorf("village uses %v outside the land", xz)
+			}
+		}
+		houses := 0
+		for _, lot := range v.lots {
+			for dz := int32(-villageLotHalf); dz <= villageLotHalf; dz++ {
+				for dx := int32(-villageLotHalf); dx <= villageLotHalf; dx++ {
+					if got := v.part(world.XZ{X: lot.center.X + dx, Z: lot.center.Z + dz}); got != villageLotPart {
+						t.Errorf("lot at %v: expected lot part, got %v", lot.center, got)
+					}
+				}
+			}
+			step := world.XZ{X: lot.door.X - lot.inside.X, Z: lot.door.Z - lot.inside.Z}
+			if got := v.part(step); got != villagePathPart {
+				t.Errorf("lot at %v: expected path outside the door, got %v", lot.center, got)
+			}
+			if !lot.farm {
+				houses++
+			}
+		}
+		if houses == 0 {
+			t.Error("expected houses")
+		}
+		if again, _ := planVillage(42, tt.land); len(again.lots) != len(v.lots) || again.lots[0] != v.lots[0] {
+			t.Error("village is not deterministic")
+		}
+	}
+}
+
+func Test_layVillage(t *testing.T) {
+	// land reaching across several regions
+	land := map[world.XZ]int16{}
+	for x := int32(-300); x < 900; x++ {
+		for z := int32(-100); z < 200; z++ {
+			land[world.XZ{X: x, Z: z}] = 64
+		}
+	}
+	want, ok := planVillage(42, land)
+	if !ok {
+		t.Fatal("expected a village")
+	}
+
+	// the village is laid out the same from the land around its well
+	box := villageBox(want.center)
+	if box.maxX-box.minX > regionBlocks || box.maxZ-box.minZ > regionBlocks {
+		t.Errorf("box %v is larger than a region", box)
+	}
+	near := map[world.XZ]int16{}
+	for xz, elev := range land {
+		if box.contains(xz) {
+			near[xz] = elev
+		}
+	}
+	got, ok := layVillage(42, want.center, near)
+	if !ok || !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v from the land around the well, got %v", want, got)
+	}
+	for xz := range want.parts {
+		if !box.contains(xz) {
+			t.Errorf("village uses %v outside %v", xz, box)
+		}
+	}
+}
+
+func Test_villageBuild(t *testing.T) {
+	land := flatLand(40, 64)
+	v, ok := planVillage(42, land)
+	if !ok {
+		t.Fatal("expected a village")
+	}
+	w := world.MakeWorld("villages")
+	grass, _ := world.BlockNamed("Grass Block")
+	for xz := range land {
+		w.SetBlock(xz.Point(63), *grass)
+	}
+	if err := v.build(&w, v.center.Point(64)); err != nil {
+		t.Fatal(err)
+	}
+
+	villages := w.Villages()
+	if len(villages) != 1 {
+		t.Fatalf("expected 1 village, got %d", len(villages))
+	}
+	houses := 0
+	for _, lot := range v.lots {
+		if !lot.farm {
+			houses++
+		}
+	}
+	if got := len(villages[0].Doors); got != houses {
+		t.Errorf("expected %d doors, got %d", houses, got)
+	}
+	for _, d := range villages[0].Doors {
+		b, err := w.Block(d.Point)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := world.MakeBlock(doorID, doorFacing(world.XZ{X: d.InsideX, Z: d.InsideZ})); *b != want {
+			t.Errorf("door at %s: expected %v, got %v", d.Point, want, *b)
+		}
+	}
+	water, _ := world.BlockNamed("Water")
+	if b, _ := w.Block(v.center.Point(63)); *b != *water {
+		t.Errorf("expected water in the well, got %v", *b)
+	}
+}
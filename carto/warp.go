@@ -0,0 +1,144 @@
+package carto
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/mathuin/gdal"
+)
+
+// Resampling methods for reprojecting datasets onto the map grid.
+var resampleAlgs = map[string]gdal.ResampleAlg{
+	"near":        gdal.GRA_NearestNeighbour,
+	"bilinear":    gdal.GRA_Bilinear,
+	"cubic":       gdal.GRA_Cubic,
+	"cubicspline": gdal.GRA_CubicSpline,
+	"lanczos":     gdal.GRA_Lanczos,
+	"average":     gdal.GRA_Average,
+	"mode":        gdal.GRA_Mode,
+}
+
+// resampleAlg looks up a resampling method by name.
+func resampleAlg(name string) (gdal.ResampleAlg, error) {
+	if alg, ok := resampleAlgs[strings.ToLower(strings.TrimSpace(name))]; ok {
+		return alg, nil
+	}
+	names := []string{}
+	for n := range resampleAlgs {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return 0, errorf("resample", ErrInvalidParameter, "method %q not found (known methods: %s)", name, strings.Join(names, ", "))
+}
+
+// warp options: use every core, and start from nodata so that areas
+// the source does not cover stay nodata
+var warpOptions = []string{"NUM_THREADS=ALL_CPUS", "INIT_DEST=NO_DATA"}
+
+// maximum error in pixels allowed when approximating the transformation
+const warpMaxError = 0.125
+
+// Floating point datasets without a nodata value of their own mark
+// missing pixels with the lowest float32, as gdalwarp was told with
+// -srcnodata before warping moved in-process.
+const floatSourceNodata = -math.MaxFloat32
+
+// sourceNodata returns the nodata value to warp a source band with: its
+// own, or floatSourceNodata if it is floating point and has none.
+func sourceNodata(dt gdal.DataType, nodata float64, ok bool) (float64, bool) {
+	if ok {
+		return nodata, true
+	}
+	if dt == gdal.Float32 || dt == gdal.Float64 {
+		return floatSourceNodata, true
+	}
+	return 0, false
+}
+
+// warpType returns the data type to write a warped dataset as: the one
+// asked for, or the source's if that is gdal.Unknown.
+func warpType(src gdal.DataType, dtype gdal.DataType) gdal.DataType {
+	if dtype == gdal.Unknown {
+		return src
+	}
+	return dtype
+}
+
+// warp reprojects the source dataset onto the map grid covering the
+// extents and writes it to a new GeoTIFF of the given data type, or of
+// the source's with gdal.Unknown.  Source pixels with no data are left
+// out of the resampling, and pixels the source does not cover get
+// nodata, which the data type must be able to hold.
+func (r Region) warp(src string, dst string, extents IntExtents, resample string, nodata float64, dtype gdal.DataType) error {
+	alg, err := resampleAlg(resample)
+	if err != nil {
+		return err
+	}
+
+	srcDS, err := gdal.Open(src, gdal.ReadOnly)
+	if err != nil {
+		return wrap("warp", ErrMissingDataset, err)
+	}
+	defer srcDS.Close()
+
+	// ReprojectImage honours the nodata values of the source bands, so
+	// a source without one is given one through a virtual copy
+	srcBand := srcDS.RasterBand(1)
+	ownNodata, hasNodata := srcBand.NoDataValue()
+	if srcNodata, ok := sourceNodata(srcBand.RasterDataType(), ownNodata, hasNodata); ok && !hasNodata {
+		vrt, err := gdal.GetDriverByName("VRT")
+		if err != nil {
+			return wrap("warp", ErrGDAL, err)
+		}
+		vrtDS := vrt.CreateCopy("", srcDS, 0, nil, gdal.DummyProgress, nil)
+		defer vrtDS.Close()
+		for i := 1; i <= vrtDS.RasterCount(); i++ {
+			if err := vrtDS.RasterBand(i).SetNoDataValue(srcNodata); notnil(err) {
+				return wrap("warp", ErrGDAL, err)
+			}
+		}
+		srcDS = vrtDS
+	}
+
+	mapSRS, err := spatialReference(r.proj)
+	if err != nil {
+		return err
+	}
+	mapWKT, err := mapSRS.ToWKT()
+	if notnil(err) {
+		return wrap("warp", ErrProjection, err)
+	}
+
+	driver, err := gdal.GetDriverByName("GTiff")
+	if err != nil {
+		return wrap("warp", ErrGDAL, err)
+	}
+	xsize := (extents[xMax] - extents[xMin]) / r.scale
+	ysize := (extents[yMax] - extents[yMin]) / r.scale
+	bands := srcDS.RasterCount()
+	dstDS := driver.Create(dst, xsize, ysize, bands, warpType(srcDS.RasterBand(1).RasterDataType(), dtype), nil)
+	defer dstDS.Close()
+
+	gt := [6]float64{float64(extents[xMin]), float64(r.scale), 0, float64(extents[yMax]), 0, -float64(r.scale)}
+	if err := dstDS.SetGeoTransform(gt); notnil(err) {
+		return wrap("warp", ErrGDAL, err)
+	}
+	if err := dstDS.SetProjection(mapWKT); notnil(err) {
+		return wrap("warp", ErrGDAL, err)
+	}
+	for i := 1; i <= bands; i++ {
+		band := dstDS.RasterBand(i)
+		if err := band.SetNoDataValue(nodata); notnil(err) {
+			return wrap("warp", ErrGDAL, err)
+		}
+		if err := band.Fill(nodata, 0); notnil(err) {
+			return wrap("warp", ErrGDAL, err)
+		}
+	}
+
+	if err := srcDS.ReprojectImage(srcDS.Projection(), dstDS, mapWKT, alg, 0, warpMaxError, gdal.DummyProgress, nil, warpOptions); notnil(err) {
+		return wrap("warp", ErrGDAL, err)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package carto
+
+import (
+	"testing"
+
+	"github.com/mathuin/gdal"
+)
+
+var resampleAlg_tests = []struct {
+	name string
+	alg  gdal.ResampleAlg
+	ok   bool
+}{
+	{"cubic", gdal.GRA_Cubic, true},
+	{"bilinear", gdal.GRA_Bilinear, true},
+	{"Average", gdal.GRA_Average, true},
+	{" near ", gdal.GRA_NearestNeighbour, true},
+	{"smudge", 0, false},
+}
+
+func Test_resampleAlg(t *testing.T) {
+	for _, tt := range resampleAlg_tests {
+		alg, err := resampleAlg(tt.name)
+		if tt.ok != (err == nil) {
+			t.Errorf("given %q, expected ok %v, got %v", tt.name, tt.ok, err)
+			continue
+		}
+		if alg != tt.alg {
+			t.Errorf("given %q, expected %v, got %v", tt.name, tt.alg, alg)
+		}
+	}
+}
+
+var sourceNodata_tests = []struct {
+	dt     gdal.DataType
+	nodata float64
+	ok     bool
+	want   float64
+	wantok bool
+}{
+	{gdal.Float32, -9999, true, -9999, true},
+	{gdal.Float32, 0, false, floatSourceNodata, true},
+	{gdal.Float64, 0, false, floatSourceNodata, true},
+	{gdal.Byte, 255, true, 255, true},
+	{gdal.Byte, 0, false, 0, false},
+	{gdal.Int16, 0, false, 0, false},
+}
+
+func Test_sourceNodata(t *testing.T) {
+	for _, tt := range sourceNodata_tests {
+		got, ok := sourceNodata(tt.dt, tt.nodata, tt.ok)
+		if got != tt.want || ok != tt.wantok {
+			t.Errorf("given %v %f %v, expected %f %v, got %f %v", tt.dt, tt.nodata, tt.ok, tt.want, tt.wantok, got, ok)
+		}
+	}
+}
+
+var warpType_tests = []struct {
+	src   gdal.DataType
+	dtype gdal.DataType
+	want  gdal.DataType
+}{
+	{gdal.Byte, gdal.Unknown, gdal.Byte},
+	{gdal.Int16, gdal.Unknown, gdal.Int16},
+	{gdal.Byte, gdal.Float32, gdal.Float32},
+	{gdal.UInt16, gdal.Float32, gdal.Float32},
+	{gdal.Float32, gdal.Float32, gdal.Float32},
+}
+
+func Test_warpType(t *testing.T) {
+	for _, tt := range warpType_tests {
+		if got := warpType(tt.src, tt.dtype); got != tt.want {
+			t.Errorf("given %v %v, expected %v, got %v", tt.src, tt.dtype, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+// Command terroir builds Minecraft worlds from real-world map data.
+//
+// Usage:
+//
+//	terroir buildmap   [flags]
+//	terroir buildworld [flags]
+//	terroir all        [flags]
+//
+// buildmap turns the elevation and landcover datasets into a map
+// GeoTIFF, buildworld turns an existing map GeoTIFF into a saved
+// Minecraft world, and all does both.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/mathuin/terroir/carto"
+	"github.com/mathuin/terroir/world"
+)
+
+// exit codes
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+var commands = map[string]func(r carto.Region, o *options) error{
+	"buildmap":   buildMap,
+	"buildworld": buildWorld,
+	"all":        buildAll,
+}
+
+type options struct {
+	config      string
+	name        string
+	north       float64
+	south       float64
+	east        float64
+	west        float64
+	elevation   string
+	landcover   string
+	bathy       string
+	bathyvscale int
+	hydro       string
+	riverwidth  float64
+	riverdepth  int
+	beachwidth  int
+	beachheight int
+	beachslope  int
+	lapserate   float64
+	snowlat     float64
+	icelat      float64
+	canopy      string
+	impervious  string
+	rows        string
+	transport   string
+	scheme      string
+	seed        int64
+	rules       string
+	proj        string
+	resample    string
+	nodata      float64
+	scale       int
+	vscale      int
+	trim        int
+	tilesize    int
+	sealevel    int
+	maxdepth    int
+	datasets    string
+	maps        string
+	savedir     string
+	stream      bool
+	compression string
+	complevel   int
+	debug       bool
+}
+
+func (o *options) flags(fs *flag.FlagSet) {
+	fs.StringVar(&o.config, "config", "", "region configuration file (replaces the region flags)")
+	fs.StringVar(&o.name, "name", "", "region name (required without -config)")
+	fs.Float64Var(&o.north, "north", 0, "northern latitude of the region")
+	fs.Float64Var(&o.south, "south", 0, "southern latitude of the region")
+	fs.Float64Var(&o.east, "east", 0, "eastern longitude of the region")
+	fs.Float64Var(&o.west, "west", 0, "western longitude of the region")
+	fs.StringVar(&o.elevation, "elevation", "elevation.tif", "elevation dataset file name")
+	fs.StringVar(&o.landcover, "landcover", "landcover.tif", "landcover dataset file name")
+	fs.StringVar(&o.bathy, "bathymetry", "", "optional bathymetry dataset file name")
+	fs.IntVar(&o.bathyvscale, "bathyvscale", 0, "bathymetry vertical scale in meters per block (default -vscale)")
+	fs.StringVar(&o.hydro, "hydrography", "", "optional hydrography vector file name (shapefile, GeoPackage, ...)")
+	fs.Float64Var(&o.riverwidth, "riverwidth", 0, "width in meters of rivers drawn as lines (default 12)")
+	fs.IntVar(&o.riverdepth, "riverdepth", 0, "depth in blocks of river channels (default 2)")
+	fs.IntVar(&o.beachwidth, "beachwidth", 3, "width in blocks of beaches, 0 for none")
+	fs.IntVar(&o.beachheight, "beachheight", 4, "height in blocks above sea level beaches may reach")
+	fs.IntVar(&o.beachslope, "beachslope", 3, "slope in blocks per block at which beaches become stone beaches")
+	fs.Float64Var(&o.lapserate, "lapserate", 0, "degrees Celsius the air cools per kilometer uphill (default 6.5)")
+	fs.Float64Var(&o.snowlat, "snowlatitude", 0, "latitude at which sea level is cold enough for snow (default 60)")
+	fs.Float64Var(&o.icelat, "icelatitude", 0, "latitude at which sea level is cold enough for ice (default 66)")
+	fs.StringVar(&o.canopy, "canopy", "", "optional tree canopy percentage dataset file name")
+	fs.StringVar(&o.impervious, "impervious", "", "optional impervious surface percentage dataset file name")
+	fs.StringVar(&o.transport, "transportation", "", "optional roads and railways vector file name (OSM PBF, shapefile, ...)")
+	fs.StringVar(&o.rows, "rows", carto.RowsAuto, "direction of crop rows: auto (along each field), ns or ew")
+	fs.StringVar(&o.scheme, "scheme", carto.NLCD.Name, "landcover scheme: nlcd or corine")
+	fs.Int64Var(&o.seed, "seed", 0, "world seed, which also decides where trees grow")
+	fs.StringVar(&o.rules, "rules", "", "landcover rule table file (default the scheme's built-in rules)")
+	fs.StringVar(&o.proj, "projection", carto.AlbersProjection, "map projection: albers, utm, lambert, or any proj4, WKT or EPSG definition")
+	fs.StringVar(&o.resample, "resample", "cubic", "elevation resampling method: cubic, bilinear, average, ...")
+	fs.Float64Var(&o.nodata, "nodata", 0, "elevation in meters where the elevation dataset has no data")
+	fs.IntVar(&o.scale, "scale", 6, "horizontal scale in meters per block")
+	fs.IntVar(&o.vscale, "vscale", 6, "vertical scale in meters per block")
+	fs.IntVar(&o.trim, "trim", 0, "elevation in meters to trim from the bottom")
+	fs.IntVar(&o.tilesize, "tilesize", 256, "tile size in blocks")
+	fs.IntVar(&o.sealevel, "sealevel", 62, "sea level in blocks")
+	fs.IntVar(&o.maxdepth, "maxdepth", 30, "maximum ocean depth in blocks")
+	fs.StringVar(&o.datasets, "datasets", carto.DatasetDir, "directory containing one dataset directory per region")
+	fs.StringVar(&o.maps, "maps", carto.MapsDir, "directory for generated map files")
+	fs.StringVar(&o.savedir, "savedir", ".", "directory in which to save the world")
+	fs.BoolVar(&o.stream, "stream", false, "build and save the world a region at a time, for maps too large to hold in memory")
+	fs.StringVar(&o.compression, "compression", "zlib", "chunk compression in region files: gzip, zlib or none")
+	fs.IntVar(&o.complevel, "compressionlevel", -1, "gzip or zlib level from -2 (Huffman only) to 9 (smallest), -1 for the default")
+	fs.BoolVar(&o.debug, "debug", false, "enable debug logging")
+}
+
+func (o *options) validate() error {
+	if o.config != "" {
+		return nil
+	}
+	if o.name == "" {
+		return fmt.Errorf("-name is required")
+	}
+	if o.north <= o.south {
+		return fmt.Errorf("-north %f must be greater than -south %f", o.north, o.south)
+	}
+	if o.east <= o.west {
+		return fmt.Errorf("-east %f must be greater than -west %f", o.east, o.west)
+	}
+	return nil
+}
+
+func (o *options) region() (carto.Region, error) {
+	if o.config != "" {
+		rc, err := carto.LoadRegionConfig(o.config)
+		if err != nil {
+			return carto.Region{}, err
+		}
+		o.name = rc.Name
+		return rc.Region()
+	}
+	ll := carto.FloatExtents{o.east, o.west, o.north, o.south}
+	r, err := carto.MakeRegionFull(o.name, ll, o.elevation, o.landcover, o.scale, o.vscale, o.trim, o.tilesize, o.sealevel, o.maxdepth)
+	if err != nil {
+		return carto.Region{}, err
+	}
+	if err := r.SetProjection(o.proj); err != nil {
+		return carto.Region{}, err
+	}
+	if err := r.SetResample(o.resample); err != nil {
+		return carto.Region{}, err
+	}
+	r.SetNodata(o.nodata)
+	r.SetSeed(o.seed)
+	if err := r.SetBathymetry(o.bathy, o.bathyvscale); err != nil {
+		return carto.Region{}, err
+	}
+	if err := r.SetHydrography(o.hydro, o.riverwidth, o.riverdepth); err != nil {
+		return carto.Region{}, err
+	}
+	if err := r.SetBeaches(o.beachwidth, o.beachheight, o.beachslope); err != nil {
+		return carto.Region{}, err
+	}
+	if err := r.SetClimate(o.lapserate, o.snowlat, o.icelat); err != nil {
+		return carto.Region{}, err
+	}
+	r.SetCanopy(o.canopy)
+	r.SetImpervious(o.impervious)
+	r.SetTransportation(o.transport)
+	if err := r.SetRowDirection(o.rows); err != nil {
+		return carto.Region{}, err
+	}
+	s, err := carto.LookupScheme(o.scheme)
+	if err != nil {
+		return carto.Region{}, err
+	}
+	r.SetScheme(s)
+	if o.rules != "" {
+		t, err := carto.LoadRuleTable(o.rules)
+		if err != nil {
+			return carto.Region{}, err
+		}
+		if err := r.SetRules(*t); err != nil {
+			return carto.Region{}, err
+		}
+	}
+	return r, nil
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: terroir <command> [flags]")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "commands:")
+	fmt.Fprintln(w, "  buildmap    build the map GeoTIFF from the region datasets")
+	fmt.Fprintln(w, "  buildworld  build and save a world from an existing map GeoTIFF")
+	fmt.Fprintln(w, "  all         build the map and then the world")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "run 'terroir <command> -h' for the list of flags")
+}
+
+func run(args []string, stderr io.Writer) int {
+	if len(args) < 1 {
+		usage(stderr)
+		return exitUsage
+	}
+	command, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "terroir: unknown command %q\n", args[0])
+		usage(stderr)
+		return exitUsage
+	}
+
+	o := new(options)
+	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	o.flags(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		return exitUsage
+	}
+	if err := o.validate(); err != nil {
+		fmt.Fprintf(stderr, "terroir %s: %s\n", args[0], err)
+		return exitUsage
+	}
+
+	carto.Debug = o.debug
+	world.Debug = o.debug
+	carto.DatasetDir = o.datasets
+	carto.MapsDir = o.maps
+	if err := os.MkdirAll(o.maps, 0775); err != nil {
+		fmt.Fprintf(stderr, "terroir %s: %s\n", args[0], err)
+		return exitFailure
+	}
+
+	r, err := o.region()
+	if err == nil {
+		err = r.SetCompression(o.compression, o.complevel)
+	}
+	if err == nil {
+		err = command(r, o)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "terroir %s: %s\n", args[0], err)
+		if errors.Is(err, carto.ErrInvalidParameter) {
+			return exitUsage
+		}
+		return exitFailure
+	}
+	return exitOK
+}
+
+func buildMap(r carto.Region, o *options) error {
+	log.Printf("Building map for %s", o.name)
+	return r.BuildMap()
+}
+
+func buildWorld(r carto.Region, o *options) error {
+	if o.stream {
+		log.Printf("Streaming world for %s to %s", o.name, o.savedir)
+		w, err := r.StreamWorld(o.savedir)
+		if err != nil {
+			return err
+		}
+		return w.Write()
+	}
+	log.Printf("Building world for %s", o.name)
+	w, err := r.BuildWorld()
+	if err != nil {
+		return err
+	}
+	if err := w.SetSaveDir(o.savedir); err != nil {
+		return err
+	}
+	log.Printf("Writing world to %s", o.savedir)
+	return w.Write()
+}
+
+func buildAll(r carto.Region, o *options) error {
+	if err := buildMap(r, o); err != nil {
+		return err
+	}
+	return buildWorld(r, o)
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stderr))
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+var run_tests = []struct {
+	args []string
+	code int
+}{
+	{[]string{}, exitUsage},
+	{[]string{"frobnicate"}, exitUsage},
+	{[]string{"buildmap"}, exitUsage},
+	{[]string{"buildmap", "-name", "Pie", "-north", "41.189", "-south", "41.191", "-east", "-71.575", "-west", "-71.576"}, exitUsage},
+	{[]string{"buildmap", "-name", "Pie", "-north", "41.191", "-south", "41.189", "-east", "-71.576", "-west", "-71.575"}, exitUsage},
+	{[]string{"all", "-bogus"}, exitUsage},
+	{[]string{"all", "-config", "does-not-exist.json"}, exitFailure},
+	{[]string{"buildmap", "-name", "Pie", "-north", "41.191", "-south", "41.189", "-east", "-71.575", "-west", "-71.576", "-scale", "0"}, exitUsage},
+}
+
+func Test_run(t *testing.T) {
+	for _, tt := range run_tests {
+		var stderr bytes.Buffer
+		code := run(tt.args, &stderr)
+		if code != tt.code {
+			t.Errorf("given %v, expected exit code %d, got %d (%s)", tt.args, tt.code, code, stderr.String())
+		}
+	}
+}
+
+func Test_runBadConfig(t *testing.T) {
+	f, err := ioutil.TempFile("", "*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(`{"name": `); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	var stderr bytes.Buffer
+	if code := run([]string{"all", "-config", f.Name()}, &stderr); code != exitUsage {
+		t.Errorf("expected exit code %d for a malformed config, got %d (%s)", exitUsage, code, stderr.String())
+	}
+}
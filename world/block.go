@@ -15,33 +15,49 @@ func (b Block) String() string {
 	return fmt.Sprintf("Block{block: %d, data: %d}", b.block, b.data)
 }
 
+// Block returns the block at a point.  Sections which do not exist are
+// all air.
 func (w World) Block(pt Point) (*Block, error) {
-	s, err := w.Section(pt)
+	c, err := w.Chunk(pt)
 	if err != nil {
 		return nil, err
 	}
-	base := int(s.Blocks[pt.Index()])
-	add := int(Nibble(s.Add, pt.Index()))
-	data := int(Nibble(s.Data, pt.Index()))
-	retval := base + add*256
-	b := MakeBlock(retval, data)
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	b := MakeBlock(0, 0)
+	if s, ok := c.section(pt.Y); ok {
+		b = s.block(pt.Index())
+	}
 	return &b, nil
 }
 
 func (w *World) SetBlock(pt Point, b Block) error {
 	base := byte(b.block % 256)
 	add := byte(b.block / 256)
-	s, err := w.Section(pt)
+	c, err := w.Chunk(pt)
 	if err != nil {
 		return err
 	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	s := c.makeSection(pt.Y)
 	i := pt.Index()
 	s.Blocks[i] = byte(base)
 	WriteNibble(s.Add, i, add)
 	WriteNibble(s.Data, i, byte(b.data))
+	c.updateHeight(pt, b)
 	return nil
 }
 
+// Opacity returns how much sky light the block takes away, from 0 for
+// transparent blocks to 15 for those which stop it all.
+func (b Block) Opacity() byte {
+	if o, ok := blockOpacity[b.block]; ok {
+		return o
+	}
+	return 15
+}
+
 var blockNames = map[string]Block{}
 
 func BlockNamed(name string) (*Block, error) {
@@ -1 +1,118 @@
 package world
+
+import (
+	"sync"
+	"testing"
+)
+
+var opacity_tests = []struct {
+	name    string
+	opacity byte
+}{
+	{"Air", 0},
+	{"Stone", 15},
+	{"Grass Block", 15},
+	{"Water", 3},
+	{"Ice", 3},
+	{"Spruce Leaves (No Decay)", 1},
+	{"Glass", 0},
+	{"Wheat", 0},
+	{"Snow Layer", 0},
+	{"Snow", 15},
+}
+
+func Test_Opacity(t *testing.T) {
+	for _, tt := range opacity_tests {
+		b, err := BlockNamed(tt.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := b.Opacity(); got != tt.opacity {
+			t.Errorf("%s: expected opacity %d, got %d", tt.name, tt.opacity, got)
+		}
+	}
+}
+
+// Run with -race to catch unguarded writes.
+func Test_SetBlockConcurrent(t *testing.T) {
+	w := MakeWorld("ConcurrentTest")
+	workers := 8
+	names := []string{"Stone", "Dirt", "Oak Leaves", "Water"}
+
+	// neighboring blocks share nibbles, and every worker writes to every
+	// chunk, with readers alongside
+	var wg sync.WaitGroup
+	errc := make(chan error, 2*workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			b, _ := BlockNamed(names[i%len(names)])
+			for x := int32(-32 + i); x < 32; x += int32(workers) {
+				for z := int32(-32); z < 32; z++ {
+					xz := XZ{X: x, Z: z}
+					if err := w.SetBiome(xz, byte(i)); err != nil {
+						errc <- err
+						return
+					}
+					for y := int32(0); y < 40; y++ {
+						if err := w.SetBlock(xz.Point(y), *b); err != nil {
+							errc <- err
+							return
+						}
+					}
+				}
+			}
+			if err := w.AddEntity(MakePoint(0, 40, 0), MakeVillager(MakePoint(0, 40, 0), 0)); err != nil {
+				errc <- err
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			for x := int32(-32); x < 32; x++ {
+				if _, err := w.Block(MakePoint(x, int32(i), x)); err != nil {
+					errc <- err
+					return
+				}
+				if _, err := w.HeightMap(XZ{X: x, Z: -1 - x}); err != nil {
+					errc <- err
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errc)
+	for err := range errc {
+		t.Fatal(err)
+	}
+
+	if len(w.ChunkMap) != 16 {
+		t.Errorf("expected 16 chunks, got %d", len(w.ChunkMap))
+	}
+	for x := int32(-32); x < 32; x++ {
+		i := int(x+32) % workers
+		want, _ := BlockNamed(names[i%len(names)])
+		for _, z := range []int32{-32, -1, 0, 31} {
+			xz := XZ{X: x, Z: z}
+			for _, y := range []int32{0, 17, 39} {
+				got, err := w.Block(xz.Point(y))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if *got != *want {
+					t.Errorf("at %v, expected %v, got %v", xz.Point(y), want, got)
+				}
+			}
+			if biome, _ := w.Biome(xz); biome != byte(i) {
+				t.Errorf("at %v, expected biome %d, got %d", xz, i, biome)
+			}
+			if height, _ := w.HeightMap(xz); height != 40 {
+				t.Errorf("at %v, expected height 40, got %d", xz, height)
+			}
+		}
+	}
+	if n := len(w.ChunkMap[XZ{}].entities); n != workers {
+		t.Errorf("expected %d entities, got %d", workers, n)
+	}
+}
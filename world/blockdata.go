@@ -45,7 +45,7 @@ var blockData = []struct {
 	{12, 1, "Red Sand"},
 	{13, 0, "Gravel"},
 	{14, 0, "Gold Ore"},
-	{15, 0, "Iron Ore "},
+	{15, 0, "Iron Ore"},
 	{16, 0, "Coal Ore"},
 	{17, 0, "Oak Wood (Vertical)"},
 	{17, 1, "Spruce Wood (Vertical)"},
@@ -161,7 +161,7 @@ var blockData = []struct {
 	{44, 15, "Upper Quartz Slab"},
 	{45, 0, "Bricks"},
 	{46, 0, "TNT"},
-	{47, 0, "Bookshelf "},
+	{47, 0, "Bookshelf"},
 	{48, 0, "Moss Stone"},
 	{49, 0, "Obsidian"},
 	{50, 0, "Torch"},
@@ -177,7 +177,7 @@ var blockData = []struct {
 	{60, 0, "Farmland"},
 	{61, 0, "Furnace"},
 	{62, 0, "Burning Furnace"},
-	{63, 0, "Standing Sign "},
+	{63, 0, "Standing Sign"},
 	{64, 0, "Wooden Door"},
 	{65, 0, "Ladder"},
 	{66, 0, "Rail"},
@@ -192,8 +192,8 @@ var blockData = []struct {
 	{75, 0, "Redstone Torch (inactive)"},
 	{76, 0, "Redstone Torch (active)"},
 	{77, 0, "Stone Button"},
-	{78, 0, "Snow"},
-	{79, 0, "Ice "},
+	{78, 0, "Snow Layer"},
+	{79, 0, "Ice"},
 	{80, 0, "Snow"},
 	{81, 0, "Cactus"},
 	{82, 0, "Clay"},
@@ -243,7 +243,7 @@ var blockData = []struct {
 	{108, 0, "Brick Stairs"},
 	{109, 0, "Stone Brick Stairs"},
 	{110, 0, "Mycelium"},
-	{111, 0, "Lily Pad "},
+	{111, 0, "Lily Pad"},
 	{112, 0, "Nether Brick"},
 	{113, 0, "Nether Brick Fence"},
 	{114, 0, "Nether Brick Stairs"},
@@ -275,7 +275,7 @@ var blockData = []struct {
 	{126, 11, "Upper Jungle Wood Slab"},
 	{126, 12, "Upper Acacia Wood Slab"},
 	{126, 13, "Upper Dark Oak Wood Slab"},
-	{127, 0, "Cocoa "},
+	{127, 0, "Cocoa"},
 	{128, 0, "Sandstone Stairs"},
 	{129, 0, "Emerald Ore"},
 	{130, 0, "Ender Chest"},
@@ -292,7 +292,7 @@ var blockData = []struct {
 	{140, 0, "Flower Pot"},
 	{141, 7, "Carrot"},
 	{142, 7, "Potato"},
-	{143, 0, "Wooden Button "},
+	{143, 0, "Wooden Button"},
 	{144, 0, "Mob Head"},
 	{145, 0, "Anvil (North/South)"},
 	{145, 1, "Anvil (East/West)"},
@@ -422,3 +422,87 @@ var blockData = []struct {
 	{182, 0, "Red Sandstone Slab"},
 	{182, 8, "Upper Red Sandstone Slab"},
 }
+
+// blockOpacity holds how much sky light each block ID takes away, for
+// the blocks which let some through.  Every other block stops it all.
+var blockOpacity = map[int]byte{
+	0:   0, // Air
+	6:   0, // Sapling
+	8:   3, // Flowing Water
+	9:   3, // Water
+	10:  0, // Flowing Lava
+	11:  0, // Lava
+	18:  1, // Leaves
+	20:  0, // Glass
+	26:  0, // Bed
+	27:  0, // Powered Rail
+	28:  0, // Detector Rail
+	30:  1, // Cobweb
+	31:  0, // Grass
+	32:  0, // Dead Bush
+	37:  0, // Dandelion
+	38:  0, // Flowers
+	39:  0, // Brown Mushroom
+	40:  0, // Red Mushroom
+	50:  0, // Torch
+	51:  0, // Fire
+	52:  0, // Monster Spawner
+	54:  0, // Chest
+	55:  0, // Redstone Wire
+	59:  0, // Wheat
+	63:  0, // Standing Sign
+	64:  0, // Wooden Door
+	65:  0, // Ladder
+	66:  0, // Rail
+	68:  0, // Wall Sign
+	69:  0, // Lever
+	70:  0, // Stone Pressure Plate
+	71:  0, // Iron Door
+	72:  0, // Wooden Pressure Plate
+	75:  0, // Redstone Torch (Off)
+	76:  0, // Redstone Torch (On)
+	77:  0, // Stone Button
+	78:  0, // Snow Layer
+	79:  3, // Ice
+	81:  0, // Cactus
+	83:  0, // Sugar Cane
+	85:  0, // Fence
+	90:  0, // Portal
+	92:  0, // Cake
+	93:  0, // Redstone Repeater (Off)
+	94:  0, // Redstone Repeater (On)
+	95:  0, // Stained Glass
+	96:  0, // Trapdoor
+	101: 0, // Iron Bars
+	102: 0, // Glass Pane
+	104: 0, // Pumpkin Stem
+	105: 0, // Melon Stem
+	106: 0, // Vines
+	107: 0, // Fence Gate
+	111: 0, // Lily Pad
+	113: 0, // Nether Brick Fence
+	115: 0, // Nether Wart
+	117: 0, // Brewing Stand
+	118: 0, // Cauldron
+	127: 0, // Cocoa
+	131: 0, // Tripwire Hook
+	132: 0, // Tripwire
+	139: 0, // Cobblestone Wall
+	140: 0, // Flower Pot
+	141: 0, // Carrots
+	142: 0, // Potatoes
+	143: 0, // Wooden Button
+	144: 0, // Head
+	145: 0, // Anvil
+	147: 0, // Weighted Pressure Plate (Light)
+	148: 0, // Weighted Pressure Plate (Heavy)
+	149: 0, // Redstone Comparator (Off)
+	150: 0, // Redstone Comparator (On)
+	154: 0, // Hopper
+	157: 0, // Activator Rail
+	160: 0, // Stained Glass Pane
+	161: 1, // Acacia and Dark Oak Leaves
+	167: 0, // Iron Trapdoor
+	171: 0, // Carpet
+	175: 0, // Large Flowers
+}
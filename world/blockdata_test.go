@@ -1,6 +1,9 @@
 package world
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 func Test_checkBlockData(t *testing.T) {
 	b := blockNames["Stone"]
@@ -8,3 +11,21 @@ func Test_checkBlockData(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func Test_blockDataNames(t *testing.T) {
+	seen := map[string]bool{}
+	for _, bd := range blockData {
+		if bd.name != strings.TrimSpace(bd.name) {
+			t.Errorf("block %d:%d name %q has extra spaces", bd.block, bd.data, bd.name)
+		}
+		if seen[bd.name] {
+			t.Errorf("block %d:%d name %q is used more than once", bd.block, bd.data, bd.name)
+		}
+		seen[bd.name] = true
+	}
+	for name, want := range map[string]Block{"Snow Layer": {78, 0}, "Ice": {79, 0}, "Snow": {80, 0}, "Iron Ore": {15, 0}} {
+		if got := blockNames[name]; got != want {
+			t.Errorf("%s: expected %v, got %v", name, want, got)
+		}
+	}
+}
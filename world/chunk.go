@@ -2,8 +2,6 @@ package world
 
 import (
 	"bytes"
-	"compress/gzip"
-	"compress/zlib"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -11,6 +9,7 @@ import (
 	"log"
 	"math"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/mathuin/terroir/nbt"
@@ -22,10 +21,15 @@ type Chunk struct {
 	biomes    []byte
 	heightMap []int32
 	Sections  map[int]Section
+	// set once the world is lit
+	lightPopulated bool
 	// living things
 	entities     []Entity
 	tileEntities []TileEntity
 	tileTicks    []TileTick
+	// guards everything above, so that blocks may be set in the chunk
+	// from many goroutines at once
+	lock *sync.RWMutex
 }
 
 func MakeChunk(xPos int32, zPos int32) Chunk {
@@ -38,13 +42,63 @@ func MakeChunk(xPos int32, zPos int32) Chunk {
 	entities := []Entity{}
 	tileEntities := []TileEntity{}
 	tileTicks := []TileTick{}
-	return Chunk{xPos: xPos, zPos: zPos, biomes: biomes, heightMap: heightMap, Sections: Sections, entities: entities, tileEntities: tileEntities, tileTicks: tileTicks}
+	return Chunk{xPos: xPos, zPos: zPos, biomes: biomes, heightMap: heightMap, Sections: Sections, entities: entities, tileEntities: tileEntities, tileTicks: tileTicks, lock: &sync.RWMutex{}}
+}
+
+// section returns the section holding y, and false if there is none.
+// The caller holds the chunk's lock.
+func (c Chunk) section(y int32) (Section, bool) {
+	s, ok := c.Sections[int(floor(y, 16))]
+	return s, ok
+}
+
+// makeSection returns the section holding y, making it if there is
+// none.  The caller holds the chunk's write lock.
+func (c Chunk) makeSection(y int32) Section {
+	yf := int(floor(y, 16))
+	s, ok := c.Sections[yf]
+	if !ok {
+		s = MakeSection()
+		c.Sections[yf] = s
+	}
+	return s
 }
 
 func (c Chunk) Name() string {
 	return fmt.Sprintf("%d, %d", c.xPos, c.zPos)
 }
 
+// updateHeight keeps the height map of the column at a point up to
+// date once a block is set there.  The height map holds the lowest y
+// in each column with full sky light, just above the highest block
+// which takes any light away.  The caller holds the chunk's write lock.
+func (c Chunk) updateHeight(pt Point, b Block) {
+	i := pt.Index() % 256
+	top := c.heightMap[i]
+	switch {
+	case b.Opacity() > 0 && pt.Y >= top:
+		c.heightMap[i] = pt.Y + 1
+	case b.Opacity() == 0 && pt.Y+1 == top:
+		c.heightMap[i] = c.height(i, pt.Y)
+	}
+}
+
+// height returns the height of the column at index i, looking down
+// from below.  Missing sections are all air.
+func (c Chunk) height(i int, below int32) int32 {
+	for y := below - 1; y >= 0; y-- {
+		s, ok := c.section(y)
+		if !ok {
+			y -= y % 16
+			continue
+		}
+		if s.block(i+int(y%16)*256).Opacity() > 0 {
+			return y + 1
+		}
+	}
+	return 0
+}
+
 func (c Chunk) write() nbt.Tag {
 
 	sectionsPayload := [][]nbt.Tag{}
@@ -69,11 +123,16 @@ func (c Chunk) write() nbt.Tag {
 		tileTicksPayload = append(tileTicksPayload, ttt.Payload.([]nbt.Tag))
 	}
 
+	lightPopulated := byte(0)
+	if c.lightPopulated {
+		lightPopulated = 1
+	}
+
 	var levelElems = []nbt.CompoundElem{
 		{"xPos", nbt.TAG_Int, c.xPos},
 		{"zPos", nbt.TAG_Int, c.zPos},
 		{"LastUpdate", nbt.TAG_Long, int64(0)},
-		{"LightPopulated", nbt.TAG_Byte, byte(0)},
+		{"LightPopulated", nbt.TAG_Byte, lightPopulated},
 		{"TerrainPopulated", nbt.TAG_Byte, byte(1)},
 		{"V", nbt.TAG_Byte, byte(1)},
 		{"InhabitedTime", nbt.TAG_Long, int64(0)},
@@ -194,6 +253,8 @@ func (c *Chunk) Read(t nbt.Tag) error {
 		} else {
 			// optional tags
 			switch tval.Name {
+			case "LightPopulated":
+				c.lightPopulated = tval.Payload.(byte) != 0
 			case "TileTicks":
 				tts := make([]TileTick, 0)
 				for _, tt := range tval.Payload.([][]nbt.Tag) {
@@ -220,107 +281,95 @@ type CTROut struct {
 	err    error
 }
 
-func WriteChunkToRegion(in chan Chunk, out chan CTROut, i int) {
+func WriteChunkToRegion(in chan Chunk, out chan CTROut, i int, comp Compression, level int) {
 	for c := range in {
 		cout := new(CTROut)
-		cb := new(bytes.Buffer)
-		// JMT: not too hard to support gzip now...
-		comptype := byte(2)
-
-		cx := c.xPos % 32
-		if cx < 0 {
-			cx = cx + 32
-		}
-		cz := c.zPos % 32
-		if cz < 0 {
-			cz = cz + 32
-		}
-		cout.arroff = cz*32 + cx
-		if Debug {
-			log.Printf("arroff: (%d, %d) -> %d * 32 + %d = %d", c.xPos, c.zPos, cz, cx, cout.arroff)
-		}
-
-		// write chunk to compressed buffer
-		ct := c.write()
-		var zb bytes.Buffer
-		zw := zlib.NewWriter(&zb)
-		start := time.Now().UnixNano()
-		cout.err = ct.Write(zw)
-		end := time.Now().UnixNano()
+		cout.arroff = int32(regionIndex(XZ{X: c.xPos, Z: c.zPos}))
 		if Debug {
-			log.Printf("ct.Write(zw) took %d nanoseconds", end-start)
+			log.Printf("arroff: (%d, %d) -> %d", c.xPos, c.zPos, cout.arroff)
 		}
-		if cout.err != nil {
-			out <- *cout
-			continue
-		}
-		zw.Close()
+		cout.arrout, cout.count, cout.err = c.encode(comp, level)
+		out <- *cout
+	}
+}
 
-		// - calculate lengths
-		// (the extra byte is the compression byte)
-		ccl := int32(zb.Len() + 1)
-		cout.count = int32(math.Ceil(float64(ccl) / 4096.0))
-		pad := int32(4096*cout.count) - ccl - 4
-		whole := int(ccl + pad + 4)
+// encode compresses the chunk and lays it out as a region file holds
+// it: the length, the compression type and the compressed chunk, padded
+// with zeroes to whole sectors.  It returns the bytes and the number of
+// sectors.
+func (c Chunk) encode(comp Compression, level int) ([]byte, int32, error) {
+	cb := new(bytes.Buffer)
+
+	// write chunk to compressed buffer
+	ct := c.write()
+	var zb bytes.Buffer
+	zw, err := comp.writer(&zb, level)
+	if err != nil {
+		return nil, 0, err
+	}
+	start := time.Now().UnixNano()
+	err = ct.Write(zw)
+	end := time.Now().UnixNano()
+	if Debug {
+		log.Printf("ct.Write(zw) took %d nanoseconds", end-start)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, 0, err
+	}
 
-		if Debug {
-			log.Printf("Length of compressed chunk: %d", ccl)
-			log.Printf("Count of sectors: %d", cout.count)
-			log.Printf("Padding: %d", pad)
-			log.Printf("Whole amount written: %d", whole)
-		}
+	// - calculate lengths
+	// (the extra byte is the compression byte)
+	ccl := int32(zb.Len() + 1)
+	count := int32(math.Ceil(float64(ccl+4) / 4096.0))
+	pad := int32(4096*count) - ccl - 4
+	whole := int(ccl + pad + 4)
 
-		if pad > 4096 {
-			cout.err = fmt.Errorf("pad %d > 4096", pad)
-			out <- *cout
-			continue
-		}
+	if Debug {
+		log.Printf("Length of compressed chunk: %d", ccl)
+		log.Printf("Count of sectors: %d", count)
+		log.Printf("Padding: %d", pad)
+		log.Printf("Whole amount written: %d", whole)
+	}
 
-		if (whole % 4096) != 0 {
-			cout.err = fmt.Errorf("%d not even multiple of 4096", whole)
-			out <- *cout
-			continue
-		}
+	if pad > 4096 {
+		return nil, 0, fmt.Errorf("pad %d > 4096", pad)
+	}
 
-		// - write chunk header and compressed chunk data to chunk writer
-		cout.err = binary.Write(cb, binary.BigEndian, ccl)
-		if cout.err != nil {
-			out <- *cout
-			continue
-		}
+	if (whole % 4096) != 0 {
+		return nil, 0, fmt.Errorf("%d not even multiple of 4096", whole)
+	}
 
-		cout.err = cb.WriteByte(comptype)
-		if cout.err != nil {
-			out <- *cout
-			continue
-		}
+	// - write chunk header and compressed chunk data to chunk writer
+	if err := binary.Write(cb, binary.BigEndian, ccl); err != nil {
+		return nil, 0, err
+	}
 
-		_, cout.err = zb.WriteTo(cb)
-		if cout.err != nil {
-			out <- *cout
-			continue
-		}
+	if err := cb.WriteByte(byte(comp)); err != nil {
+		return nil, 0, err
+	}
 
-		// - write necessary padding of zeroes to chunks writer
-		padb := make([]byte, pad)
-		_, cout.err = cb.Write(padb)
-		if cout.err != nil {
-			out <- *cout
-			continue
-		}
+	if _, err := zb.WriteTo(cb); err != nil {
+		return nil, 0, err
+	}
 
-		if cb.Len() != whole {
-			cout.err = fmt.Errorf("cb.Len() %d does not match whole %d", cb.Len(), whole)
-			out <- *cout
-			continue
-		}
-		cout.arrout = cb.Bytes()
+	// - write necessary padding of zeroes to chunks writer
+	padb := make([]byte, pad)
+	if _, err := cb.Write(padb); err != nil {
+		return nil, 0, err
+	}
 
-		out <- *cout
+	if cb.Len() != whole {
+		return nil, 0, fmt.Errorf("cb.Len() %d does not match whole %d", cb.Len(), whole)
 	}
+	return cb.Bytes(), count, nil
 }
 
-func (w *World) loadChunkFromRegion(r io.ReadSeeker, location int32, cXZ XZ) (*Chunk, error) {
+// loadChunkFromRegion reads the chunk at a location from a region
+// file's header.
+func loadChunkFromRegion(r io.ReadSeeker, location int32, cXZ XZ) (*Chunk, error) {
 	offset := location / 256
 	count := location % 256
 
@@ -332,7 +381,7 @@ func (w *World) loadChunkFromRegion(r io.ReadSeeker, location int32, cXZ XZ) (*C
 
 	_, perr := r.Seek(int64(offset*4096), os.SEEK_SET)
 	if perr != nil {
-		panic(perr)
+		return nil, perr
 	}
 
 	var chunklen int32
@@ -344,13 +393,17 @@ func (w *World) loadChunkFromRegion(r io.ReadSeeker, location int32, cXZ XZ) (*C
 	if Debug {
 		log.Printf("Actual read: %d bytes (%d bytes padding)", chunklen, (int32(count*4096) - chunklen))
 	}
+	if chunklen < 1 || chunklen+4 > count*4096 {
+		return nil, fmt.Errorf("chunk %v: length %d does not fit in %d sectors", cXZ, chunklen, count)
+	}
 
 	flag := make([]uint8, 1)
 	_, err = io.ReadFull(r, flag)
 	if err != nil {
 		return nil, err
 	}
-	zchr := make([]byte, chunklen)
+	// the length includes the compression byte
+	zchr := make([]byte, chunklen-1)
 	var zr, unzr io.Reader
 	zr = bytes.NewBuffer(zchr)
 	ret, err := io.ReadFull(r, zchr)
@@ -360,31 +413,13 @@ func (w *World) loadChunkFromRegion(r io.ReadSeeker, location int32, cXZ XZ) (*C
 	if Debug {
 		log.Printf("%d compressed bytes read", ret)
 	}
+	comp := Compression(flag[0])
 	if Debug {
-		log.Printf("Compression:")
+		log.Printf("Compression: %s", comp)
 	}
-	switch flag[0] {
-	case 0:
-		if Debug {
-			log.Printf("  none?")
-		}
-		unzr = zr
-	case 1:
-		if Debug {
-			log.Printf("  gzip")
-		}
-		unzr, err = gzip.NewReader(zr)
-		if err != nil {
-			return nil, err
-		}
-	case 2:
-		if Debug {
-			log.Printf("  zlib")
-		}
-		unzr, err = zlib.NewReader(zr)
-		if err != nil {
-			return nil, err
-		}
+	unzr, err = comp.reader(zr)
+	if err != nil {
+		return nil, fmt.Errorf("chunk %v: %s", cXZ, err)
 	}
 	zstr, err := ioutil.ReadAll(unzr)
 	if err != nil {
@@ -399,12 +434,7 @@ func (w *World) loadChunkFromRegion(r io.ReadSeeker, location int32, cXZ XZ) (*C
 	if err != nil {
 		return nil, err
 	}
-	var c *Chunk
-	c, err = w.MakeChunk(cXZ, tag)
-	if err != nil {
-		return nil, err
-	}
-	return c, nil
+	return readChunk(cXZ, tag)
 }
 
 func (w *World) loadAllChunksFromRegion(rXZ XZ) (int, error) {
@@ -415,28 +445,24 @@ func (w *World) loadAllChunksFromRegion(rXZ XZ) (int, error) {
 	if Debug {
 		log.Printf("Reading region file %s", rname)
 	}
-	r, err := os.Open(rname)
+	rf, err := OpenRegionFile(rname)
 	if err != nil {
 		return 0, err
 	}
-	defer r.Close()
-
-	locations := make([]int32, 1024)
-
-	err = binary.Read(r, binary.BigEndian, &locations)
+	defer rf.Close()
 
 	numchunks := 0
-	for i, location := range locations {
+	for _, rc := range rf.Chunks() {
 		// eventually parallelize this
 		// mutexes around chunkmap and regionmap of course
-		if location != 0 {
-			cXZ := XZ{X: rXZ.X*32 + int32(i%32), Z: rXZ.Z*32 + int32(i/32)}
-			_, err := w.loadChunkFromRegion(r, location, cXZ)
-			if err != nil {
-				return 0, err
-			}
-			numchunks = numchunks + 1
+		c, err := rf.ReadChunk(XZ{X: rXZ.X*32 + rc.X, Z: rXZ.Z*32 + rc.Z})
+		if err != nil {
+			return 0, err
+		}
+		if err := w.addChunk(c); err != nil {
+			return 0, err
 		}
+		numchunks = numchunks + 1
 	}
 	if Debug {
 		log.Printf("... read %d chunks", numchunks)
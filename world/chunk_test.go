@@ -1 +1,55 @@
 package world
+
+import "testing"
+
+var heightMap_tests = []struct {
+	name   string
+	y      int32
+	height int32
+}{
+	// a stone floor
+	{"Stone", 60, 61},
+	// air beneath the top changes nothing
+	{"Air", 30, 61},
+	// leaves and water take away some light
+	{"Oak Leaves", 70, 71},
+	{"Water", 80, 81},
+	// transparent blocks change nothing
+	{"Glass", 90, 81},
+	{"Snow Layer", 81, 81},
+	// clearing the top looks down for the next block
+	{"Air", 80, 71},
+	{"Air", 70, 61},
+	// all the way down through missing sections
+	{"Air", 60, 0},
+}
+
+func Test_heightMap(t *testing.T) {
+	w := MakeWorld("HeightMapTest")
+	xz := XZ{X: -5, Z: 21}
+	for _, tt := range heightMap_tests {
+		b, err := BlockNamed(tt.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.SetBlock(xz.Point(tt.y), *b); err != nil {
+			t.Fatal(err)
+		}
+		height, err := w.HeightMap(xz)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if height != tt.height {
+			t.Errorf("after %s at %d, expected height %d, got %d", tt.name, tt.y, tt.height, height)
+		}
+	}
+
+	// only the one column has changed
+	next, err := w.HeightMap(XZ{X: -4, Z: 21})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next != 0 {
+		t.Errorf("expected height 0 next door, got %d", next)
+	}
+}
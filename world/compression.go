@@ -0,0 +1,92 @@
+// chunk compression in region files
+
+package world
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+)
+
+// Compression is how chunks are compressed in region files.  The values
+// are the compression type byte stored before each chunk.
+type Compression byte
+
+const (
+	Gzip         Compression = 1
+	Zlib         Compression = 2
+	Uncompressed Compression = 3
+)
+
+var compressionNames = map[Compression]string{
+	Gzip:         "gzip",
+	Zlib:         "zlib",
+	Uncompressed: "none",
+}
+
+func (c Compression) String() string {
+	if name, ok := compressionNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("Compression(%d)", byte(c))
+}
+
+// CompressionNamed returns the compression with a name: gzip, zlib or
+// none.
+func CompressionNamed(name string) (Compression, error) {
+	for c, cname := range compressionNames {
+		if cname == name {
+			return c, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown compression %q: must be gzip, zlib or none", name)
+}
+
+// Validate returns an error unless the compression is known and the
+// level is one gzip and zlib accept, from zlib.HuffmanOnly to
+// zlib.BestCompression.  Uncompressed chunks ignore the level.
+func (c Compression) Validate(level int) error {
+	if _, ok := compressionNames[c]; !ok {
+		return fmt.Errorf("unknown compression type %d", byte(c))
+	}
+	if c != Uncompressed && (level < zlib.HuffmanOnly || level > zlib.BestCompression) {
+		return fmt.Errorf("compression level %d must be between %d and %d", level, zlib.HuffmanOnly, zlib.BestCompression)
+	}
+	return nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// writer returns a writer compressing to w at a level.  It must be
+// closed to flush the compressed data.
+func (c Compression) writer(w io.Writer, level int) (io.WriteCloser, error) {
+	switch c {
+	case Gzip:
+		return gzip.NewWriterLevel(w, level)
+	case Zlib:
+		return zlib.NewWriterLevel(w, level)
+	case Uncompressed:
+		return nopWriteCloser{w}, nil
+	}
+	return nil, fmt.Errorf("unknown compression type %d", byte(c))
+}
+
+// reader returns a reader uncompressing from r.
+func (c Compression) reader(r io.Reader) (io.Reader, error) {
+	switch c {
+	case Gzip:
+		return gzip.NewReader(r)
+	case Zlib:
+		return zlib.NewReader(r)
+	case Uncompressed:
+		return r, nil
+	}
+	return nil, fmt.Errorf("unknown compression type %d", byte(c))
+}
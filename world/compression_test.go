@@ -0,0 +1,98 @@
+package world
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+var CompressionNamed_tests = []struct {
+	name string
+	c    Compression
+	ok   bool
+}{
+	{"gzip", Gzip, true},
+	{"zlib", Zlib, true},
+	{"none", Uncompressed, true},
+	{"lzma", 0, false},
+}
+
+func Test_CompressionNamed(t *testing.T) {
+	for _, tt := range CompressionNamed_tests {
+		c, err := CompressionNamed(tt.name)
+		if (err == nil) != tt.ok || c != tt.c {
+			t.Errorf("given %s, expected %v (ok %v), got %v (%v)", tt.name, tt.c, tt.ok, c, err)
+		}
+		if tt.ok && c.String() != tt.name {
+			t.Errorf("given %s, got name %s", tt.name, c)
+		}
+	}
+}
+
+func Test_Compression(t *testing.T) {
+	td, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(td)
+	name := path.Join(td, "r.0.0.mca")
+
+	stone, _ := BlockNamed("Stone")
+	w := MakeWorld("CompressionTest")
+	pt := Point{X: 3, Y: 70, Z: 4}
+	if err := w.SetBlock(pt, *stone); err != nil {
+		t.Fatal(err)
+	}
+	c := *w.ChunkMap[pt.ChunkXZ()]
+
+	rf, err := CreateRegionFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+	if err := rf.SetCompression(Zlib, 10); err == nil {
+		t.Error("expected an error for level 10")
+	}
+	if err := rf.SetCompression(Compression(4), 0); err == nil {
+		t.Error("expected an error for compression type 4")
+	}
+
+	for _, comp := range []Compression{Gzip, Zlib, Uncompressed} {
+		for _, level := range []int{-1, 1, 9} {
+			if err := rf.SetCompression(comp, level); err != nil {
+				t.Fatal(err)
+			}
+			if err := rf.WriteChunk(c); err != nil {
+				t.Fatal(err)
+			}
+			location := rf.locations[0]
+			flag := make([]byte, 1)
+			if _, err := rf.f.ReadAt(flag, int64(location/256)*4096+4); err != nil {
+				t.Fatal(err)
+			}
+			if Compression(flag[0]) != comp {
+				t.Errorf("given %s, expected compression byte %d, got %d", comp, comp, flag[0])
+			}
+			rc, err := rf.ReadChunk(pt.ChunkXZ())
+			if err != nil {
+				t.Fatalf("given %s %d: %s", comp, level, err)
+			}
+			rw := MakeWorld("ReadBack")
+			if err := rw.addChunk(rc); err != nil {
+				t.Fatal(err)
+			}
+			if b, err := rw.Block(pt); err != nil || *b != *stone {
+				t.Errorf("given %s %d, expected %v, got %v (%v)", comp, level, stone, b, err)
+			}
+		}
+	}
+
+	// unknown compression types are an error on read
+	if _, err := rf.f.WriteAt([]byte{7}, int64(rf.locations[0]/256)*4096+4); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rf.ReadChunk(pt.ChunkXZ()); err == nil {
+		t.Error("expected an error for compression type 7")
+	}
+}
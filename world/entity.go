@@ -8,8 +8,8 @@ import (
 )
 
 // PLEASE NOTE
-// This is for future expansion.
-// For now, generated worlds will have none of these features.
+// Generated worlds only have the mobs added with AddEntity.  Tile
+// entities and tile ticks are only kept when read from a world.
 
 // Entity is a TAG_Compound
 // Entities is a TAG_List of TAG_Compound
@@ -40,6 +40,43 @@ func (e Entity) write() []nbt.Tag {
 	return e.tags
 }
 
+// MakeMob returns a mob of the given ID standing at a position, with
+// any extra tags.  Mobs made this way never despawn.
+func MakeMob(id string, x float64, y float64, z float64, extra []nbt.CompoundElem) Entity {
+	elems := []nbt.CompoundElem{
+		{"id", nbt.TAG_String, id},
+		{"Pos", nbt.TAG_List, []float64{x, y, z}},
+		{"Motion", nbt.TAG_List, []float64{0, 0, 0}},
+		{"Rotation", nbt.TAG_List, []float32{0, 0}},
+		{"OnGround", nbt.TAG_Byte, byte(1)},
+		{"PersistenceRequired", nbt.TAG_Byte, byte(1)},
+	}
+	return ReadEntity(nbt.MakeCompoundPayload(append(elems, extra...)))
+}
+
+// MakeVillager returns a villager of the given profession standing in
+// the middle of the block at a point.
+func MakeVillager(pt Point, profession int32) Entity {
+	extra := []nbt.CompoundElem{
+		{"Profession", nbt.TAG_Int, profession},
+		{"Health", nbt.TAG_Float, float32(20)},
+	}
+	return MakeMob("Villager", float64(pt.X)+0.5, float64(pt.Y), float64(pt.Z)+0.5, extra)
+}
+
+// AddEntity adds an entity to the chunk containing the point, which
+// should be where the entity stands.
+func (w *World) AddEntity(pt Point, e Entity) error {
+	c, err := w.Chunk(pt)
+	if err != nil {
+		return err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.entities = append(c.entities, e)
+	return nil
+}
+
 // TileEntity is a TAG_Compound
 // TileEntities is a TAG_List of TAG_Compound
 // (unless none exist, in which case it is a TAG_List of <nil>)
@@ -0,0 +1,160 @@
+// lighting
+
+package world
+
+// MaxLight is the brightest light, that of open sky.  Light loses at
+// least one level for every block it spreads, so it never reaches
+// further than this.  A part of a world lit on its own is lit just as
+// the whole world would be at least MaxLight blocks inside its edges.
+const MaxLight = 15
+
+// blockLuminance holds the light given off by each block ID which gives
+// off any.
+var blockLuminance = map[int]byte{
+	10:  15, // Flowing Lava
+	11:  15, // Lava
+	39:  1,  // Brown Mushroom
+	50:  14, // Torch
+	51:  15, // Fire
+	62:  13, // Burning Furnace
+	74:  9,  // Glowing Redstone Ore
+	76:  7,  // Redstone Torch (On)
+	89:  15, // Glowstone
+	90:  11, // Portal
+	91:  15, // Jack o'Lantern
+	94:  9,  // Redstone Repeater (On)
+	117: 1,  // Brewing Stand
+	119: 15, // End Portal
+	120: 1,  // End Portal Frame
+	122: 1,  // Dragon Egg
+	124: 15, // Redstone Lamp (On)
+	138: 15, // Beacon
+	150: 9,  // Redstone Comparator (On)
+	169: 15, // Sea Lantern
+}
+
+// Luminance returns the light the block gives off, from 0 to 15.
+func (b Block) Luminance() byte {
+	return blockLuminance[b.block]
+}
+
+// a block whose light is still to be spread to its neighbors
+type lightPoint struct {
+	pt    Point
+	level byte
+}
+
+var lightDirections = []Point{{X: 1}, {X: -1}, {Y: 1}, {Y: -1}, {Z: 1}, {Z: -1}}
+
+// Light works out the sky light and block light of every block in the
+// world, spreading light across chunk borders, and marks every chunk
+// as lit.  Light is only kept in sections which exist, since the game
+// takes the rest to be open sky.  No blocks may be set while the world
+// is being lit.
+func (w *World) Light() {
+	sky := []lightPoint{}
+	blocks := []lightPoint{}
+
+	for cXZ, c := range w.ChunkMap {
+		top := int32(0)
+		for sy, s := range c.Sections {
+			for i := range s.SkyLight {
+				s.SkyLight[i] = 0
+				s.BlockLight[i] = 0
+			}
+			if int32(sy+1)*16 > top {
+				top = int32(sy+1) * 16
+			}
+
+			// light from luminous blocks
+			for i := range s.Blocks {
+				if l := s.block(i).Luminance(); l > 0 {
+					WriteNibble(s.BlockLight, i, l)
+					pt := MakePoint(cXZ.X*16+int32(i%16), int32(sy*16+i/256), cXZ.Z*16+int32(i/16%16))
+					blocks = append(blocks, lightPoint{pt: pt, level: l})
+				}
+			}
+		}
+
+		// full sky light above the height map, spreading downward
+		// from its bottom and sideways wherever a neighboring column
+		// is higher
+		for i, height := range c.heightMap {
+			xz := XZ{X: cXZ.X*16 + int32(i%16), Z: cXZ.Z*16 + int32(i/16)}
+			for y := height; y < top; y++ {
+				if s, ok := w.section(xz.Point(y)); ok {
+					WriteNibble(s.SkyLight, xz.Point(y).Index(), MaxLight)
+				}
+			}
+			reach := height
+			for _, d := range lightDirections {
+				if d.Y != 0 {
+					continue
+				}
+				if h, ok := w.height(XZ{X: xz.X + d.X, Z: xz.Z + d.Z}); ok && h > reach {
+					reach = h
+				}
+			}
+			for y := height; y <= reach; y++ {
+				sky = append(sky, lightPoint{pt: xz.Point(y), level: MaxLight})
+			}
+		}
+	}
+
+	w.spread(sky, func(s Section) []byte { return s.SkyLight })
+	w.spread(blocks, func(s Section) []byte { return s.BlockLight })
+
+	for _, c := range w.ChunkMap {
+		c.lightPopulated = true
+	}
+}
+
+// spread passes light on from each queued block to its neighbors.  Each
+// step loses one level, or the opacity of the block it enters if that
+// is more.
+func (w World) spread(queue []lightPoint, light func(Section) []byte) {
+	for len(queue) > 0 {
+		lp := queue[0]
+		queue = queue[1:]
+		for _, d := range lightDirections {
+			pt := Point{X: lp.pt.X + d.X, Y: lp.pt.Y + d.Y, Z: lp.pt.Z + d.Z}
+			s, ok := w.section(pt)
+			if !ok {
+				continue
+			}
+			i := pt.Index()
+			loss := s.block(i).Opacity()
+			if loss < 1 {
+				loss = 1
+			}
+			if lp.level <= loss || Nibble(light(s), i) >= lp.level-loss {
+				continue
+			}
+			WriteNibble(light(s), i, lp.level-loss)
+			queue = append(queue, lightPoint{pt: pt, level: lp.level - loss})
+		}
+	}
+}
+
+// section returns the section holding a point, and false if there is
+// none.  Unlike Section, it never makes one.
+func (w World) section(pt Point) (Section, bool) {
+	if pt.Y < 0 || pt.Y >= 256 {
+		return Section{}, false
+	}
+	c, ok := w.ChunkMap[pt.ChunkXZ()]
+	if !ok {
+		return Section{}, false
+	}
+	return c.section(pt.Y)
+}
+
+// height returns the height map of a column, and false if its chunk is
+// not in the world.
+func (w World) height(xz XZ) (int32, bool) {
+	c, ok := w.ChunkMap[xz.Point(0).ChunkXZ()]
+	if !ok {
+		return 0, false
+	}
+	return c.heightMap[xz.Point(0).Index()], true
+}
@@ -0,0 +1,147 @@
+package world
+
+import "testing"
+
+var light_tests = []struct {
+	pt    Point
+	sky   byte
+	block byte
+}{
+	// open sky
+	{Point{X: 5, Y: 60, Z: 8}, 15, 2},
+	{Point{X: 12, Y: 63, Z: 8}, 15, 0},
+	// stone lets nothing through
+	{Point{X: 5, Y: 59, Z: 8}, 0, 0},
+	// under the roof, fading from the edge and across the chunk border
+	{Point{X: 3, Y: 62, Z: 8}, 14, 4},
+	{Point{X: 0, Y: 62, Z: 8}, 11, 7},
+	{Point{X: -1, Y: 62, Z: 8}, 10, 8},
+	{Point{X: -8, Y: 60, Z: 0}, 3, 3},
+	// the torch and around it
+	{Point{X: -6, Y: 61, Z: 8}, 5, 14},
+	{Point{X: -5, Y: 61, Z: 8}, 6, 13},
+	{Point{X: -6, Y: 63, Z: 8}, 5, 12},
+	{Point{X: -1, Y: 61, Z: 8}, 10, 9},
+	// water takes away three at a time
+	{Point{X: 15, Y: 62, Z: 8}, 12, 0},
+	{Point{X: 15, Y: 61, Z: 8}, 9, 0},
+	{Point{X: 15, Y: 60, Z: 8}, 6, 0},
+}
+
+func Test_Light(t *testing.T) {
+	w := MakeWorld("LightTest")
+	stone, _ := BlockNamed("Stone")
+	water, _ := BlockNamed("Water")
+	torch, _ := BlockNamed("Torch")
+	set := func(x, y, z int32, b *Block) {
+		if err := w.SetBlock(MakePoint(x, y, z), *b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for x := int32(-16); x < 16; x++ {
+		for z := int32(0); z < 16; z++ {
+			for y := int32(0); y < 60; y++ {
+				set(x, y, z, stone)
+			}
+			switch {
+			case x <= 3:
+				set(x, 64, z, stone)
+			case x >= 10:
+				for y := int32(60); y < 63; y++ {
+					set(x, y, z, water)
+				}
+			}
+		}
+	}
+	set(-6, 61, 8, torch)
+
+	// lighting twice gives the same light
+	w.Light()
+	w.Light()
+
+	for _, tt := range light_tests {
+		sky, err := w.SkyLight(tt.pt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block, err := w.BlockLight(tt.pt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sky != tt.sky || block != tt.block {
+			t.Errorf("at %v, expected sky %d block %d, got sky %d block %d", tt.pt, tt.sky, tt.block, sky, block)
+		}
+	}
+	for cXZ, c := range w.ChunkMap {
+		if !c.lightPopulated {
+			t.Errorf("chunk %v not marked as lit", cXZ)
+		}
+	}
+}
+
+// lightSeam builds a floor with a roof across x=512, a torch and lava on
+// either side of it, and only the columns from minX up to maxX.
+func lightSeam(t *testing.T, minX int32, maxX int32) World {
+	w := MakeWorld("LightSeamTest")
+	stone, _ := BlockNamed("Stone")
+	torch, _ := BlockNamed("Torch")
+	lava, _ := BlockNamed("Lava")
+	set := func(x, y, z int32, b *Block) {
+		if x < minX || x >= maxX {
+			return
+		}
+		if err := w.SetBlock(MakePoint(x, y, z), *b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for x := int32(480); x < 544; x++ {
+		for z := int32(0); z < 16; z++ {
+			for y := int32(0); y < 60; y++ {
+				set(x, y, z, stone)
+			}
+			if x >= 500 && x < 530 {
+				set(x, 64, z, stone)
+			}
+		}
+	}
+	set(509, 61, 8, torch)
+	set(515, 60, 4, lava)
+	w.Light()
+	return w
+}
+
+func Test_LightSeam(t *testing.T) {
+	whole := lightSeam(t, 480, 544)
+	// a margin of MaxLight blocks, rounded up to whole chunks
+	part := lightSeam(t, 480, 512+32)
+	bare := lightSeam(t, 480, 512)
+
+	lost := 0
+	for x := int32(480); x < 512; x++ {
+		for z := int32(0); z < 16; z++ {
+			for y := int32(56); y < 68; y++ {
+				pt := MakePoint(x, y, z)
+				for _, light := range []func(*World, Point) (byte, error){(*World).SkyLight, (*World).BlockLight} {
+					want, err := light(&whole, pt)
+					if err != nil {
+						t.Fatal(err)
+					}
+					got, err := light(&part, pt)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if got != want {
+						t.Errorf("at %v, expected %d with a margin, got %d", pt, want, got)
+					}
+					if got, _ := light(&bare, pt); got != want {
+						lost++
+					}
+				}
+			}
+		}
+	}
+	// without the margin the light from beyond the seam is missing
+	if lost == 0 {
+		t.Error("expected light to stop at the seam without a margin")
+	}
+}
@@ -3,30 +3,44 @@
 package world
 
 import (
-	"bytes"
-	"encoding/binary"
 	"fmt"
 	"log"
 	"os"
 	"path"
 	"runtime"
 	"sync"
-	"time"
 )
 
 func (w World) genChunks(key XZ, in chan Chunk) {
 	for _, v := range w.RegionMap[key] {
-		in <- w.ChunkMap[v]
+		in <- *w.ChunkMap[v]
 	}
 	close(in)
 }
 
+// writeRegion writes the region's chunks into its file, replacing any
+// file already there.  Only a file the world flushed itself is updated
+// in place instead, keeping the chunks dropped from the world.
 func (w *World) writeRegion(dir string, key XZ) error {
-	chunks := 1024
-	cb := new(bytes.Buffer)
-	locations := make([]int32, chunks)
-	timestamps := make([]int32, chunks)
-	offset := int32(2)
+	rfn := fmt.Sprintf("r.%d.%d.mca", key.X, key.Z)
+	rname := path.Join(dir, rfn)
+	if Debug {
+		log.Printf("Writing region file %s...", rname)
+	}
+	w.lock.RLock()
+	flushed := w.flushed[key]
+	w.lock.RUnlock()
+	var rf *RegionFile
+	var err error
+	if flushed {
+		rf, err = OpenRegionFile(rname)
+	} else {
+		rf, err = CreateRegionFile(rname)
+	}
+	if err != nil {
+		return err
+	}
+	defer rf.Close()
 	numchunks := 0
 
 	in := make(chan Chunk)
@@ -38,65 +52,32 @@ func (w *World) writeRegion(dir string, key XZ) error {
 		wg.Add(1)
 		go func(i int) {
 			defer wg.Done()
-			WriteChunkToRegion(in, out, i)
+			WriteChunkToRegion(in, out, i, w.compression, w.compressionLevel)
 		}(i)
 	}
 	go func() { wg.Wait(); close(out) }()
 	go w.genChunks(key, in)
 
+	// after a failure the rest are drained so the workers can finish
+	var werr error
 	for cout := range out {
-		if cout.err != nil {
-			return cout.err
-		}
-
-		// - write current time to timestamp array
-		timestamps[cout.arroff] = int32(time.Now().Unix())
-		if Debug {
-			log.Printf("Timestamps are %d", timestamps[cout.arroff])
+		if werr != nil {
+			continue
 		}
-
-		// - write offset and count to locations array
-		locations[cout.arroff] = offset*256 + int32(cout.count)
-		if Debug {
-			log.Printf("Locations are %d (%d * 256 + %d)", locations[cout.arroff], offset, cout.count)
+		if cout.err != nil {
+			werr = cout.err
+			continue
 		}
-
-		// - write bytes to master chunk buffer
-		_, err := cb.Write(cout.arrout)
-		if err != nil {
-			return err
+		if werr = rf.put(int(cout.arroff), cout.arrout, cout.count); werr == nil {
+			numchunks = numchunks + 1
 		}
-
-		offset = offset + cout.count
-		numchunks = numchunks + 1
 	}
-
-	// open actual region file for writing
-	rfn := fmt.Sprintf("r.%d.%d.mca", key.X, key.Z)
-	rname := path.Join(dir, rfn)
-	if Debug {
-		log.Printf("Writing region file %s...", rname)
-	}
-	iow, err := os.Create(rname)
-	if err != nil {
-		return err
-	}
-	defer iow.Close()
-
-	// write locations array to real io.writer
-	err = binary.Write(iow, binary.BigEndian, locations)
-	if err != nil {
-		return err
+	if werr != nil {
+		return werr
 	}
 
-	// write timestamps array to real io.writer
-	err = binary.Write(iow, binary.BigEndian, timestamps)
-	if err != nil {
-		return err
-	}
-	// write chunks writer to real io.writer
-	_, err = cb.WriteTo(iow)
-	if err != nil {
+	// chunks which grew leave holes behind them
+	if err := rf.Compact(); err != nil {
 		return err
 	}
 	if Debug {
@@ -119,6 +100,40 @@ func (w *World) writeRegions() error {
 	return nil
 }
 
+// FlushRegion writes the file of one region and then drops its chunks
+// from the world, so that a large world can be written a region at a
+// time without ever holding all of it.  Dropped chunks are read back
+// from the file if they are needed again, and writing the region again
+// updates the file in place.  No blocks may be set while it runs.  The
+// argument is in region coordinates.
+func (w *World) FlushRegion(rXZ XZ) error {
+	if w.SaveDir == "" {
+		return fmt.Errorf("world savedir not set")
+	}
+	if len(w.RegionMap[rXZ]) == 0 {
+		return nil
+	}
+	regionDir := path.Join(w.SaveDir, w.Name, "region")
+	if err := os.MkdirAll(regionDir, 0775); err != nil {
+		return err
+	}
+	if err := w.writeRegion(regionDir, rXZ); err != nil {
+		return err
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	for _, cXZ := range w.RegionMap[rXZ] {
+		delete(w.ChunkMap, cXZ)
+	}
+	delete(w.RegionMap, rXZ)
+	if w.flushed == nil {
+		w.flushed = map[XZ]bool{}
+	}
+	w.flushed[rXZ] = true
+	return nil
+}
+
 func (w World) regionFilename(rXZ XZ) string {
 	return path.Join(w.SaveDir, w.Name, "region", fmt.Sprintf("r.%d.%d.mca", rXZ.X, rXZ.Z))
 }
@@ -1 +1,136 @@
 package world
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func Test_FlushRegion(t *testing.T) {
+	td, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(td)
+
+	w := MakeWorld("FlushTest")
+	if err := w.FlushRegion(XZ{}); err == nil {
+		t.Error("expected an error without a savedir")
+	}
+	w.SetSaveDir(td)
+	stone, _ := BlockNamed("Stone")
+	pts := []Point{{X: 5, Y: 10, Z: 5}, {X: 300, Y: 20, Z: 40}, {X: 600, Y: 30, Z: 5}}
+	for _, pt := range pts {
+		if err := w.SetBlock(pt, *stone); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := w.FlushRegion(XZ{X: 0, Z: 0}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(w.regionFilename(XZ{X: 0, Z: 0})); err != nil {
+		t.Errorf("expected region file: %s", err)
+	}
+	if _, err := os.Stat(w.regionFilename(XZ{X: 1, Z: 0})); err == nil {
+		t.Error("expected no file for the region still in memory")
+	}
+	if len(w.ChunkMap) != 1 || len(w.RegionMap) != 1 {
+		t.Errorf("expected one chunk in one region left, got %d in %d", len(w.ChunkMap), len(w.RegionMap))
+	}
+
+	// flushed chunks come back from the file
+	for _, pt := range pts {
+		b, err := w.Block(pt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *b != *stone {
+			t.Errorf("at %v, expected %v, got %v", pt, stone, b)
+		}
+	}
+	if len(w.ChunkMap) != 3 {
+		t.Errorf("expected 3 chunks after reading back, got %d", len(w.ChunkMap))
+	}
+}
+
+func Test_writeRegion(t *testing.T) {
+	td, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(td)
+
+	stone, _ := BlockNamed("Stone")
+	world := func(pts ...Point) World {
+		w := MakeWorld("WriteRegionTest")
+		w.SetSaveDir(td)
+		for _, pt := range pts {
+			if err := w.SetBlock(pt, *stone); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return w
+	}
+	chunks := func(rXZ XZ) []RegionChunk {
+		rf, err := OpenRegionFile(world().regionFilename(rXZ))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rf.Close()
+		return rf.Chunks()
+	}
+
+	// a region left from an earlier world is replaced, and so is a
+	// file too short to be a region
+	old := world(Point{X: 5, Y: 10, Z: 5}, Point{X: 100, Y: 10, Z: 5})
+	if err := old.writeRegions(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(old.regionFilename(XZ{X: 1}), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	w := world(Point{X: 5, Y: 10, Z: 5}, Point{X: 600, Y: 10, Z: 5})
+	if err := w.writeRegions(); err != nil {
+		t.Fatal(err)
+	}
+	if got := chunks(XZ{}); len(got) != 1 || got[0].XZ != (XZ{}) {
+		t.Errorf("expected only the new chunk, got %v", got)
+	}
+	if got := chunks(XZ{X: 1}); len(got) != 1 {
+		t.Errorf("expected one chunk in the replaced file, got %v", got)
+	}
+
+	// a region the world flushed itself keeps the chunks not read back
+	w = world(Point{X: 5, Y: 10, Z: 5}, Point{X: 100, Y: 10, Z: 5})
+	if err := w.FlushRegion(XZ{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Block(Point{X: 5, Y: 10, Z: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.FlushRegion(XZ{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := chunks(XZ{}); len(got) != 2 {
+		t.Errorf("expected both chunks after flushing again, got %v", got)
+	}
+
+	// a chunk which cannot be written fails the region, and every
+	// worker still finishes
+	before := runtime.NumGoroutine()
+	w = world(Point{X: 5, Y: 10, Z: 5}, Point{X: 100, Y: 10, Z: 5}, Point{X: 200, Y: 10, Z: 5})
+	w.compression = Compression(9)
+	if err := w.writeRegion(path.Join(td, w.Name, "region"), XZ{}); err == nil {
+		t.Error("expected an error for an unknown compression")
+	}
+	for i := 0; i < 100 && runtime.NumGoroutine() > before; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("expected %d goroutines after the failure, got %d", before, after)
+	}
+}
@@ -0,0 +1,258 @@
+// random access to region files
+
+package world
+
+import (
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// A RegionFile is an open region file whose chunks can be read and
+// replaced one at a time, so existing worlds can be edited without
+// writing every region from scratch.  Space freed by a chunk which
+// shrinks or moves is reused by later chunks, and the file grows when
+// there is no room left.  A RegionFile is not safe for concurrent use.
+type RegionFile struct {
+	f          *os.File
+	locations  [1024]int32
+	timestamps [1024]int32
+	// which sectors are in use, including the two of the header
+	sectors []bool
+	// how chunks are compressed when they are written
+	compression      Compression
+	compressionLevel int
+}
+
+// A RegionChunk is a chunk present in a region file.  Its coordinates
+// are within the region, from 0 to 31.
+type RegionChunk struct {
+	XZ
+	Timestamp time.Time
+}
+
+// regionIndex returns the index of a chunk in the header of its region
+// file.  The argument is in chunk coordinates.
+func regionIndex(cXZ XZ) int {
+	x := (cXZ.X%32 + 32) % 32
+	z := (cXZ.Z%32 + 32) % 32
+	return int(z*32 + x)
+}
+
+// OpenRegionFile opens an existing region file for reading and writing.
+func OpenRegionFile(name string) (*RegionFile, error) {
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	rf := &RegionFile{f: f, compression: Zlib, compressionLevel: zlib.DefaultCompression}
+	if err := rf.readHeader(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("region file %s: %s", name, err)
+	}
+	return rf, nil
+}
+
+// CreateRegionFile creates a region file with no chunks, replacing any
+// file already there.
+func CreateRegionFile(name string) (*RegionFile, error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(make([]byte, 8192)); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &RegionFile{f: f, sectors: []bool{true, true}, compression: Zlib, compressionLevel: zlib.DefaultCompression}, nil
+}
+
+func (rf *RegionFile) readHeader() error {
+	fi, err := rf.f.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.Size() < 8192 {
+		return fmt.Errorf("%d bytes is too short for a header", fi.Size())
+	}
+	if err := binary.Read(rf.f, binary.BigEndian, &rf.locations); err != nil {
+		return err
+	}
+	if err := binary.Read(rf.f, binary.BigEndian, &rf.timestamps); err != nil {
+		return err
+	}
+
+	rf.sectors = make([]bool, (fi.Size()+4095)/4096)
+	rf.mark(0, 2, true)
+	for i, location := range rf.locations {
+		if location == 0 {
+			continue
+		}
+		offset, count := location/256, location%256
+		if offset < 2 || int(offset+count) > len(rf.sectors) {
+			return fmt.Errorf("chunk %d at sectors %d to %d is outside the file", i, offset, offset+count-1)
+		}
+		rf.mark(offset, count, true)
+	}
+	return nil
+}
+
+// SetCompression sets how chunks are compressed when they are written,
+// as World.SetCompression does.  Chunks are read whatever their
+// compression.
+func (rf *RegionFile) SetCompression(c Compression, level int) error {
+	if err := c.Validate(level); err != nil {
+		return err
+	}
+	rf.compression = c
+	rf.compressionLevel = level
+	return nil
+}
+
+// Close closes the file.
+func (rf *RegionFile) Close() error {
+	return rf.f.Close()
+}
+
+// Chunks returns the chunks present in the file, with the times they
+// were last written.
+func (rf *RegionFile) Chunks() []RegionChunk {
+	chunks := []RegionChunk{}
+	for i, location := range rf.locations {
+		if location == 0 {
+			continue
+		}
+		chunks = append(chunks, RegionChunk{
+			XZ:        XZ{X: int32(i % 32), Z: int32(i / 32)},
+			Timestamp: time.Unix(int64(rf.timestamps[i]), 0),
+		})
+	}
+	return chunks
+}
+
+// ReadChunk reads one chunk from the file.  The argument is in chunk
+// coordinates.
+func (rf *RegionFile) ReadChunk(cXZ XZ) (*Chunk, error) {
+	location := rf.locations[regionIndex(cXZ)]
+	if location == 0 {
+		return nil, fmt.Errorf("chunk %v not in region file", cXZ)
+	}
+	return loadChunkFromRegion(rf.f, location, cXZ)
+}
+
+// WriteChunk writes one chunk to the file, replacing any chunk already
+// there.
+func (rf *RegionFile) WriteChunk(c Chunk) error {
+	data, count, err := c.encode(rf.compression, rf.compressionLevel)
+	if err != nil {
+		return err
+	}
+	return rf.put(regionIndex(XZ{X: c.xPos, Z: c.zPos}), data, count)
+}
+
+// put writes an encoded chunk at an index of the header.  It stays where
+// it is if it fits, and otherwise goes in the first free space big
+// enough for it.
+func (rf *RegionFile) put(i int, data []byte, count int32) error {
+	if count > 255 {
+		return fmt.Errorf("chunk needs %d sectors, more than 255", count)
+	}
+	offset, old := rf.locations[i]/256, rf.locations[i]%256
+	if offset == 0 || count > old {
+		rf.mark(offset, old, false)
+		offset = rf.allocate(count)
+	} else {
+		rf.mark(offset+count, old-count, false)
+	}
+
+	if _, err := rf.f.WriteAt(data, int64(offset)*4096); err != nil {
+		return err
+	}
+	rf.mark(offset, count, true)
+	rf.locations[i] = offset*256 + count
+	rf.timestamps[i] = int32(time.Now().Unix())
+	return rf.writeEntry(i)
+}
+
+// allocate returns the first run of count free sectors.  Sectors past
+// the end of the file are free.
+func (rf *RegionFile) allocate(count int32) int32 {
+	start, run := int32(2), int32(0)
+	for s := int32(2); s < int32(len(rf.sectors)) && run < count; s++ {
+		if rf.sectors[s] {
+			start, run = s+1, 0
+		} else {
+			run++
+		}
+	}
+	return start
+}
+
+func (rf *RegionFile) mark(offset int32, count int32, used bool) {
+	for int(offset+count) > len(rf.sectors) {
+		rf.sectors = append(rf.sectors, false)
+	}
+	for s := offset; s < offset+count; s++ {
+		rf.sectors[s] = used
+	}
+}
+
+// writeEntry writes the location and timestamp at an index of the
+// header.
+func (rf *RegionFile) writeEntry(i int) error {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(rf.locations[i]))
+	if _, err := rf.f.WriteAt(b, int64(i)*4); err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint32(b, uint32(rf.timestamps[i]))
+	if _, err := rf.f.WriteAt(b, 4096+int64(i)*4); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Compact moves the chunks down over any free space between them and
+// truncates the file after the last one.
+func (rf *RegionFile) Compact() error {
+	present := []int{}
+	for i, location := range rf.locations {
+		if location != 0 {
+			present = append(present, i)
+		}
+	}
+	sort.Slice(present, func(a, b int) bool {
+		return rf.locations[present[a]] < rf.locations[present[b]]
+	})
+
+	next := int32(2)
+	for _, i := range present {
+		offset, count := rf.locations[i]/256, rf.locations[i]%256
+		if offset != next {
+			// the last chunk of a file may be short of its padding
+			buf := make([]byte, count*4096)
+			if _, err := rf.f.ReadAt(buf, int64(offset)*4096); err != nil && err != io.EOF {
+				return err
+			}
+			if _, err := rf.f.WriteAt(buf, int64(next)*4096); err != nil {
+				return err
+			}
+			rf.locations[i] = next*256 + count
+			if err := rf.writeEntry(i); err != nil {
+				return err
+			}
+		}
+		next += count
+	}
+
+	if err := rf.f.Truncate(int64(next) * 4096); err != nil {
+		return err
+	}
+	rf.sectors = make([]bool, 0, next)
+	rf.mark(0, next, true)
+	return nil
+}
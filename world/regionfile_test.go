@@ -0,0 +1,154 @@
+package world
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"testing"
+)
+
+var regionIndex_tests = []struct {
+	cXZ XZ
+	i   int
+}{
+	{XZ{X: 0, Z: 0}, 0},
+	{XZ{X: 31, Z: 0}, 31},
+	{XZ{X: 0, Z: 1}, 32},
+	{XZ{X: 33, Z: 34}, 65},
+	{XZ{X: -1, Z: -1}, 1023},
+	{XZ{X: -32, Z: -31}, 32},
+}
+
+func Test_regionIndex(t *testing.T) {
+	for _, tt := range regionIndex_tests {
+		if i := regionIndex(tt.cXZ); i != tt.i {
+			t.Errorf("given %v, wanted %d, got %d", tt.cXZ, tt.i, i)
+		}
+	}
+}
+
+func Test_RegionFile(t *testing.T) {
+	td, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(td)
+	name := path.Join(td, "r.0.0.mca")
+
+	// small chunks take one sector, and the noisy one several
+	stone, _ := BlockNamed("Stone")
+	w := MakeWorld("RegionFileTest")
+	small := func(x int32) Chunk {
+		pt := Point{X: x*16 + 1, Y: 10, Z: 2}
+		if err := w.SetBlock(pt, *stone); err != nil {
+			t.Fatal(err)
+		}
+		return *w.ChunkMap[pt.ChunkXZ()]
+	}
+	a, b, c := small(0), small(1), small(2)
+	nw := MakeWorld("Noisy")
+	r := rand.New(rand.NewSource(1))
+	for y := int32(0); y < 64; y++ {
+		for z := int32(0); z < 16; z++ {
+			for x := int32(0); x < 16; x++ {
+				if err := nw.SetBlock(Point{X: x, Y: y, Z: z}, MakeBlock(1+r.Intn(4), r.Intn(7))); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+	}
+	noisy := *nw.ChunkMap[XZ{}]
+
+	rf, err := CreateRegionFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset := func(c Chunk) int32 {
+		return rf.locations[regionIndex(XZ{X: c.xPos, Z: c.zPos})] / 256
+	}
+	size := func() int64 {
+		fi, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fi.Size()
+	}
+	for _, c := range []Chunk{a, b} {
+		if err := rf.WriteChunk(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if offset(a) != 2 || offset(b) != 3 || size() != 4*4096 {
+		t.Errorf("expected chunks at sectors 2 and 3 of 4, got %d and %d of %d bytes", offset(a), offset(b), size())
+	}
+
+	// a chunk which grows moves to the end of the file
+	if err := rf.WriteChunk(noisy); err != nil {
+		t.Fatal(err)
+	}
+	count := rf.locations[0] % 256
+	if count < 2 || offset(noisy) != 4 || size() != int64(4+count)*4096 {
+		t.Errorf("expected noisy chunk at sector 4 of %d, got %d of %d bytes", 4+count, offset(noisy), size())
+	}
+
+	// and another chunk takes its old place
+	if err := rf.WriteChunk(c); err != nil {
+		t.Fatal(err)
+	}
+	if offset(c) != 2 {
+		t.Errorf("expected reused sector 2, got %d", offset(c))
+	}
+
+	// a chunk which shrinks stays where it is
+	if err := rf.WriteChunk(a); err != nil {
+		t.Fatal(err)
+	}
+	if offset(a) != 4 {
+		t.Errorf("expected chunk to stay at sector 4, got %d", offset(a))
+	}
+	if err := rf.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rf, err = OpenRegionFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+	if chunks := rf.Chunks(); len(chunks) != 3 {
+		t.Errorf("expected 3 chunks, got %v", chunks)
+	}
+	if err := rf.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if size() != 5*4096 {
+		t.Errorf("expected 5 sectors after compacting, got %d bytes", size())
+	}
+
+	for _, cXZ := range []XZ{{X: 0}, {X: 1}, {X: 2}} {
+		rc, err := rf.ReadChunk(cXZ)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rw := MakeWorld("ReadBack")
+		if err := rw.addChunk(rc); err != nil {
+			t.Fatal(err)
+		}
+		pt := Point{X: cXZ.X*16 + 1, Y: 10, Z: 2}
+		if bl, err := rw.Block(pt); err != nil || *bl != *stone {
+			t.Errorf("at %v, expected %v, got %v (%v)", pt, stone, bl, err)
+		}
+	}
+	if _, err := rf.ReadChunk(XZ{X: 3}); err == nil {
+		t.Error("expected an error reading a missing chunk")
+	}
+
+	short := path.Join(td, "r.1.0.mca")
+	if err := ioutil.WriteFile(short, make([]byte, 100), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenRegionFile(short); err == nil {
+		t.Error("expected an error opening a short file")
+	}
+}
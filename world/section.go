@@ -31,6 +31,11 @@ func (s Section) String() string {
 	return fmt.Sprintf("Section{}")
 }
 
+// block returns the block at an index of the section.
+func (s Section) block(i int) Block {
+	return MakeBlock(int(s.Blocks[i])+int(Nibble(s.Add, i))*256, int(Nibble(s.Data, i)))
+}
+
 func (s Section) write(y int) []nbt.Tag {
 	sElems := []nbt.CompoundElem{
 		{"Y", nbt.TAG_Byte, byte(y)},
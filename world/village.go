@@ -0,0 +1,109 @@
+// Stuff related to data/villages.dat
+
+package world
+
+import (
+	"log"
+	"os"
+	"path"
+
+	"github.com/mathuin/terroir/nbt"
+)
+
+// A Door is a village door: the lower block of the door, and the
+// direction of the inside of its house, one of -1, 0 and 1 on each axis.
+type Door struct {
+	Point
+	InsideX int32
+	InsideZ int32
+}
+
+// A Village is a cluster of doors which the game treats as one village.
+// Villages without doors are forgotten by the game.
+type Village struct {
+	Center     Point
+	Radius     int32
+	Population int32
+	Doors      []Door
+}
+
+// AddVillage records a village for villages.dat.
+func (w *World) AddVillage(v Village) {
+	if Debug {
+		log.Printf("ADD VILLAGE: %s: %v with %d doors", w.Name, v.Center, len(v.Doors))
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.villages = append(w.villages, v)
+}
+
+// Villages returns the recorded villages.
+func (w World) Villages() []Village {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	return w.villages
+}
+
+func (v Village) write() []nbt.Tag {
+	doorsPayload := [][]nbt.Tag{}
+	var acx, acy, acz int32
+	for _, d := range v.Doors {
+		acx += d.X
+		acy += d.Y
+		acz += d.Z
+		doorsPayload = append(doorsPayload, nbt.MakeCompoundPayload([]nbt.CompoundElem{
+			{"X", nbt.TAG_Int, d.X},
+			{"Y", nbt.TAG_Int, d.Y},
+			{"Z", nbt.TAG_Int, d.Z},
+			{"IDX", nbt.TAG_Int, d.InsideX},
+			{"IDZ", nbt.TAG_Int, d.InsideZ},
+			{"TS", nbt.TAG_Int, int32(0)},
+		}))
+	}
+	return nbt.MakeCompoundPayload([]nbt.CompoundElem{
+		{"CX", nbt.TAG_Int, v.Center.X},
+		{"CY", nbt.TAG_Int, v.Center.Y},
+		{"CZ", nbt.TAG_Int, v.Center.Z},
+		{"ACX", nbt.TAG_Int, acx},
+		{"ACY", nbt.TAG_Int, acy},
+		{"ACZ", nbt.TAG_Int, acz},
+		{"Radius", nbt.TAG_Int, v.Radius},
+		{"PopSize", nbt.TAG_Int, v.Population},
+		{"Golems", nbt.TAG_Int, int32(0)},
+		{"Stable", nbt.TAG_Int, int32(0)},
+		{"Tick", nbt.TAG_Int, int32(0)},
+		{"MTick", nbt.TAG_Int, int32(0)},
+		{"Doors", nbt.TAG_List, doorsPayload},
+		{"Players", nbt.TAG_List, [][]nbt.Tag{}},
+	})
+}
+
+func (w World) villagesTag() nbt.Tag {
+	villagesPayload := [][]nbt.Tag{}
+	for _, v := range w.villages {
+		villagesPayload = append(villagesPayload, v.write())
+	}
+	dataTag := nbt.MakeCompound("data", []nbt.CompoundElem{
+		{"Tick", nbt.TAG_Int, int32(0)},
+		{"Villages", nbt.TAG_List, villagesPayload},
+	})
+	t := nbt.MakeTag(nbt.TAG_Compound, "")
+	t.SetPayload([]nbt.Tag{dataTag})
+	return t
+}
+
+// writeVillages writes data/villages.dat if there are any villages.
+func (w World) writeVillages() error {
+	if len(w.villages) == 0 {
+		return nil
+	}
+	dataDir := path.Join(w.SaveDir, w.Name, "data")
+	if err := os.MkdirAll(dataDir, 0775); err != nil {
+		return err
+	}
+	villagesFile := path.Join(dataDir, "villages.dat")
+	if Debug {
+		log.Printf("Writing villages file %s", villagesFile)
+	}
+	return nbt.WriteCompressedFile(villagesFile, w.villagesTag())
+}
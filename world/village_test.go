@@ -0,0 +1,67 @@
+package world
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/mathuin/terroir/nbt"
+)
+
+func Test_AddEntity(t *testing.T) {
+	w := MakeWorld("EntityTest")
+	pts := []Point{{X: 7, Y: 65, Z: 7}, {X: 9, Y: 65, Z: 12}, {X: -3, Y: 70, Z: 7}}
+	for _, pt := range pts {
+		if err := w.AddEntity(pt, MakeVillager(pt, 1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for xz, want := range map[XZ]int{{X: 0, Z: 0}: 2, {X: -1, Z: 0}: 1} {
+		c := w.ChunkMap[xz]
+		if len(c.entities) != want {
+			t.Errorf("chunk %v: expected %d entities, got %d", xz, want, len(c.entities))
+		}
+	}
+}
+
+func Test_writeVillages(t *testing.T) {
+	td, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(td)
+
+	w := MakeWorld("VillageTest")
+	w.SetSaveDir(td)
+	villagesFile := path.Join(td, w.Name, "data", "villages.dat")
+
+	// no villages, no file
+	if err := w.writeVillages(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(villagesFile); !os.IsNotExist(err) {
+		t.Fatalf("expected no %s, got %v", villagesFile, err)
+	}
+
+	w.AddVillage(Village{
+		Center:     Point{X: 8, Y: 64, Z: 8},
+		Radius:     32,
+		Population: 2,
+		Doors: []Door{
+			{Point: Point{X: 16, Y: 65, Z: 8}, InsideX: 1},
+			{Point: Point{X: 8, Y: 67, Z: 0}, InsideZ: -1},
+		},
+	})
+	if err := w.writeVillages(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := nbt.ReadCompressedFile(villagesFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := w.villagesTag(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
@@ -3,7 +3,7 @@
 package world
 
 import (
-	"encoding/binary"
+	"compress/zlib"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -11,6 +11,7 @@ import (
 	"path"
 	"regexp"
 	"strconv"
+	"sync"
 
 	"github.com/mathuin/terroir/nbt"
 )
@@ -36,17 +37,26 @@ type World struct {
 	Spawn      Point
 	spawnSet   bool
 	RandomSeed int64
-	ChunkMap   map[XZ]Chunk
+	ChunkMap   map[XZ]*Chunk
 	RegionMap  map[XZ][]XZ
+	villages   []Village
+	// the regions whose chunks FlushRegion has dropped
+	flushed map[XZ]bool
+	// guards ChunkMap, RegionMap, villages and flushed, so that blocks
+	// may be set from many goroutines at once
+	lock *sync.RWMutex
+	// how chunks are compressed when region files are written
+	compression      Compression
+	compressionLevel int
 }
 
 func MakeWorld(Name string) World {
 	if Debug {
 		log.Printf("MAKE WORLD: %s", Name)
 	}
-	ChunkMap := map[XZ]Chunk{}
+	ChunkMap := map[XZ]*Chunk{}
 	RegionMap := map[XZ][]XZ{}
-	return World{Name: Name, ChunkMap: ChunkMap, RegionMap: RegionMap}
+	return World{Name: Name, ChunkMap: ChunkMap, RegionMap: RegionMap, lock: &sync.RWMutex{}, compression: Zlib, compressionLevel: zlib.DefaultCompression}
 }
 
 func (w World) String() string {
@@ -65,6 +75,21 @@ func (w *World) SetSaveDir(dir string) error {
 	return nil
 }
 
+// SetCompression sets how chunks are compressed when region files are
+// written, and the level for gzip and zlib from zlib.HuffmanOnly to
+// zlib.BestCompression.  Worlds start with zlib at its default level.
+func (w *World) SetCompression(c Compression, level int) error {
+	if Debug {
+		log.Printf("SET COMPRESSION: %s: %s %d", w.Name, c, level)
+	}
+	if err := c.Validate(level); err != nil {
+		return err
+	}
+	w.compression = c
+	w.compressionLevel = level
+	return nil
+}
+
 func (w *World) SetRandomSeed(seed int64) {
 	if Debug {
 		log.Printf("SET SEED: %s: %d", w.Name, seed)
@@ -102,6 +127,11 @@ func (w World) Write() error {
 	if err := w.writeRegions(); err != nil {
 		return err
 	}
+
+	// write villages
+	if err := w.writeVillages(); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -192,6 +222,8 @@ func (w *World) Biome(xz XZ) (byte, error) {
 	if err != nil {
 		return byte(0), err
 	}
+	c.lock.RLock()
+	defer c.lock.RUnlock()
 	return c.biomes[pt.Index()], nil
 }
 
@@ -201,6 +233,8 @@ func (w *World) SetBiome(xz XZ, b byte) error {
 	if err != nil {
 		return err
 	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
 	c.biomes[pt.Index()] = b
 	return nil
 }
@@ -211,6 +245,8 @@ func (w *World) HeightMap(xz XZ) (int32, error) {
 	if err != nil {
 		return int32(0), err
 	}
+	c.lock.RLock()
+	defer c.lock.RUnlock()
 	return c.heightMap[pt.Index()], nil
 }
 
@@ -220,75 +256,107 @@ func (w *World) SetHeightMap(xz XZ, i int32) error {
 	if err != nil {
 		return err
 	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
 	c.heightMap[pt.Index()] = i
 	return nil
 }
 
-// JMT: currently unused
+// Light in sections which do not exist reads as zero.
 func (w *World) BlockLight(pt Point) (byte, error) {
-	s, err := w.Section(pt)
-	if err != nil {
-		return 0, err
-	}
-	return Nibble(s.BlockLight, pt.Index()), nil
+	return w.light(pt, func(s Section) []byte { return s.BlockLight })
 }
 
 func (w *World) SetBlockLight(pt Point, b byte) error {
-	s, err := w.Section(pt)
-	if err != nil {
-		return err
-	}
-	WriteNibble(s.BlockLight, pt.Index(), b)
-	return nil
+	return w.setLight(pt, b, func(s Section) []byte { return s.BlockLight })
 }
 
 func (w *World) SkyLight(pt Point) (byte, error) {
-	s, err := w.Section(pt)
+	return w.light(pt, func(s Section) []byte { return s.SkyLight })
+}
+
+func (w *World) SetSkyLight(pt Point, b byte) error {
+	return w.setLight(pt, b, func(s Section) []byte { return s.SkyLight })
+}
+
+func (w World) light(pt Point, light func(Section) []byte) (byte, error) {
+	c, err := w.Chunk(pt)
 	if err != nil {
 		return 0, err
 	}
-	return Nibble(s.SkyLight, pt.Index()), nil
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	s, ok := c.section(pt.Y)
+	if !ok {
+		return 0, nil
+	}
+	return Nibble(light(s), pt.Index()), nil
 }
 
-func (w *World) SetSkyLight(pt Point, b byte) error {
-	s, err := w.Section(pt)
+func (w World) setLight(pt Point, b byte, light func(Section) []byte) error {
+	c, err := w.Chunk(pt)
 	if err != nil {
 		return err
 	}
-	WriteNibble(s.SkyLight, pt.Index(), b)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	WriteNibble(light(c.makeSection(pt.Y)), pt.Index(), b)
 	return nil
 }
 
+// Section returns the section holding a point, making it if there is
+// none.  Changes to the section are not guarded against other
+// goroutines; use the World methods for that.
 func (w World) Section(pt Point) (*Section, error) {
 	c, err := w.Chunk(pt)
 	if err != nil {
 		return nil, err
 	}
-	yf := int(floor(pt.Y, 16))
-	s, ok := c.Sections[yf]
-	if !ok {
-		c.Sections[yf] = MakeSection()
-		s = c.Sections[yf]
-	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	s := c.makeSection(pt.Y)
 	return &s, nil
 }
 
+// Chunk returns the chunk holding a point, loading it from its region
+// file or making an empty one if it is not yet in the world.
 func (w World) Chunk(pt Point) (*Chunk, error) {
 	cXZ := pt.ChunkXZ()
+	w.lock.RLock()
 	c, ok := w.ChunkMap[cXZ]
-	if !ok {
-		cp, lerr := w.loadChunk(cXZ)
-		if lerr != nil {
-			var emptytag nbt.Tag
-			mcp, merr := w.MakeChunk(cXZ, emptytag)
-			if merr != nil {
-				return nil, merr
-			}
-			cp = mcp
+	w.lock.RUnlock()
+	if ok {
+		return c, nil
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	// another goroutine may have added it in the meantime
+	if c, ok := w.ChunkMap[cXZ]; ok {
+		return c, nil
+	}
+	c, lerr := w.loadChunk(cXZ)
+	if lerr != nil {
+		var emptytag nbt.Tag
+		mc, merr := readChunk(cXZ, emptytag)
+		if merr != nil {
+			return nil, merr
 		}
-		c = *cp
+		c = mc
 	}
-	return &c, nil
+	if err := w.addChunkToMaps(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// HasChunk reports whether a chunk is in the world, without loading or
+// making it.  The argument is in chunk coordinates.
+func (w World) HasChunk(cXZ XZ) bool {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	_, ok := w.ChunkMap[cXZ]
+	return ok
 }
 
 // arguments are in chunk coordinates
@@ -297,34 +365,28 @@ func (w *World) loadChunk(cXZ XZ) (*Chunk, error) {
 		log.Printf("LOAD CHUNK: %s: %v", w.Name, cXZ)
 	}
 	rXZ := XZ{X: floor(cXZ.X, 32), Z: floor(cXZ.Z, 32)}
-	rname := w.regionFilename(rXZ)
-	r, err := os.Open(rname)
+	rf, err := OpenRegionFile(w.regionFilename(rXZ))
 	if err != nil {
 		return nil, err
 	}
-	defer r.Close()
-	cindex := (cXZ.Z%32)*32 + (cXZ.X % 32)
-
-	_, lerr := r.Seek(int64(cindex*4), os.SEEK_SET)
-	if lerr != nil {
-		return nil, lerr
-	}
-
-	var location int32
+	defer rf.Close()
+	return rf.ReadChunk(cXZ)
+}
 
-	err = binary.Read(r, binary.BigEndian, &location)
+func (w *World) MakeChunk(xz XZ, tag nbt.Tag) (*Chunk, error) {
+	c, err := readChunk(xz, tag)
 	if err != nil {
 		return nil, err
 	}
-
-	if location == 0 {
-		return nil, fmt.Errorf("location is zero: chunk not in region file")
+	if err := w.addChunk(c); err != nil {
+		return nil, err
 	}
-
-	return w.loadChunkFromRegion(r, location, cXZ)
+	return c, nil
 }
 
-func (w *World) MakeChunk(xz XZ, tag nbt.Tag) (*Chunk, error) {
+// readChunk makes the chunk at xz from its tag, or an empty chunk if the
+// tag is empty.  The chunk is not added to any world.
+func readChunk(xz XZ, tag nbt.Tag) (*Chunk, error) {
 	c := MakeChunk(xz.X, xz.Z)
 	var emptytag nbt.Tag
 	if tag != emptytag {
@@ -333,13 +395,17 @@ func (w *World) MakeChunk(xz XZ, tag nbt.Tag) (*Chunk, error) {
 			return nil, fmt.Errorf("tag position (%d, %d) did not match XZ %v", c.xPos, c.zPos, xz)
 		}
 	}
-	if err := w.addChunkToMaps(c); err != nil {
-		return nil, err
-	}
 	return &c, nil
 }
 
-func (w *World) addChunkToMaps(c Chunk) error {
+func (w *World) addChunk(c *Chunk) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.addChunkToMaps(c)
+}
+
+// the caller holds the world's lock
+func (w *World) addChunkToMaps(c *Chunk) error {
 	cXZ := XZ{X: c.xPos, Z: c.zPos}
 	if _, ok := w.ChunkMap[cXZ]; ok {
 		return fmt.Errorf("chunk %v already exists", cXZ)